@@ -3,21 +3,32 @@ module gopkg.in/go-mixed/dm.v1
 go 1.19
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/go-mysql-org/go-mysql v1.6.0
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/goplus/igop v0.9.6
 	github.com/jmoiron/sqlx v1.3.4
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/pingcap/errors v0.11.5-0.20201126102027-b0a155152ca3
 	github.com/pkg/errors v0.9.1
 	github.com/siddontang/go-log v0.0.0-20180807004314-8d05993dda07
 	github.com/spf13/cobra v1.6.1
 	go.etcd.io/bbolt v1.3.6
+	go.etcd.io/etcd/api/v3 v3.5.6
+	go.etcd.io/etcd/client/v3 v3.5.6
 	go.uber.org/multierr v1.9.0
 	go.uber.org/zap v1.24.0
 	golang.org/x/exp v0.0.0-20221217163422-3c43f8badb15
+	gopkg.in/go-mixed/dm-consumer.v1 v1.0.0-20221231074026-0a59bc6f4d4f
 	gopkg.in/go-mixed/go-common.v1 v1.0.0-20221231061850-7a65dba158ae
 	gopkg.in/go-mixed/go-common.v1/cache.v1 v1.0.0-20221231070604-08bd886cd751
+	gopkg.in/go-mixed/go-common.v1/cmd.v1 v1.0.0-20221231070604-08bd886cd751
+	gopkg.in/go-mixed/go-common.v1/conf.v1 v1.0.0-20221231070604-08bd886cd751
+	gopkg.in/go-mixed/go-common.v1/logger.v1 v1.0.0-20221231070604-08bd886cd751
+	gopkg.in/go-mixed/go-common.v1/storage.v1 v1.0.0-20221231070604-08bd886cd751
 	gopkg.in/go-mixed/igop.v1 v1.0.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -29,7 +40,6 @@ require (
 	github.com/go-playground/locales v0.14.0 // indirect
 	github.com/go-playground/universal-translator v0.18.0 // indirect
 	github.com/go-playground/validator/v10 v10.11.1 // indirect
-	github.com/go-redis/redis/v9 v9.0.0-rc.2 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/uuid v1.3.0 // indirect
@@ -60,9 +70,7 @@ require (
 	github.com/visualfc/goembed v0.3.3 // indirect
 	github.com/visualfc/goid v0.2.0 // indirect
 	github.com/visualfc/xtype v0.1.2 // indirect
-	go.etcd.io/etcd/api/v3 v3.5.6 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.5.6 // indirect
-	go.etcd.io/etcd/client/v3 v3.5.6 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	golang.org/x/crypto v0.4.0 // indirect
 	golang.org/x/mod v0.7.0 // indirect
@@ -74,11 +82,5 @@ require (
 	google.golang.org/grpc v1.51.0 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
-	gopkg.in/go-mixed/dm-consumer.v1 v1.0.0-20221231074026-0a59bc6f4d4f // indirect
-	gopkg.in/go-mixed/go-common.v1/cmd.v1 v1.0.0-20221231070604-08bd886cd751 // indirect
-	gopkg.in/go-mixed/go-common.v1/conf.v1 v1.0.0-20221231070604-08bd886cd751 // indirect
-	gopkg.in/go-mixed/go-common.v1/logger.v1 v1.0.0-20221231070604-08bd886cd751 // indirect
-	gopkg.in/go-mixed/go-common.v1/storage.v1 v1.0.0-20221231070604-08bd886cd751 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
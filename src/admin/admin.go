@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/task"
+	"gopkg.in/go-mixed/go-common.v1/utils/http"
+	"net/http"
+)
+
+// Admin 管理用的HTTP API，用于查看运行状态以及控制任务
+type Admin struct {
+	*component.Components
+
+	task   *task.Task
+	server *http_utils.HttpServer
+}
+
+type response struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func NewAdmin(components *component.Components, t *task.Task) *Admin {
+	a := &Admin{
+		Components: components,
+		task:       t,
+		server:     http_utils.NewHttpServer(components.Settings.AdminOptions.Addr, components.Logger.Sugar()),
+	}
+
+	a.handle(http.MethodGet, "/status", a.status)
+	a.handle(http.MethodGet, "/rules", a.rules)
+	a.handle(http.MethodGet, "/script", a.script)
+	a.handle(http.MethodGet, "/tables", a.tables)
+
+	a.handle(http.MethodPost, "/reader/pause", a.pauseReader)
+	a.handle(http.MethodPost, "/reader/resume", a.resumeReader)
+	a.handle(http.MethodPost, "/rules/pause", a.pauseRule)
+	a.handle(http.MethodPost, "/rules/resume", a.resumeRule)
+	a.handle(http.MethodPost, "/consume", a.consume)
+	a.handle(http.MethodPost, "/reload", a.reload)
+
+	return a
+}
+
+// Run 阻塞运行，直到ctx结束
+func (a *Admin) Run(ctx context.Context) error {
+	a.Logger.Info("[Admin]http server listening", zap.String("addr", a.Settings.AdminOptions.Addr))
+	return a.server.Run(ctx)
+}
+
+func (a *Admin) handle(method string, pattern string, handler func(r *http.Request) (any, error)) {
+	a.server.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			a.writeJson(w, http.StatusMethodNotAllowed, response{Code: http.StatusMethodNotAllowed, Message: "method not allowed"})
+			return
+		}
+
+		data, err := handler(r)
+		if err != nil {
+			a.writeJson(w, http.StatusBadRequest, response{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		a.writeJson(w, http.StatusOK, response{Code: 0, Data: data})
+	}))
+}
+
+func (a *Admin) writeJson(w http.ResponseWriter, status int, res response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		a.Logger.Error("[Admin]write response error", zap.Error(err))
+	}
+}
+
+func (a *Admin) status(r *http.Request) (any, error) {
+	return a.task.Status(), nil
+}
+
+func (a *Admin) rules(r *http.Request) (any, error) {
+	return a.task.RuleStates(), nil
+}
+
+func (a *Admin) script(r *http.Request) (any, error) {
+	return a.task.ScriptInfo(), nil
+}
+
+func (a *Admin) tables(r *http.Request) (any, error) {
+	tables := map[string]*consumer.Table{}
+	for alias, table := range a.Storage.Tables() {
+		tables[alias] = common.ToConsumerTable(table)
+	}
+	return tables, nil
+}
+
+func (a *Admin) pauseReader(r *http.Request) (any, error) {
+	a.Logger.Info("[Admin]pause reader")
+	return map[string]bool{"changed": a.task.PauseReader()}, nil
+}
+
+func (a *Admin) resumeReader(r *http.Request) (any, error) {
+	a.Logger.Info("[Admin]resume reader")
+	return map[string]bool{"changed": a.task.ResumeReader()}, nil
+}
+
+// POST /rules/pause?rule=schema.table
+func (a *Admin) pauseRule(r *http.Request) (any, error) {
+	rule := r.URL.Query().Get("rule")
+	a.Logger.Info("[Admin]pause rule", zap.String("rule", rule))
+	return nil, a.task.PauseRule(rule)
+}
+
+// POST /rules/resume?rule=schema.table
+func (a *Admin) resumeRule(r *http.Request) (any, error) {
+	rule := r.URL.Query().Get("rule")
+	a.Logger.Info("[Admin]resume rule", zap.String("rule", rule))
+	return nil, a.task.ResumeRule(rule)
+}
+
+func (a *Admin) consume(r *http.Request) (any, error) {
+	a.task.Consume()
+	return nil, nil
+}
+
+func (a *Admin) reload(r *http.Request) (any, error) {
+	a.Logger.Info("[Admin]reload settings")
+	return nil, a.task.Reload()
+}
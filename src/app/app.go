@@ -0,0 +1,266 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/admin"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/exporter"
+	"gopkg.in/go-mixed/dm.v1/src/mysql"
+	"gopkg.in/go-mixed/dm.v1/src/record"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	conf "gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/dm.v1/src/storage"
+	"gopkg.in/go-mixed/dm.v1/src/target"
+	"gopkg.in/go-mixed/dm.v1/src/task"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Execute 运行dm的命令行，作为库嵌入时，先使用 sink.Register 注册自定义的Sink，再调用此函数
+func Execute() {
+	if err := RootCommand().Execute(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// RootCommand dm的根命令，可以在此基础上添加自定义的子命令
+func RootCommand() *cobra.Command {
+	currentDir := io_utils.GetCurrentDir()
+	rootCmd := &cobra.Command{
+		Use:   "dm",
+		Short: "read binlog from Canal(MySQL), and transfer with golang plugin",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.PersistentFlags().GetString("config")
+			log, _ := cmd.PersistentFlags().GetString("log")
+			skipCheck, _ := cmd.Flags().GetBool("skip-check")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			run(config, log, runOptions{skipCheck: skipCheck, dryRun: dryRun})
+		},
+	}
+
+	// 读取CLI
+	rootCmd.PersistentFlags().StringP("config", "c", filepath.Join(currentDir, "conf/settings.yml"), "config file")
+	rootCmd.Flags().Bool("skip-check", false, "skip the preflight check of the upstream MySQL")
+	rootCmd.Flags().Bool("dry-run", false, "log the writes of scripts instead of executing them, and keep the binlog position")
+	rootCmd.AddCommand(positionCommand(), eventsCommand(), checkCommand(), scriptCommand(), schemaCommand(), recordCommand(), replayCommand())
+	return rootCmd
+}
+
+func exitIfError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func readSettings(_configFile, _logPath string) *conf.Settings {
+	// 读取配置文件
+	settings, err := conf.LoadSettings(_configFile)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if settings == nil {
+		panic("read settings fatal.")
+	}
+
+	return settings
+}
+
+func buildLogger(options logger.LoggerOptions) *logger.Logger {
+	// 初始化日志
+	logger, err := logger.NewLogger(options)
+	if err != nil {
+		panic(err.Error())
+	}
+	logger.Info("Loaded settings")
+
+	return logger
+}
+
+func buildMySql(components *component.Components) *mysql.MySql {
+	_mysql := mysql.NewMySql(components.Settings, components.Logger)
+	if err := _mysql.Connect(); err != nil {
+		panic(err.Error())
+	}
+
+	return _mysql
+}
+
+func buildTarget(components *component.Components) *target.Target {
+	_target := target.NewTarget(components.Settings, components.Logger)
+	if err := _target.Connect(); err != nil {
+		panic(err.Error())
+	}
+
+	return _target
+}
+
+func buildRegistry(components *component.Components) *registry.Registry {
+	if !components.Settings.SchemaRegistryOptions.Enabled {
+		return nil
+	}
+	_registry, err := registry.NewRegistry(components.Settings.SchemaRegistryOptions, components.Logger)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return _registry
+}
+
+func buildStorage(components *component.Components) *storage.Storage {
+	_storage, err := storage.NewStorage(components.Settings, components.Logger)
+	if err != nil {
+		panic(err.Error())
+	}
+	if err = _storage.Initial(); err != nil {
+		panic(err.Error())
+	}
+	_storage.SetRegistry(components.Registry)
+
+	return _storage
+}
+
+// 离线命令使用，不会清除events
+func buildOfflineStorage(components *component.Components) *storage.Storage {
+	_storage, err := storage.NewStorage(components.Settings, components.Logger)
+	if err != nil {
+		panic(err.Error())
+	}
+	_storage.Load()
+
+	return _storage
+}
+
+func runTask(components *component.Components, options runOptions, dryRun *exporter.DryRun) {
+	t := task.NewTask(components)
+
+	if err := t.Initial(); err != nil {
+		panic(err.Error())
+	}
+
+	if dryRun != nil {
+		t.SetDryRun(dryRun)
+		defer func() {
+			summary := dryRun.Summary()
+			components.Logger.Info("[DryRun]summary of writes\n" + summary)
+			fmt.Println("dry-run summary of writes:\n" + summary)
+		}()
+	}
+
+	if options.record != "" {
+		recorder, err := record.NewRecorder(options.record, components.Settings.MySqlOptions.Host, components.Logger)
+		if err != nil {
+			panic(err.Error())
+		}
+		defer recorder.Close()
+		t.SetRecorder(recorder)
+	}
+
+	// stop when ctrl+c, reload when SIGHUP
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if options.duration > 0 {
+		time.AfterFunc(options.duration, cancel)
+	}
+	listenSignal(ctx, cancel, func() {
+		if err := t.Reload(); err != nil {
+			components.Logger.Error("reload settings error", zap.Error(err))
+		}
+	})
+
+	if components.Settings.AdminOptions.Enabled {
+		go runAdmin(ctx, components, t)
+	}
+
+	// always block run except called cancel()
+	t.Run(ctx)
+}
+
+// 和 core.ListenStopSignal 不同的是，SIGHUP 用于重新加载配置
+func listenSignal(ctx context.Context, exitCallback context.CancelFunc, reloadCallback func()) {
+	go func() {
+		sign := make(chan os.Signal, 1)
+		signal.Notify(sign, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		defer signal.Stop(sign)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-sign:
+				if s == syscall.SIGHUP {
+					reloadCallback()
+				} else {
+					exitCallback()
+					return
+				}
+			}
+		}
+	}()
+}
+
+func runAdmin(ctx context.Context, components *component.Components, t *task.Task) {
+	if err := admin.NewAdmin(components, t).Run(ctx); err != nil {
+		components.Logger.Error("admin server error", zap.Error(err))
+	}
+}
+
+func export(components *component.Components) {
+	exporter.SetLogger(components.Logger)
+	exporter.SetRedis(components.Target.Redis)
+	exporter.SetEtcd(components.Target.Etcd)
+	exporter.SetGetTableFn(components.Storage.GetTable)
+	exporter.Export()
+}
+
+type runOptions struct {
+	skipCheck bool
+	// 录制events的文件，为空表示不录制
+	record string
+	// 运行时长，0表示一直运行
+	duration time.Duration
+	// 只记录脚本的写入，不保存binlog位置
+	dryRun bool
+}
+
+func run(_configFile, _logPath string, options runOptions) {
+	components := &component.Components{}
+	defer func() {
+		if err := components.Close(); err != nil && components.Logger != nil {
+			components.Logger.Error("components close error", zap.Error(err))
+		}
+	}()
+
+	components.Settings = readSettings(_configFile, _logPath)
+	components.Logger = buildLogger(components.Settings.LoggerOptions)
+	components.Mysql = buildMySql(components)
+	components.Target = buildTarget(components)
+	components.Registry = buildRegistry(components)
+	components.Storage = buildStorage(components)
+
+	if !options.skipCheck {
+		checkUpstream(components)
+	}
+
+	var dryRun *exporter.DryRun
+	if options.dryRun {
+		dryRun = exporter.NewDryRun(components.Logger)
+		exporter.SetDryRun(dryRun)
+	}
+
+	// 一定要在task之前运行
+	export(components)
+
+	runTask(components, options, dryRun)
+
+	components.Logger.Info("application exit.")
+}
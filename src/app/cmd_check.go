@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/go-mixed/dm.v1/src/check"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/storage"
+	"os"
+)
+
+func checkCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check",
+		Short: "preflight validation of the upstream MySQL",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+
+			components := &component.Components{}
+			components.Settings = readSettings(config, "")
+			components.Logger = buildLogger(components.Settings.LoggerOptions)
+			components.Mysql = buildMySql(components)
+			// 守护进程运行时storage被锁定，此时只检查配置文件中的binlog位置
+			if _storage, err := storage.NewStorage(components.Settings, components.Logger); err != nil {
+				fmt.Printf("storage is unavailable (%s), check the configured binlog position only\n\n", err.Error())
+			} else {
+				components.Storage = _storage
+			}
+
+			results := check.NewChecker(components).Run()
+			results.Print(os.Stdout)
+			_ = components.Close()
+
+			if results.Failed() {
+				fmt.Println("\ncheck failed.")
+				os.Exit(1)
+			}
+			fmt.Println("\nall checks passed.")
+		},
+	}
+}
+
+// 启动时检查上游MySQL，失败时退出
+func checkUpstream(components *component.Components) {
+	results := check.NewChecker(components).Run()
+	if results.Failed() {
+		components.Logger.Error("preflight check failed, run \"dm check\" for details, or use --skip-check to skip it\n" + results.String())
+		panic("preflight check failed")
+	}
+	components.Logger.Info("preflight check passed")
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/storage"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func eventsCommand() *cobra.Command {
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "inspect the buffered events in the storage (the daemon must be stopped)",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the buffered events",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			exitIfError(listEvents(cmd, config))
+		},
+	}
+	listCmd.Flags().String("table", "", "filter by schema.table, wildcard(*) supported")
+	listCmd.Flags().String("action", "", "filter by action: insert, update, delete")
+	listCmd.Flags().Uint64("from", 0, "the minimum event ID")
+	listCmd.Flags().Uint64("to", 0, "the maximum event ID, 0 means unlimited")
+	listCmd.Flags().Int("limit", 100, "the maximum count of events to list, 0 means unlimited")
+
+	showCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "show the decoded event as JSON",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			exitIfError(showEvent(config, args[0]))
+		},
+	}
+
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "delete the events whose ID is less than or equal to --to",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			to, _ := cmd.Flags().GetUint64("to")
+			exitIfError(purgeEvents(config, to))
+		},
+	}
+	purgeCmd.Flags().Uint64("to", 0, "the maximum event ID to delete")
+	_ = purgeCmd.MarkFlagRequired("to")
+
+	skipCmd := &cobra.Command{
+		Use:   "skip <id>",
+		Short: "delete a single event",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			exitIfError(skipEvent(config, args[0]))
+		},
+	}
+
+	deadLettersCmd := &cobra.Command{
+		Use:   "dead-letters",
+		Short: "list the poison batches moved out of the events by sinks",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			exitIfError(listDeadLetters(config))
+		},
+	}
+
+	eventsCmd.AddCommand(listCmd, showCmd, purgeCmd, skipCmd, deadLettersCmd)
+	return eventsCmd
+}
+
+func listEvents(cmd *cobra.Command, _configFile string) error {
+	table, _ := cmd.Flags().GetString("table")
+	action, _ := cmd.Flags().GetString("action")
+	from, _ := cmd.Flags().GetUint64("from")
+	to, _ := cmd.Flags().GetUint64("to")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTABLE\tACTION\tALIAS\tDIFF COLUMNS")
+
+	var n int
+	err := components.Storage.ScanEvents(from, to, func(key string, event consumer.RowEvent) bool {
+		if table != "" && !text_utils.WildcardMatchSimple(table, common.BuildTableName(event.Schema, event.Table, nil)) {
+			return true
+		} else if action != "" && !strings.EqualFold(action, event.Action) {
+			return true
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", event.ID, common.BuildTableName(event.Schema, event.Table, nil), event.Action, event.Alias, strings.Join(event.DiffCols, ","))
+		n++
+		return limit <= 0 || n < limit
+	})
+	_ = w.Flush()
+
+	fmt.Printf("\n%d events listed, %d events in storage\n", n, components.Storage.EventCount())
+	return err
+}
+
+func showEvent(_configFile string, _id string) error {
+	id, err := strconv.ParseUint(_id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid event ID \"%s\"", _id)
+	}
+
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	key, event, err := components.Storage.GetEvent(id)
+	if err != nil {
+		return err
+	} else if event == nil {
+		return fmt.Errorf("event %d not found", id)
+	}
+
+	buf, err := json.MarshalIndent(struct {
+		Key   string            `json:"key"`
+		Event consumer.RowEvent `json:"event"`
+		Table *consumer.Table   `json:"table,omitempty"`
+	}{
+		Key:   key,
+		Event: *event,
+		Table: common.ToConsumerTable(components.Storage.GetTable(event.Alias)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(buf))
+	return nil
+}
+
+func purgeEvents(_configFile string, to uint64) error {
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	n, err := components.Storage.PurgeEventsTo(to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d events purged, %d events remain\n", n, components.Storage.EventCount())
+	return nil
+}
+
+func skipEvent(_configFile string, _id string) error {
+	id, err := strconv.ParseUint(_id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid event ID \"%s\"", _id)
+	}
+
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	key, event, err := components.Storage.GetEvent(id)
+	if err != nil {
+		return err
+	} else if event == nil {
+		return fmt.Errorf("event %d not found", id)
+	}
+
+	if err = components.Storage.DeleteEvent(key); err != nil {
+		return err
+	}
+
+	fmt.Printf("event %d (%s) skipped\n", id, key)
+	return nil
+}
+
+func listDeadLetters(_configFile string) error {
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tRULE\tSINK\tEVENTS\tAT\tERROR")
+
+	err := components.Storage.ScanDeadLetters(func(letter storage.DeadLetter) bool {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", letter.Key, letter.Rule, letter.Sink, len(letter.Events), letter.At.Format(time.RFC3339), letter.Error)
+		return true
+	})
+	_ = w.Flush()
+
+	fmt.Printf("\n%d dead letters in storage\n", components.Storage.DeadLetterCount())
+	return err
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"os"
+	"strings"
+	"time"
+)
+
+func positionCommand() *cobra.Command {
+	positionCmd := &cobra.Command{
+		Use:   "position",
+		Short: "inspect or rewrite the binlog checkpoint (the daemon must be stopped)",
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "show the saved binlog position",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			showPosition(config)
+		},
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set",
+		Short: "set the binlog position by --file/--pos, --gtid or --time",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			exitIfError(setPosition(cmd, config))
+		},
+	}
+	setCmd.Flags().String("file", "", "binlog file, e.g. mysql-bin.000001")
+	setCmd.Flags().Uint32("pos", 4, "binlog position, with --file")
+	setCmd.Flags().String("gtid", "", "GTID set, e.g. 3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5")
+	setCmd.Flags().String("time", "", "locate the position by time, format: \"2006-01-02 15:04:05\" in mysql.timezone, or RFC3339")
+	setCmd.Flags().Bool("clear-events", false, "clear the buffered events without asking")
+	setCmd.Flags().Bool("keep-events", false, "keep the buffered events without asking")
+
+	positionCmd.AddCommand(showCmd, setCmd)
+	return positionCmd
+}
+
+func showPosition(_configFile string) {
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	saved := components.Storage.ReadBinLogPosition()
+	configured := components.Settings.TaskOptions.BinLog
+
+	fmt.Printf("saved position:      %s\n", core.If(saved.IsEmpty(), "<none>", saved.String()))
+	fmt.Printf("configured position: %s\n", core.If(configured.IsEmpty(), "<none>", configured.String()))
+	fmt.Printf("start position:      %s\n", components.Storage.GetLatestBinLogPosition(configured).String())
+	fmt.Printf("buffered events:     %d (latest id: %d)\n", components.Storage.EventCount(), components.Storage.LatestID())
+}
+
+func setPosition(cmd *cobra.Command, _configFile string) error {
+	file, _ := cmd.Flags().GetString("file")
+	pos, _ := cmd.Flags().GetUint32("pos")
+	gtid, _ := cmd.Flags().GetString("gtid")
+	at, _ := cmd.Flags().GetString("time")
+	clearEvents, _ := cmd.Flags().GetBool("clear-events")
+	keepEvents, _ := cmd.Flags().GetBool("keep-events")
+
+	if clearEvents && keepEvents {
+		return fmt.Errorf("--clear-events and --keep-events cannot be used together")
+	}
+
+	var n int
+	for _, v := range []string{file, gtid, at} {
+		if v != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("one of --file/--pos, --gtid or --time is required")
+	}
+
+	components := buildOfflineComponents(_configFile)
+	defer components.Close()
+
+	var binLog common.BinLogPosition
+	switch {
+	case file != "":
+		binLog = common.BinLogPosition{File: file, Position: pos}
+	case gtid != "":
+		binLog = common.BinLogPosition{GTID: gtid}
+		if _, err := binLog.ToGTIDSet(components.Settings.MySqlOptions.Flavor); err != nil {
+			return fmt.Errorf("invalid gtid \"%s\": %w", gtid, err)
+		}
+	default:
+		t, err := parseTime(at, components.Settings.MySqlOptions.TimeZone)
+		if err != nil {
+			return err
+		}
+		components.Mysql = buildMySql(components)
+		fmt.Printf("locating the binlog position of %s ...\n", t.Format(time.RFC3339))
+		if binLog, err = components.Mysql.LocatePosition(context.Background(), t); err != nil {
+			return err
+		}
+	}
+
+	count := components.Storage.EventCount()
+	if count > 0 && !clearEvents && !keepEvents {
+		clearEvents = askClearEvents(count)
+	}
+
+	if err := components.Storage.WriteBinLogPosition(binLog); err != nil {
+		return err
+	}
+	fmt.Printf("binlog position saved: %s\n", binLog.String())
+
+	if clearEvents {
+		components.Storage.ClearEvents()
+		fmt.Printf("%d buffered events cleared\n", count)
+	}
+
+	configured := components.Settings.TaskOptions.BinLog
+	if binLog.GTID == "" && configured.GreaterThan(binLog) {
+		fmt.Printf("warning: the configured \"task.binlog\" (%s) is greater than the new position, it will be used at start\n", configured.String())
+	}
+	return nil
+}
+
+func askClearEvents(count uint64) bool {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("there are %d buffered events, [c]lear or [k]eep them? ", count)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "c", "clear":
+			return true
+		case "k", "keep":
+			return false
+		}
+	}
+}
+
+func parseTime(s string, timezone string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	zone, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time \"%s\", the format is \"2006-01-02 15:04:05\" or RFC3339", s)
+	}
+	return t, nil
+}
+
+// 离线命令使用的组件，只有settings、logger、storage
+func buildOfflineComponents(_configFile string) *component.Components {
+	components := &component.Components{}
+	components.Settings = readSettings(_configFile, "")
+	components.Logger = buildLogger(components.Settings.LoggerOptions)
+	components.Storage = buildOfflineStorage(components)
+	return components
+}
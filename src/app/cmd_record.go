@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/exporter"
+	"gopkg.in/go-mixed/dm.v1/src/record"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"time"
+)
+
+func recordCommand() *cobra.Command {
+	recordCmd := &cobra.Command{
+		Use:   "record",
+		Short: "run as the daemon, and record the received events into a file for \"dm replay\"",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			output, _ := cmd.Flags().GetString("output")
+			duration, _ := cmd.Flags().GetDuration("duration")
+			skipCheck, _ := cmd.Flags().GetBool("skip-check")
+
+			run(config, "", runOptions{skipCheck: skipCheck, record: output, duration: duration})
+		},
+	}
+	recordCmd.Flags().StringP("output", "o", "", "the record file")
+	recordCmd.Flags().Duration("duration", 0, "stop after the duration, 0 means until ctrl+c")
+	recordCmd.Flags().Bool("skip-check", false, "skip the preflight check of the upstream MySQL")
+	_ = recordCmd.MarkFlagRequired("output")
+
+	return recordCmd
+}
+
+func replayCommand() *cobra.Command {
+	replayCmd := &cobra.Command{
+		Use:   "replay <file>",
+		Short: "feed the recorded events through the rules and scripts again, the storage and binlog position are untouched",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			speed, _ := cmd.Flags().GetFloat64("speed")
+			fake, _ := cmd.Flags().GetBool("fake")
+			stopOnError, _ := cmd.Flags().GetBool("stop-on-error")
+			exitIfError(replay(config, args[0], speed, fake, stopOnError))
+		},
+	}
+	replayCmd.Flags().Float64("speed", 0, "0: as fast as possible, 1: the original speed, 2: twice the original speed")
+	replayCmd.Flags().Bool("fake", false, "use the in-memory Redis/Etcd instead of the targets in the config file")
+	replayCmd.Flags().Bool("stop-on-error", false, "stop at the first failed batch")
+
+	return replayCmd
+}
+
+func replay(config, file string, speed float64, fake bool, stopOnError bool) error {
+	reader, err := record.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	components := &component.Components{}
+	defer components.Close()
+	components.Settings = readSettings(config, "")
+	components.Logger = buildLogger(components.Settings.LoggerOptions)
+
+	replayer := record.NewReplayer(components, speed, stopOnError)
+
+	redis, etcd := exporter.NewMemoryCache(), exporter.NewMemoryCache()
+	if fake {
+		exporter.SetConsumerFakes(redis, etcd, nil)
+	} else {
+		components.Target = buildTarget(components)
+		exporter.SetRedis(components.Target.Redis)
+		exporter.SetEtcd(components.Target.Etcd)
+	}
+	exporter.SetLogger(components.Logger)
+	exporter.SetGetTableFn(replayer.GetTable)
+	exporter.Export()
+
+	if err = replayer.Initial(); err != nil {
+		return err
+	}
+
+	fmt.Printf("replay %s, recorded from %s at %s, speed: %s\n", file, reader.Header.Host,
+		reader.Header.StartedAt.Format(time.RFC3339), core.If(speed > 0, fmt.Sprintf("%gx", speed), "unlimited"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listenSignal(ctx, cancel, func() {})
+
+	err = replayer.Run(ctx, reader)
+	if _err := replayer.Close(context.Background()); _err != nil {
+		components.Logger.Error("close script error", zap.Error(_err))
+	}
+
+	fmt.Println(replayer.Summary())
+	if fake {
+		fmt.Printf("fake redis: %d keys, fake etcd: %d keys\n", len(redis.Dump()), len(etcd.Dump()))
+	}
+	return err
+}
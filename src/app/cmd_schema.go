@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	conf "gopkg.in/go-mixed/dm.v1/src/settings"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+func schemaCommand() *cobra.Command {
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "inspect the versions of the schema registry used by the avro and protobuf formats",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the versions of each table",
+		Run: func(cmd *cobra.Command, args []string) {
+			r, err := openRegistry(cmd)
+			exitIfError(err)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SUBJECT\tVERSION\tID\tFIELDS\tCREATED AT")
+			for _, subject := range r.Subjects() {
+				for _, s := range r.Versions(subject) {
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", s.Subject, s.Version, s.ID, len(s.Fields), s.CreatedAt.Format("2006-01-02 15:04:05"))
+				}
+			}
+			_ = w.Flush()
+		},
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "write the .avsc/.proto files of the latest (or all) versions",
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString("out")
+			subjects, _ := cmd.Flags().GetStringSlice("subject")
+			format, _ := cmd.Flags().GetString("format")
+			all, _ := cmd.Flags().GetBool("all-versions")
+
+			r, err := openRegistry(cmd)
+			exitIfError(err)
+			exitIfError(exportSchemas(r, out, subjects, format, all))
+		},
+	}
+	exportCmd.Flags().String("out", "schemas-export", "the output dir, files are named {schema}.{table}.v{version}.avsc/.proto")
+	exportCmd.Flags().StringSlice("subject", nil, "only export these schema.table, default is all")
+	exportCmd.Flags().String("format", "all", "avro, protobuf or all")
+	exportCmd.Flags().Bool("all-versions", false, "export all versions instead of the latest, the .proto files of a table share the same package")
+
+	schemaCmd.PersistentFlags().String("dir", "", "the registry dir, default is the \"schema_registry.dir\" of the config file")
+	schemaCmd.AddCommand(listCmd, exportCmd)
+	return schemaCmd
+}
+
+// openRegistry 只读取registry的文件，不需要停止daemon
+func openRegistry(cmd *cobra.Command) (*registry.Registry, error) {
+	config, _ := cmd.Flags().GetString("config")
+	dir, _ := cmd.Flags().GetString("dir")
+
+	settings, err := conf.LoadSettings(config)
+	if err != nil {
+		return nil, err
+	}
+	options := settings.SchemaRegistryOptions
+	if dir != "" {
+		options.Dir = dir
+	}
+	return registry.NewRegistry(options, buildLogger(settings.LoggerOptions))
+}
+
+func exportSchemas(r *registry.Registry, out string, subjects []string, format string, all bool) error {
+	switch format {
+	case "avro", "protobuf", "all":
+	default:
+		return errors.Errorf("unsupported format \"%s\", must be avro, protobuf or all", format)
+	}
+	if len(subjects) <= 0 {
+		subjects = r.Subjects()
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return errors.Wrapf(err, "create dir \"%s\" error", out)
+	}
+
+	var n int
+	for _, subject := range subjects {
+		versions := r.Versions(subject)
+		if len(versions) <= 0 {
+			return errors.Errorf("subject \"%s\" is not registered", subject)
+		}
+		if !all {
+			versions = versions[len(versions)-1:]
+		}
+
+		for _, s := range versions {
+			name := filepath.Join(out, fmt.Sprintf("%s.v%d", s.Subject, s.Version))
+			if format != "protobuf" {
+				buf, err := s.Avro()
+				if err != nil {
+					return err
+				}
+				if err = os.WriteFile(name+".avsc", buf, 0o644); err != nil {
+					return errors.WithStack(err)
+				}
+				n++
+			}
+			if format != "avro" {
+				if err := os.WriteFile(name+".proto", []byte(s.Proto()), 0o644); err != nil {
+					return errors.WithStack(err)
+				}
+				n++
+			}
+		}
+	}
+
+	fmt.Printf("%d files written to %s\n", n, out)
+	return nil
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/go-mixed/dm.v1/src/script"
+	conf "gopkg.in/go-mixed/dm.v1/src/settings"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func scriptCommand() *cobra.Command {
+	scriptCmd := &cobra.Command{
+		Use:   "script",
+		Short: "tools of the consumer scripts",
+	}
+
+	testCmd := &cobra.Command{
+		Use:   "test <fixture files or dirs...>",
+		Short: "run the scripts against JSON/YAML fixtures with in-memory Redis/Etcd/Logger",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, _ := cmd.Flags().GetString("config")
+			dir, _ := cmd.Flags().GetString("script-dir")
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			showLogs, _ := cmd.Flags().GetBool("logs")
+
+			if dir == "" {
+				settings, err := conf.LoadSettings(config)
+				exitIfError(err)
+				dir = settings.TaskOptions.ScriptDir
+			}
+
+			failed, err := testScripts(dir, verbose, timeout, showLogs, args)
+			exitIfError(err)
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	testCmd.Flags().String("script-dir", "", "the script dir, default is the \"task.script_dir\" of the config file")
+	testCmd.Flags().Bool("verbose", false, "verbose output of the igop build")
+	testCmd.Flags().Duration("timeout", 10*time.Second, "the timeout of each case")
+	testCmd.Flags().Bool("logs", false, "print the logs of the scripts of each case")
+
+	scriptCmd.AddCommand(testCmd)
+	return scriptCmd
+}
+
+func testScripts(dir string, verbose bool, timeout time.Duration, showLogs bool, paths []string) (bool, error) {
+	files, err := fixtureFiles(paths)
+	if err != nil {
+		return false, err
+	}
+
+	tester, err := script.NewTester(dir, verbose, timeout)
+	if err != nil {
+		return false, err
+	}
+
+	var passed, failed int
+	for _, file := range files {
+		fixture, err := script.LoadFixture(file)
+		if err != nil {
+			return false, err
+		}
+
+		for _, result := range tester.Run(file, fixture) {
+			status := "PASS"
+			if result.Passed() {
+				passed++
+			} else {
+				status = "FAIL"
+				failed++
+			}
+			fmt.Printf("--- %s: %s/%s (%s)\n", status, result.File, result.Name, result.Duration.Round(time.Millisecond))
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+			if showLogs || !result.Passed() {
+				for _, line := range result.Logs {
+					fmt.Printf("    | %s\n", line)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	return failed > 0, nil
+}
+
+// fixtureFiles 展开目录中的 .json/.yml/.yaml 文件
+func fixtureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fixture \"%s\" error", path)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			switch strings.ToLower(filepath.Ext(match)) {
+			case ".json", ".yml", ".yaml":
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
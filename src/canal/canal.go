@@ -5,6 +5,7 @@ import (
 	"github.com/go-mysql-org/go-mysql/canal"
 	"github.com/pingcap/errors"
 	"github.com/siddontang/go-log/log"
+	"golang.org/x/exp/slices"
 	"gopkg.in/go-mixed/dm.v1/src/common"
 	"gopkg.in/go-mixed/dm.v1/src/component"
 	"gopkg.in/go-mixed/go-common.v1/utils/core"
@@ -18,6 +19,8 @@ type Canal struct {
 	*component.Components
 
 	canal *canal.Canal
+	// canal只读取这些表，新增的rules需要重启canal
+	patterns []string
 }
 
 func NewCanal(components *component.Components, handler canal.EventHandler) (*Canal, error) {
@@ -25,6 +28,7 @@ func NewCanal(components *component.Components, handler canal.EventHandler) (*Ca
 	if err != nil {
 		panic(err.Error())
 	}
+	patterns := components.Settings.TaskOptions.GetTablePatterns()
 
 	cfg := &canal.Config{
 		Addr:                  components.Settings.MySqlOptions.Host,
@@ -35,7 +39,7 @@ func NewCanal(components *component.Components, handler canal.EventHandler) (*Ca
 		Flavor:                components.Settings.MySqlOptions.Flavor,
 		HeartbeatPeriod:       components.Settings.MySqlOptions.HeartbeatPeriod,
 		ReadTimeout:           components.Settings.MySqlOptions.ReadTimeout,
-		IncludeTableRegex:     components.Settings.TaskOptions.GetTablePatterns(),
+		IncludeTableRegex:     patterns,
 		ExcludeTableRegex:     nil,
 		DiscardNoMetaRowEvent: false,
 		Dump: canal.DumpConfig{
@@ -64,6 +68,7 @@ func NewCanal(components *component.Components, handler canal.EventHandler) (*Ca
 	_c := &Canal{
 		Components: components,
 		canal:      c,
+		patterns:   patterns,
 	}
 
 	c.SetEventHandler(handler)
@@ -72,9 +77,48 @@ func NewCanal(components *component.Components, handler canal.EventHandler) (*Ca
 }
 
 func (c *Canal) Start(binlog common.BinLogPosition) error {
+	if binlog.GTID != "" {
+		set, err := binlog.ToGTIDSet(c.Settings.MySqlOptions.Flavor)
+		if err != nil {
+			return errors.Annotatef(err, "parse gtid \"%s\" error", binlog.GTID)
+		}
+		return errors.WithStack(c.canal.StartFromGTID(set))
+	}
 	return errors.WithStack(c.canal.RunFrom(binlog.ToMysqlPos()))
 }
 
+// Includes canal是否读取了patterns中所有的表
+func (c *Canal) Includes(patterns []string) bool {
+	for _, pattern := range patterns {
+		if !slices.Contains(c.patterns, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// LogName 当前正在读取的binlog文件
+func (c *Canal) LogName() string {
+	return c.canal.SyncedPosition().Name
+}
+
+// WaitDumped 等待mysqldump结束，成功时返回true（没有执行mysqldump时也是true）
+//
+//	mysqldump失败或者被中断时，canal不会更新binlog位置；stop关闭时放弃等待并返回false
+func (c *Canal) WaitDumped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		// canal退出时mysqldump可能已经结束
+		select {
+		case <-c.canal.WaitDumpDone():
+		default:
+			return false
+		}
+	case <-c.canal.WaitDumpDone():
+	}
+	return c.canal.SyncedPosition().Name != ""
+}
+
 func (c *Canal) Stop() {
 	c.canal.Close()
 }
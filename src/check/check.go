@@ -0,0 +1,98 @@
+package check
+
+import (
+	"fmt"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Result 一项检查的结果
+type Result struct {
+	Name    string
+	Passed  bool
+	Message string
+	// 失败时的修复建议
+	Hint string
+}
+
+type Results []Result
+
+// Checker 检查上游MySQL的配置是否满足同步的要求
+type Checker struct {
+	*component.Components
+
+	// MySQL中所有的表，checkGrants和checkRules共用
+	tablesOnce sync.Once
+	tables     []string
+	tablesErr  error
+}
+
+func NewChecker(components *component.Components) *Checker {
+	return &Checker{
+		Components: components,
+	}
+}
+
+func (c *Checker) Run() Results {
+	var results Results
+	for _, fn := range []func() Result{
+		c.checkLogBin,
+		c.checkBinlogFormat,
+		c.checkBinlogRowImage,
+		c.checkGTIDMode,
+		c.checkGrants,
+		c.checkBinlogFile,
+		c.checkServerID,
+	} {
+		results = append(results, fn())
+	}
+
+	results = append(results, c.checkRules()...)
+	return append(results, c.checkSinks()...)
+}
+
+// tableNames 只读取一次所有的表名
+func (c *Checker) tableNames() ([]string, error) {
+	c.tablesOnce.Do(func() {
+		c.tables, c.tablesErr = c.Mysql.TableNames()
+	})
+	return c.tables, c.tablesErr
+}
+
+func (r Results) Failed() bool {
+	for _, result := range r {
+		if !result.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Results) Print(w io.Writer) {
+	for _, result := range r {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		_, _ = fmt.Fprintf(w, "[%s] %s: %s\n", status, result.Name, result.Message)
+		if !result.Passed && result.Hint != "" {
+			_, _ = fmt.Fprintf(w, "       hint: %s\n", result.Hint)
+		}
+	}
+}
+
+func (r Results) String() string {
+	sb := &strings.Builder{}
+	r.Print(sb)
+	return sb.String()
+}
+
+func passed(name string, format string, args ...any) Result {
+	return Result{Name: name, Passed: true, Message: fmt.Sprintf(format, args...)}
+}
+
+func failed(name string, hint string, format string, args ...any) Result {
+	return Result{Name: name, Passed: false, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
@@ -0,0 +1,244 @@
+package check
+
+import (
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func (c *Checker) checkVariable(name string, expected string, hint string) Result {
+	value, err := c.Mysql.Variable(name)
+	if err != nil {
+		return failed(name, "", "read variable error: %s", err.Error())
+	} else if !strings.EqualFold(value, expected) {
+		return failed(name, hint, "expected \"%s\", got \"%s\"", expected, value)
+	}
+	return passed(name, "%s", value)
+}
+
+func (c *Checker) checkLogBin() Result {
+	return c.checkVariable("log_bin", "ON", "enable the binary log with \"log_bin\" in my.cnf and restart MySQL")
+}
+
+func (c *Checker) checkBinlogFormat() Result {
+	return c.checkVariable("binlog_format", "ROW", "SET GLOBAL binlog_format = 'ROW'; and set \"binlog_format = ROW\" in my.cnf")
+}
+
+func (c *Checker) checkBinlogRowImage() Result {
+	return c.checkVariable("binlog_row_image", "FULL", "SET GLOBAL binlog_row_image = 'FULL'; and set \"binlog_row_image = FULL\" in my.cnf")
+}
+
+func (c *Checker) checkGTIDMode() Result {
+	const name = "gtid_mode"
+	if c.startPosition().GTID == "" {
+		return passed(name, "GTID is not configured, skipped")
+	} else if strings.EqualFold(c.Settings.MySqlOptions.Flavor, "mariadb") {
+		return passed(name, "MariaDB always supports GTID")
+	}
+	return c.checkVariable(name, "ON", "set \"gtid_mode = ON\" and \"enforce_gtid_consistency = ON\" in my.cnf, or sync by file/position instead")
+}
+
+var grantOnRegexp = regexp.MustCompile("(?i)^GRANT (.+) ON (\\S+) TO ")
+
+// 缺少SELECT权限的表最多列出的数量
+const maxMissingTables = 5
+
+func (c *Checker) checkGrants() Result {
+	const name = "grants"
+	const hint = "GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO 'user'@'%';"
+
+	grants, err := c.Mysql.Grants()
+	if err != nil {
+		return failed(name, "", "show grants error: %s", err.Error())
+	}
+
+	privileges := map[string]bool{}
+	// 拥有SELECT权限的 db.table，db.* 中的db可以包含LIKE的通配符
+	var selectOn []string
+	for _, grant := range grants {
+		matches := grantOnRegexp.FindStringSubmatch(grant)
+		if matches == nil {
+			continue
+		}
+		on := strings.ReplaceAll(matches[2], "`", "")
+		for _, privilege := range strings.Split(matches[1], ",") {
+			privilege = strings.ToUpper(strings.TrimSpace(privilege))
+			if on == "*.*" {
+				privileges[privilege] = true
+			}
+			if privilege == "SELECT" || privilege == "ALL PRIVILEGES" || privilege == "ALL" {
+				selectOn = append(selectOn, on)
+			}
+		}
+	}
+
+	if privileges["ALL PRIVILEGES"] || privileges["ALL"] {
+		return passed(name, "ALL PRIVILEGES ON *.*")
+	}
+
+	var missing []string
+	for _, privilege := range []string{"REPLICATION SLAVE", "REPLICATION CLIENT"} {
+		if !privileges[privilege] {
+			missing = append(missing, privilege+" ON *.*")
+		}
+	}
+
+	if !privileges["SELECT"] {
+		// rule的schema、table是正则表达式，所以检查它们匹配的每一个表
+		tables, err := c.tableNames()
+		if err != nil {
+			return failed(name, "", "read tables error: %s", err.Error())
+		}
+
+		var denied []string
+		for _, table := range tables {
+			if c.Settings.TaskOptions.MatchRule(splitTableName(table)) != nil && !selectGranted(selectOn, table) {
+				denied = append(denied, table)
+			}
+		}
+		if len(denied) > maxMissingTables {
+			denied = append(denied[:maxMissingTables], "and "+strconv.Itoa(len(denied)-maxMissingTables)+" more tables")
+		}
+		if len(denied) > 0 {
+			missing = append(missing, "SELECT ON "+strings.Join(denied, ", "))
+		}
+	}
+
+	if len(missing) > 0 {
+		return failed(name, hint, "missing %s", strings.Join(missing, ", "))
+	}
+	return passed(name, "SELECT, REPLICATION SLAVE, REPLICATION CLIENT")
+}
+
+// selectGranted table（schema.table）是否在某个授权的范围内
+func selectGranted(selectOn []string, table string) bool {
+	schema, name := splitTableName(table)
+	for _, on := range selectOn {
+		onSchema, onTable, _ := strings.Cut(on, ".")
+		switch {
+		case onTable == "*" && grantSchemaMatch(onSchema, schema):
+			return true
+		case onSchema == schema && onTable == name: // 表级别的授权中没有通配符
+			return true
+		}
+	}
+	return false
+}
+
+// grantSchemaMatch 数据库级别的授权可以使用LIKE的通配符：% 和 _，\_ 为字面值
+func grantSchemaMatch(pattern, schema string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case ch == '%':
+			sb.WriteString(".*")
+		case ch == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	matched, _ := regexp.MatchString(sb.String(), schema)
+	return matched
+}
+
+func splitTableName(table string) (string, string) {
+	schema, name, _ := strings.Cut(table, ".")
+	return schema, name
+}
+
+func (c *Checker) checkBinlogFile() Result {
+	const name = "binlog file"
+	pos := c.startPosition()
+	if pos.GTID != "" {
+		return passed(name, "sync by GTID \"%s\", skipped", pos.GTID)
+	} else if pos.File == "" {
+		return passed(name, "no binlog position, start with mysqldump, skipped")
+	}
+
+	logs, err := c.Mysql.BinaryLogs()
+	if err != nil {
+		return failed(name, "", "show binary logs error: %s", err.Error())
+	}
+
+	for _, log := range logs {
+		if log.Name == pos.File {
+			if uint64(pos.Position) > log.Size {
+				return failed(name, "fix the position with \"dm position set\"", "position %d exceeds the size %d of \"%s\"", pos.Position, log.Size, pos.File)
+			}
+			return passed(name, "\"%s\" exists", pos.String())
+		}
+	}
+
+	var first string
+	if len(logs) > 0 {
+		first = logs[0].Name
+	}
+	return failed(name, "the binlog was purged, reset the position with \"dm position set\" (the earliest file is \""+first+"\")", "\"%s\" not found in SHOW BINARY LOGS", pos.File)
+}
+
+func (c *Checker) checkServerID() Result {
+	const name = "server_id"
+	const hint = "change \"mysql.server_id\" to a unique value in the replication topology"
+	serverID := c.Settings.MySqlOptions.ServerID
+
+	masterID, err := c.Mysql.Variable("server_id")
+	if err != nil {
+		return failed(name, "", "read variable error: %s", err.Error())
+	} else if masterID == strconv.FormatUint(uint64(serverID), 10) {
+		return failed(name, hint, "%d is the same as the server_id of MySQL", serverID)
+	}
+
+	ids, err := c.Mysql.ReplicaServerIDs()
+	if err != nil {
+		return failed(name, "", "show replicas error: %s", err.Error())
+	}
+	for _, id := range ids {
+		if id == serverID {
+			return failed(name, hint+", or stop the other dm process", "%d is used by another replica", serverID)
+		}
+	}
+
+	return passed(name, "%d", serverID)
+}
+
+func (c *Checker) checkRules() []Result {
+	tables, err := c.tableNames()
+	if err != nil {
+		return []Result{failed("rules", "", "read tables error: %s", err.Error())}
+	}
+
+	var results []Result
+	for _, rule := range c.Settings.TaskOptions.Rules {
+		name := "rule " + rule.Key()
+		var n int
+		for _, table := range tables {
+			if rule.Match(table) {
+				n++
+			}
+		}
+		if n > 0 {
+			results = append(results, passed(name, "matches %d tables", n))
+		} else {
+			results = append(results, failed(name, "check \"schema\"/\"table\" of the rule, they are regular expressions", "matches no table"))
+		}
+	}
+	return results
+}
+
+func (c *Checker) startPosition() common.BinLogPosition {
+	if c.Storage != nil {
+		return c.Storage.GetLatestBinLogPosition(c.Settings.TaskOptions.BinLog)
+	}
+	return c.Settings.TaskOptions.BinLog
+}
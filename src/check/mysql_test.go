@@ -0,0 +1,174 @@
+package check
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/mysql"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"strings"
+	"testing"
+)
+
+func newTestChecker(t *testing.T, rules ...[2]string) (*Checker, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := &settings.Settings{}
+	for _, rule := range rules {
+		s.TaskOptions.Rules = append(s.TaskOptions.Rules, &settings.RuleOptions{Schema: rule[0], Table: rule[1], Call: "Consumer"})
+	}
+	if err = s.TaskOptions.Initial(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewChecker(&component.Components{
+		Settings: s,
+		Logger:   l,
+		Mysql:    mysql.NewMySqlWithDB(s, l, sqlx.NewDb(db, "mysql")),
+	}), mock
+}
+
+// expectTables 与MySQL返回的列名相同
+func expectTables(mock sqlmock.Sqlmock, tables ...[2]string) {
+	rows := sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME"})
+	for _, table := range tables {
+		rows.AddRow(table[0], table[1])
+	}
+	mock.ExpectQuery("FROM `INFORMATION_SCHEMA`.`TABLES`").WillReturnRows(rows)
+}
+
+func TestCheckRules(t *testing.T) {
+	c, mock := newTestChecker(t, [2]string{"test_db", "users"}, [2]string{"test_db", "(orders|users)"}, [2]string{"missing_db", ".*"})
+	expectTables(mock, [2]string{"test_db", "users"}, [2]string{"test_db", "orders"}, [2]string{"other_db", "logs"})
+
+	results := c.checkRules()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", results)
+	}
+	for i, expected := range []struct {
+		passed  bool
+		message string
+	}{
+		{true, "matches 1 tables"},
+		{true, "matches 2 tables"},
+		{false, "matches no table"},
+	} {
+		if results[i].Passed != expected.passed || results[i].Message != expected.message {
+			t.Errorf("rule %d: expected %v \"%s\", got %v \"%s\"", i, expected.passed, expected.message, results[i].Passed, results[i].Message)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckGrants(t *testing.T) {
+	tables := [][2]string{{"test_db", "users"}, {"test_db", "orders"}, {"other_db", "logs"}, {"other_db", "secrets"}}
+
+	for _, c := range []struct {
+		name    string
+		grants  []string
+		passed  bool
+		missing []string
+	}{
+		{
+			name:   "global",
+			grants: []string{"GRANT SELECT, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `dm`@`%`"},
+			passed: true,
+		},
+		{
+			name: "database and table level",
+			grants: []string{
+				"GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `dm`@`%`",
+				"GRANT SELECT ON `test\\_db`.* TO `dm`@`%`",
+				"GRANT SELECT, INSERT ON `other_db`.`logs` TO `dm`@`%`",
+			},
+			passed:  false,
+			missing: []string{"SELECT ON other_db.secrets"},
+		},
+		{
+			name: "wildcard database",
+			grants: []string{
+				"GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `dm`@`%`",
+				"GRANT SELECT ON `%\\_db`.* TO `dm`@`%`",
+			},
+			passed: true,
+		},
+		{
+			name:    "no replication",
+			grants:  []string{"GRANT SELECT ON `test_db`.* TO `dm`@`%`", "GRANT SELECT ON `other_db`.* TO `dm`@`%`"},
+			passed:  false,
+			missing: []string{"REPLICATION SLAVE ON *.*", "REPLICATION CLIENT ON *.*"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			checker, mock := newTestChecker(t, [2]string{"test_db", ".*"}, [2]string{"other_db", "(logs|secrets)"})
+			rows := sqlmock.NewRows([]string{"Grants for dm@%"})
+			for _, grant := range c.grants {
+				rows.AddRow(grant)
+			}
+			mock.ExpectQuery("SHOW GRANTS").WillReturnRows(rows)
+			if !strings.Contains(c.grants[0], "SELECT, REPLICATION") {
+				expectTables(mock, tables...)
+			}
+
+			result := checker.checkGrants()
+			if result.Passed != c.passed {
+				t.Fatalf("expected passed=%v, got %v: %s", c.passed, result.Passed, result.Message)
+			}
+			for _, missing := range c.missing {
+				if !strings.Contains(result.Message, missing) {
+					t.Errorf("expected \"%s\" in \"%s\"", missing, result.Message)
+				}
+			}
+			if strings.Contains(result.Message, "other_db.logs") || strings.Contains(result.Message, "test_db.") {
+				t.Errorf("granted tables are reported: %s", result.Message)
+			}
+		})
+	}
+}
+
+func TestCheckBinlogFile(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		position common.BinLogPosition
+		logs     [][2]any
+		passed   bool
+	}{
+		// 没有binlog位置时从mysqldump开始，不查询binlog
+		{"empty", common.BinLogPosition{}, nil, true},
+		{"exists", common.BinLogPosition{File: "mysql-bin.000002", Position: 4}, [][2]any{{"mysql-bin.000001", 100}, {"mysql-bin.000002", 200}}, true},
+		{"exceeds", common.BinLogPosition{File: "mysql-bin.000002", Position: 300}, [][2]any{{"mysql-bin.000002", 200}}, false},
+		{"purged", common.BinLogPosition{File: "mysql-bin.000001", Position: 4}, [][2]any{{"mysql-bin.000002", 200}}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			checker, mock := newTestChecker(t)
+			checker.Settings.TaskOptions.BinLog = c.position
+			if c.logs != nil {
+				rows := sqlmock.NewRows([]string{"Log_name", "File_size"})
+				for _, log := range c.logs {
+					rows.AddRow(log[0], log[1])
+				}
+				mock.ExpectQuery("SHOW BINARY LOGS").WillReturnRows(rows)
+			}
+
+			result := checker.checkBinlogFile()
+			if result.Passed != c.passed {
+				t.Errorf("expected passed=%v, got %v: %s", c.passed, result.Passed, result.Message)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
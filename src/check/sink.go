@@ -0,0 +1,52 @@
+package check
+
+import (
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/dm.v1/src/sink"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkSinks 检查rules中的sink都已注册
+func (c *Checker) checkSinks() []Result {
+	var results []Result
+	names := sink.Names()
+	for _, rule := range c.Settings.TaskOptions.Rules {
+		if rule.IsProcess() {
+			results = append(results, c.checkProcess(rule))
+			continue
+		} else if rule.Sink == "" {
+			continue
+		}
+
+		name := "sink of rule " + rule.Key()
+		if _, err := sink.New(rule.Sink); err != nil {
+			results = append(results, failed(name, "registered sinks: "+strings.Join(names, ", "), "sink \"%s\" is not registered", rule.Sink))
+		} else {
+			results = append(results, passed(name, "%s", rule.Sink))
+		}
+	}
+	return results
+}
+
+// checkProcess 检查外部进程的命令可以执行，相对路径基于script_dir
+func (c *Checker) checkProcess(rule *settings.RuleOptions) Result {
+	name := "process of rule " + rule.Key()
+	command, err := rule.Command()
+	if err != nil {
+		return failed(name, "quote the arguments like a shell, e.g. \"process:python3 'my consumer.py'\"", "%s", err.Error())
+	} else if len(command) <= 0 {
+		return failed(name, "e.g. \"process:python3 consumer.py\"", "empty command")
+	}
+
+	path := command[0]
+	if strings.ContainsRune(path, filepath.Separator) && !filepath.IsAbs(path) {
+		path = filepath.Join(c.Settings.TaskOptions.ScriptDir, path)
+	}
+	found, err := exec.LookPath(path)
+	if err != nil {
+		return failed(name, "install it or check the PATH", "%s", err.Error())
+	}
+	return passed(name, "%s", found)
+}
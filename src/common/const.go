@@ -13,5 +13,12 @@ const BoltFilename = "data.db"
 
 const StorageTables = "tables"
 const StorageEvents = "events"
+const StorageDeadLetters = "dead_letters"
 
 const LogCanalFilename = "canal.log"
+
+// IgopPrefix rule的call中可选的前缀，比如 "igop:Consumer"
+const IgopPrefix = "igop:"
+
+// ProcessPrefix rule的call使用外部进程，比如 "process:python3 consumer.py"
+const ProcessPrefix = "process:"
@@ -1,9 +1,11 @@
 package common
 
 import (
+	"fmt"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/schema"
 	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"time"
 )
 
 type Table struct {
@@ -65,15 +67,21 @@ func (c Columns) Names() []string {
 }
 
 type BinLogPosition struct {
-	File     string `yaml:"file" validate:"min=8"`
-	Position uint32 `yaml:"position" validate:"min=0"`
+	File     string `yaml:"file" json:"file" validate:"required_without=GTID,omitempty,min=8"`
+	Position uint32 `yaml:"position" json:"position" validate:"min=0"`
+	// GTID 不为空时，优先使用GTID同步
+	GTID string `yaml:"gtid,omitempty" json:"gtid,omitempty"`
 }
 
-func NewBinLogPositions(pos mysql.Position) BinLogPosition {
-	return BinLogPosition{
+func NewBinLogPositions(pos mysql.Position, gtid mysql.GTIDSet) BinLogPosition {
+	p := BinLogPosition{
 		File:     pos.Name,
 		Position: pos.Pos,
 	}
+	if gtid != nil {
+		p.GTID = gtid.String()
+	}
+	return p
 }
 
 func (p BinLogPosition) GreaterThan(p1 BinLogPosition) bool {
@@ -87,8 +95,53 @@ func (p BinLogPosition) ToMysqlPos() mysql.Position {
 	}
 }
 
+func (p BinLogPosition) ToGTIDSet(flavor string) (mysql.GTIDSet, error) {
+	return mysql.ParseGTIDSet(flavor, p.GTID)
+}
+
 func (p BinLogPosition) IsEmpty() bool {
-	return p.File == "" && p.Position == 0
+	return p.File == "" && p.Position == 0 && p.GTID == ""
+}
+
+func (p BinLogPosition) String() string {
+	if p.GTID != "" {
+		return fmt.Sprintf("%s:%d (gtid: %s)", p.File, p.Position, p.GTID)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Position)
+}
+
+// EventMeta event在binlog中的位置和提交时间，mysqldump的行没有这些信息
+type EventMeta struct {
+	LogName string
+	// 所在binlog事件结束的位置
+	LogPos uint32
+	// binlog事件的时间戳（秒）
+	Timestamp uint32
+	// mysqldump的快照行
+	Snapshot bool
+	// 事务中第一个行事件结束的位置，同一事务中的行相同；
+	// canal无法获取InnoDB的事务ID，用于maxwell的xid等标识事务
+	TxnPos uint32
+}
+
+func (m EventMeta) IsEmpty() bool {
+	return m.LogName == "" && m.LogPos == 0
+}
+
+// Position "文件:位置"，为空时返回空字符串
+func (m EventMeta) Position() string {
+	if m.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", m.LogName, m.LogPos)
+}
+
+// CommitTime 为空时返回零值
+func (m EventMeta) CommitTime() time.Time {
+	if m.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.Timestamp), 0)
 }
 
 func ToRowMap(cols []any, columns []schema.TableColumn) map[string]any {
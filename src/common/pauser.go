@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// Pauser 可暂停的开关，暂停时调用 Wait 会阻塞，直到恢复或者ctx结束
+type Pauser struct {
+	mu     sync.Mutex
+	resume chan struct{}
+}
+
+func NewPauser() *Pauser {
+	return &Pauser{}
+}
+
+// Pause 暂停，如果已经是暂停状态则返回false
+func (p *Pauser) Pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resume != nil {
+		return false
+	}
+	p.resume = make(chan struct{})
+	return true
+}
+
+// Resume 恢复，如果不是暂停状态则返回false
+func (p *Pauser) Resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resume == nil {
+		return false
+	}
+	close(p.resume)
+	p.resume = nil
+	return true
+}
+
+func (p *Pauser) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resume != nil
+}
+
+// Wait 非暂停状态时立即返回，否则阻塞到恢复或者ctx结束
+func (p *Pauser) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	resume := p.resume
+	p.mu.Unlock()
+
+	if resume == nil {
+		return nil
+	}
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
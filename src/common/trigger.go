@@ -13,6 +13,8 @@ type Trigger struct {
 	maxWait      time.Duration
 	maxCount     uint64
 	currentCount atomic.Uint64
+	// 下一次触发时忽略数量和时间的条件
+	force atomic.Bool
 
 	triggerCallback func(uint64)
 
@@ -64,7 +66,8 @@ func (t *Trigger) Run(ctx context.Context) {
 		select {
 		case <-t.queue:
 			count := t.currentCount.Load()
-			if count > 0 && (count >= t.maxCount || time.Since(t.lastTrigger) >= t.maxWait) {
+			force := t.force.Swap(false)
+			if count > 0 && (force || count >= t.maxCount || time.Since(t.lastTrigger) >= t.maxWait) {
 				t.lastTrigger = time.Now()
 				t.triggerCallback(t.lastID.Add(1))
 			}
@@ -83,6 +86,12 @@ func (t *Trigger) addQueue() {
 	}
 }
 
+// Fire 立即触发一次任务，忽略数量阈值和等待时间（数量为0时依然不会触发）
+func (t *Trigger) Fire() {
+	t.force.Store(true)
+	t.addQueue()
+}
+
 // OnCountChanged count的任何一次修改，都需要调用本函数
 func (t *Trigger) OnCountChanged(count uint64) {
 	old := t.currentCount.Swap(count)
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// FileWatcher 定时检查文件（或目录中所有文件）的修改时间和大小
+//
+//	文件有变化，并且在下一个检查周期内没有再变化时（避免读取到写了一半的文件），才会触发callback
+type FileWatcher struct {
+	paths    []string
+	interval time.Duration
+	callback func()
+
+	snapshot map[string]fileStat
+}
+
+func NewFileWatcher(interval time.Duration, callback func(), paths ...string) *FileWatcher {
+	w := &FileWatcher{
+		paths:    paths,
+		interval: interval,
+		callback: callback,
+	}
+	w.snapshot = w.stat()
+	return w
+}
+
+// Run 阻塞运行，直到ctx结束
+func (w *FileWatcher) Run(ctx context.Context) {
+	tick := time.NewTicker(w.interval)
+	defer tick.Stop()
+
+	changed := false
+	for {
+		select {
+		case <-tick.C:
+			snapshot := w.stat()
+			if !isSameSnapshot(w.snapshot, snapshot) {
+				w.snapshot = snapshot
+				changed = true
+			} else if changed {
+				changed = false
+				w.callback()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *FileWatcher) stat() map[string]fileStat {
+	snapshot := map[string]fileStat{}
+	for _, path := range w.paths {
+		_ = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := os.Stat(p); err == nil {
+				snapshot[p] = fileStat{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return snapshot
+}
+
+func isSameSnapshot(s1, s2 map[string]fileStat) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for k, v1 := range s1 {
+		if v2, ok := s2[k]; !ok || !v1.modTime.Equal(v2.modTime) || v1.size != v2.size {
+			return false
+		}
+	}
+	return true
+}
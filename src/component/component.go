@@ -3,6 +3,7 @@ package component
 import (
 	"go.uber.org/multierr"
 	"gopkg.in/go-mixed/dm.v1/src/mysql"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
 	"gopkg.in/go-mixed/dm.v1/src/settings"
 	"gopkg.in/go-mixed/dm.v1/src/storage"
 	"gopkg.in/go-mixed/dm.v1/src/target"
@@ -16,6 +17,8 @@ type Components struct {
 	Mysql   *mysql.MySql
 	Target  *target.Target
 	Storage *storage.Storage
+	// 没有启用schema_registry时为nil
+	Registry *registry.Registry
 }
 
 func (c *Components) Close() error {
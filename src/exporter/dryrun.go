@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DryRun 记录脚本对Redis/Etcd的写入，但不执行，读取不受影响
+type DryRun struct {
+	logger *logger.Logger
+
+	lock  sync.Mutex
+	scope string
+	// scope -> "redis Set" -> count
+	writes map[string]map[string]uint64
+}
+
+func NewDryRun(logger *logger.Logger) *DryRun {
+	return &DryRun{
+		logger: logger,
+		writes: map[string]map[string]uint64{},
+	}
+}
+
+// SetScope 设置之后的写入归属的rule
+func (d *DryRun) SetScope(scope string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.scope = scope
+}
+
+func (d *DryRun) record(target, op, key string, val any) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ops, ok := d.writes[d.scope]
+	if !ok {
+		ops = map[string]uint64{}
+		d.writes[d.scope] = ops
+	}
+	ops[target+" "+op]++
+
+	fields := []zap.Field{zap.String("rule", d.scope), zap.String("target", target), zap.String("key", key)}
+	if val != nil {
+		fields = append(fields, zap.String("value", text_utils.ToString(val, true)))
+	}
+	d.logger.Info("[DryRun]"+op, fields...)
+}
+
+// Skip 记录一次未执行的Sink写入
+func (d *DryRun) Skip(sink string, count int) {
+	d.record(sink, "Write", fmt.Sprintf("%d events", count), nil)
+}
+
+// Summary 每一个rule的写入次数
+func (d *DryRun) Summary() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.writes) <= 0 {
+		return "no writes"
+	}
+
+	var scopes []string
+	for scope := range d.writes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	var lines []string
+	for _, scope := range scopes {
+		var ops []string
+		for op, count := range d.writes[scope] {
+			ops = append(ops, fmt.Sprintf("%s=%d", op, count))
+		}
+		sort.Strings(ops)
+		lines = append(lines, fmt.Sprintf("%s: %s", scope, strings.Join(ops, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Wrap 包装一个 consumer.ICache，Set/SetNoExpiration/Del只记录不执行
+func (d *DryRun) Wrap(target string, cache consumer.ICache) consumer.ICache {
+	return &dryRunCache{ICache: cache, target: target, dryRun: d}
+}
+
+type dryRunCache struct {
+	consumer.ICache
+	target string
+	dryRun *DryRun
+}
+
+func (c *dryRunCache) Set(key string, val any, expiration time.Duration) error {
+	c.dryRun.record(c.target, "Set", key, val)
+	return nil
+}
+
+func (c *dryRunCache) SetNoExpiration(key string, val any) error {
+	c.dryRun.record(c.target, "Set", key, val)
+	return nil
+}
+
+func (c *dryRunCache) Del(key string) error {
+	c.dryRun.record(c.target, "Del", key, nil)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"go.uber.org/zap"
 	"go/constant"
 	"gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
 	cache "gopkg.in/go-mixed/go-common.v1/cache.v1"
 	"gopkg.in/go-mixed/go-common.v1/logger.v1"
 	"gopkg.in/go-mixed/go-common.v1/utils/conv"
@@ -15,16 +16,37 @@ import (
 qexp -outdir . -filename export github.com/fly-studio/dm/src/consumer/conv
 */
 
+var dryRun *DryRun
+
+// SetDryRun 需要在SetRedis/SetEtcd之前调用，之后脚本的写入只会被记录
+func SetDryRun(d *DryRun) {
+	dryRun = d
+}
+
 func SetRedis(redis cache.ICache) {
 	consumer.Redis = ToConsumerICache(redis)
+	if dryRun != nil {
+		consumer.Redis = dryRun.Wrap("redis", consumer.Redis)
+	}
 }
 func SetEtcd(etcd cache.ICache) {
 	consumer.Etcd = ToConsumerICache(etcd)
+	if dryRun != nil {
+		consumer.Etcd = dryRun.Wrap("etcd", consumer.Etcd)
+	}
 }
 func SetLogger(logger *logger.Logger) {
 	consumer.Logger = ToConsumerILogger(logger.With(zap.String("scope", "script")).Sugar())
 }
 
+// SetConsumerFakes 直接替换脚本中的Redis/Etcd/Logger，用于在内存中测试脚本
+func SetConsumerFakes(redis, etcd consumer.ICache, logger consumer.ILogger) {
+	consumer.Redis = redis
+	consumer.Etcd = etcd
+	consumer.Logger = logger
+	consumer.GetTableFn = func(string) *consumer.Table { return nil }
+}
+
 func Export() {
 	igop.RegisterPackage(&igop.Package{
 		Name: "consumer",
@@ -118,4 +140,46 @@ func Export() {
 		TypedConsts:   map[string]igop.TypedConst{},
 		UntypedConsts: map[string]igop.UntypedConst{},
 	})
+
+	igop.RegisterPackage(&igop.Package{
+		Name: "format",
+		Path: "gopkg.in/go-mixed/dm.v1/src/format",
+		Deps: map[string]string{
+			"gopkg.in/go-mixed/dm-consumer.v1": "consumer",
+			"time":                             "time",
+		},
+		Interfaces: map[string]reflect.Type{
+			"Serializer": reflect.TypeOf((*format.Serializer)(nil)).Elem(),
+		},
+		NamedTypes: map[string]reflect.Type{
+			"Options":          reflect.TypeOf((*format.Options)(nil)).Elem(),
+			"EventMessage":     reflect.TypeOf((*format.EventMessage)(nil)).Elem(),
+			"Debezium":         reflect.TypeOf((*format.Debezium)(nil)).Elem(),
+			"DebeziumEnvelope": reflect.TypeOf((*format.DebeziumEnvelope)(nil)).Elem(),
+			"DebeziumPayload":  reflect.TypeOf((*format.DebeziumPayload)(nil)).Elem(),
+			"DebeziumSource":   reflect.TypeOf((*format.DebeziumSource)(nil)).Elem(),
+			"DebeziumField":    reflect.TypeOf((*format.DebeziumField)(nil)).Elem(),
+			"CanalJson":        reflect.TypeOf((*format.CanalJson)(nil)).Elem(),
+			"CanalMessage":     reflect.TypeOf((*format.CanalMessage)(nil)).Elem(),
+			"Maxwell":          reflect.TypeOf((*format.Maxwell)(nil)).Elem(),
+			"MaxwellMessage":   reflect.TypeOf((*format.MaxwellMessage)(nil)).Elem(),
+		},
+		AliasTypes: map[string]reflect.Type{
+			"EventMeta": reflect.TypeOf((*format.EventMeta)(nil)).Elem(),
+		},
+		Vars: map[string]reflect.Value{},
+		Funcs: map[string]reflect.Value{
+			"New":              reflect.ValueOf(format.New),
+			"Names":            reflect.ValueOf(format.Names),
+			"DefaultOptions":   reflect.ValueOf(format.DefaultOptions),
+			"NewDebezium":      reflect.ValueOf(format.NewDebezium),
+			"NewCanalJson":     reflect.ValueOf(format.NewCanalJson),
+			"NewMaxwell":       reflect.ValueOf(format.NewMaxwell),
+			"CanalSQLType":     reflect.ValueOf(format.CanalSQLType),
+			"NewEventMessage":  reflect.ValueOf(format.NewEventMessage),
+			"NewEventMessages": reflect.ValueOf(format.NewEventMessages),
+		},
+		TypedConsts:   map[string]igop.TypedConst{},
+		UntypedConsts: map[string]igop.UntypedConst{},
+	})
 }
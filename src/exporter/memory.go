@@ -0,0 +1,256 @@
+package exporter
+
+import (
+	"fmt"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCache 内存中的 consumer.ICache，用于在没有Redis/Etcd时测试脚本
+//
+//	值的序列化方式与Redis/Etcd相同：标量转为字符串，其它类型转为JSON
+type MemoryCache struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+var _ consumer.ICache = (*MemoryCache)(nil)
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{data: map[string][]byte{}}
+}
+
+// Reset 清空并写入初始的KV
+func (c *MemoryCache) Reset(kvs map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.data = map[string][]byte{}
+	for k, v := range kvs {
+		c.data[k] = []byte(v)
+	}
+}
+
+// Dump 返回当前所有的KV
+func (c *MemoryCache) Dump() map[string]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	kvs := make(map[string]string, len(c.data))
+	for k, v := range c.data {
+		kvs[k] = string(v)
+	}
+	return kvs
+}
+
+func (c *MemoryCache) sortedKeys() []string {
+	keys := make([]string, 0, len(c.data))
+	for k := range c.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unmarshalKVs(kvs consumer.KVs, actual any) error {
+	if core.IsInterfaceNil(actual) || len(kvs) <= 0 {
+		return nil
+	}
+	var values [][]byte
+	for _, kv := range kvs {
+		values = append(values, kv.Value)
+	}
+	return text_utils.JsonListUnmarshalFromBytes(values, actual)
+}
+
+func (c *MemoryCache) Get(key string, actual any) ([]byte, error) {
+	c.lock.RLock()
+	val, ok := c.data[key]
+	c.lock.RUnlock()
+
+	if !ok || len(val) == 0 {
+		return nil, nil
+	}
+	if !core.IsInterfaceNil(actual) {
+		if err := text_utils.JsonUnmarshalFromBytes(val, actual); err != nil {
+			return val, err
+		}
+	}
+	return val, nil
+}
+
+func (c *MemoryCache) MGet(keys []string, actual any) (consumer.KVs, error) {
+	c.lock.RLock()
+	var kvs consumer.KVs
+	for _, key := range keys {
+		if val, ok := c.data[key]; ok {
+			kvs = append(kvs, &consumer.KV{Key: key, Value: val})
+		}
+	}
+	c.lock.RUnlock()
+
+	return kvs, unmarshalKVs(kvs, actual)
+}
+
+func (c *MemoryCache) Keys(keyPrefix string) ([]string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var keys []string
+	for _, k := range c.sortedKeys() {
+		if strings.HasPrefix(k, keyPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (c *MemoryCache) Range(keyStart, keyEnd string, keyPrefix string, limit int64) (string, consumer.KVs, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var kvs consumer.KVs
+	for _, k := range c.sortedKeys() {
+		if k < keyStart || (keyEnd != "" && k > keyEnd) || !strings.HasPrefix(k, keyPrefix) {
+			continue
+		}
+		if limit > 0 && int64(len(kvs)) >= limit {
+			return k, kvs, nil
+		}
+		kvs = append(kvs, &consumer.KV{Key: k, Value: c.data[k]})
+	}
+	return "", kvs, nil
+}
+
+func (c *MemoryCache) ScanPrefix(keyPrefix string, actual any) (consumer.KVs, error) {
+	_, kvs, err := c.Range("", "", keyPrefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	return kvs, unmarshalKVs(kvs, actual)
+}
+
+func (c *MemoryCache) ScanPrefixCallback(keyPrefix string, callback func(kv *consumer.KV) error) (int64, error) {
+	_, kvs, _ := c.Range("", "", keyPrefix, 0)
+
+	var read int64
+	for _, kv := range kvs {
+		read++
+		if err := callback(kv); err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (c *MemoryCache) ScanRange(keyStart, keyEnd string, keyPrefix string, limit int64, actual any) (string, consumer.KVs, error) {
+	nextKey, kvs, err := c.Range(keyStart, keyEnd, keyPrefix, limit)
+	if err != nil {
+		return nextKey, kvs, err
+	}
+	return nextKey, kvs, unmarshalKVs(kvs, actual)
+}
+
+func (c *MemoryCache) ScanRangeCallback(keyStart, keyEnd string, keyPrefix string, limit int64, callback func(kv *consumer.KV) error) (string, int64, error) {
+	nextKey, kvs, _ := c.Range(keyStart, keyEnd, keyPrefix, limit)
+
+	var read int64
+	for _, kv := range kvs {
+		read++
+		if err := callback(kv); err != nil {
+			return kv.Key, read, err
+		}
+	}
+	return nextKey, read, nil
+}
+
+// Set 内存中不处理过期时间
+func (c *MemoryCache) Set(key string, val any, expiration time.Duration) error {
+	return c.SetNoExpiration(key, val)
+}
+
+func (c *MemoryCache) SetNoExpiration(key string, val any) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.data[key] = []byte(text_utils.ToString(val, true))
+	return nil
+}
+
+func (c *MemoryCache) Del(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.data, key)
+	return nil
+}
+
+// MemoryLogger 将日志记录在内存中的 consumer.ILogger
+type MemoryLogger struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+var _ consumer.ILogger = (*MemoryLogger)(nil)
+
+func NewMemoryLogger() *MemoryLogger {
+	return &MemoryLogger{}
+}
+
+// Reset 清空记录的日志
+func (l *MemoryLogger) Reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = nil
+}
+
+// Lines 返回记录的日志，格式为 "LEVEL message"
+func (l *MemoryLogger) Lines() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func (l *MemoryLogger) log(level string, msg string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = append(l.lines, level+" "+strings.TrimRight(msg, "\n"))
+}
+
+func (l *MemoryLogger) Fatal(v ...any) {
+	l.log("FATAL", fmt.Sprint(v...))
+	panic(fmt.Sprint(v...))
+}
+func (l *MemoryLogger) Fatalf(format string, v ...any) {
+	l.log("FATAL", fmt.Sprintf(format, v...))
+	panic(fmt.Sprintf(format, v...))
+}
+func (l *MemoryLogger) Error(v ...any) { l.log("ERROR", fmt.Sprint(v...)) }
+func (l *MemoryLogger) Errorf(format string, v ...any) {
+	l.log("ERROR", fmt.Sprintf(format, v...))
+}
+func (l *MemoryLogger) Panic(v ...any) {
+	l.log("PANIC", fmt.Sprint(v...))
+	panic(fmt.Sprint(v...))
+}
+func (l *MemoryLogger) Panicf(format string, v ...any) {
+	l.log("PANIC", fmt.Sprintf(format, v...))
+	panic(fmt.Sprintf(format, v...))
+}
+func (l *MemoryLogger) Debug(v ...any) { l.log("DEBUG", fmt.Sprint(v...)) }
+func (l *MemoryLogger) Debugf(format string, v ...any) {
+	l.log("DEBUG", fmt.Sprintf(format, v...))
+}
+func (l *MemoryLogger) Info(v ...any) { l.log("INFO", fmt.Sprint(v...)) }
+func (l *MemoryLogger) Infof(format string, v ...any) {
+	l.log("INFO", fmt.Sprintf(format, v...))
+}
+func (l *MemoryLogger) Warn(v ...any) { l.log("WARN", fmt.Sprint(v...)) }
+func (l *MemoryLogger) Warnf(format string, v ...any) {
+	l.log("WARN", fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,136 @@
+package format
+
+import (
+	"encoding/binary"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"math"
+	"time"
+)
+
+// Avro 使用schema_registry中的版本编码为Avro的二进制，头部为Confluent格式的schema id，
+// schema参见 registry.RecordSchema.Avro
+type Avro struct {
+	options Options
+}
+
+func init() {
+	Register("avro", func(options Options) (Serializer, error) { return NewAvro(options), nil })
+}
+
+func NewAvro(options Options) *Avro {
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	return &Avro{options: options}
+}
+
+func (a *Avro) ContentType() string {
+	return "avro/binary"
+}
+
+func (a *Avro) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	table, s, err := recordSchema(a.options.Registry, event)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &avroWriter{buf: confluentHeader(s.ID)}
+	w.long(int64(event.ID))
+	w.string(event.Action)
+	// before、after
+	for _, row := range beforeAfter(event) {
+		if row == nil {
+			w.long(0)
+			continue
+		}
+		w.long(1)
+		a.row(w, table, s, row)
+	}
+
+	if len(event.DiffCols) > 0 {
+		w.long(int64(len(event.DiffCols)))
+		for _, col := range event.DiffCols {
+			w.string(col)
+		}
+	}
+	w.long(0)
+
+	w.string(meta.Position())
+	if meta.Timestamp > 0 {
+		w.long(1)
+		w.long(meta.CommitTime().UnixMilli())
+	} else {
+		w.long(0)
+	}
+	w.boolean(meta.Snapshot)
+	return w.buf, nil
+}
+
+// row Row中的字段均为 ["null", T]
+func (a *Avro) row(w *avroWriter, table *consumer.Table, s *registry.RecordSchema, row map[string]any) {
+	for i, field := range s.Fields {
+		column := table.Columns[i]
+		v, ok := recordValue(field, column, row[column.Name], a.options.Location)
+		if ok && field.Avro.LogicalType == "decimal" {
+			v = DecimalBytes(recordDecimal(v), field.Avro.Scale)
+			ok = v.([]byte) != nil
+		}
+		if !ok {
+			w.long(0)
+			continue
+		}
+		w.long(1)
+
+		switch field.Avro.Type {
+		case "int", "long":
+			w.long(recordInt64(v))
+		case "float":
+			w.float(v.(float32))
+		case "double":
+			w.double(v.(float64))
+		case "boolean":
+			w.boolean(v.(bool))
+		case "bytes":
+			w.bytes(v.([]byte))
+		default:
+			w.string(v.(string))
+		}
+	}
+}
+
+// avroWriter Avro的二进制编码
+type avroWriter struct {
+	buf []byte
+}
+
+// long int和long均为zigzag的varint
+func (w *avroWriter) long(v int64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1)^uint64(v>>63))
+}
+
+func (w *avroWriter) float(v float32) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v))
+}
+
+func (w *avroWriter) double(v float64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *avroWriter) boolean(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *avroWriter) bytes(v []byte) {
+	w.long(int64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *avroWriter) string(v string) {
+	w.long(int64(len(v)))
+	w.buf = append(w.buf, v...)
+}
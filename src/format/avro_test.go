@@ -0,0 +1,230 @@
+package format
+
+import (
+	"encoding/binary"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T) *registry.Registry {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := registry.NewRegistry(settings.SchemaRegistryOptions{Enabled: true, Dir: t.TempDir(), Compatibility: registry.CompatibilityBackward}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// setRecordTable 各种类型的列，返回这个表结构
+func setRecordTable(columns ...consumer.TableColumn) *consumer.Table {
+	if len(columns) <= 0 {
+		columns = []consumer.TableColumn{
+			{Name: "id", Type: consumer.TYPE_NUMBER, RawType: "int(11)"},
+			{Name: "big", Type: consumer.TYPE_NUMBER, RawType: "bigint(20) unsigned", IsUnsigned: true},
+			{Name: "name", Type: consumer.TYPE_STRING, RawType: "varchar(20)"},
+			{Name: "amount", Type: consumer.TYPE_DECIMAL, RawType: "decimal(10,2)"},
+			{Name: "ratio", Type: consumer.TYPE_FLOAT, RawType: "double"},
+			{Name: "flag", Type: consumer.TYPE_BIT, RawType: "bit(1)"},
+			{Name: "created_at", Type: consumer.TYPE_DATETIME, RawType: "datetime"},
+			{Name: "data", Type: consumer.TYPE_STRING, RawType: "blob"},
+		}
+	}
+	table := &consumer.Table{Schema: "test_db", Name: "users", Columns: columns}
+	consumer.GetTableFn = func(string) *consumer.Table { return table }
+	return table
+}
+
+func testRecordEvent() (consumer.RowEvent, EventMeta) {
+	before := map[string]any{"id": int32(-1), "big": uint64(math.MaxUint64), "name": "a", "amount": 12.5, "ratio": 0.25, "flag": int64(1), "created_at": "2020-09-13 12:26:40", "data": []byte{0, 1}}
+	after := map[string]any{"id": int32(-1), "big": uint64(math.MaxUint64), "name": nil, "amount": 12.5, "ratio": 0.25, "flag": int64(0), "created_at": "2020-09-13 12:26:40", "data": []byte{0, 1}}
+	event := consumer.RowEvent{ID: 7, Schema: "test_db", Table: "users", Action: "update", OldRow: before, NewRow: after, DiffCols: []string{"name", "flag"}}
+	return event, EventMeta{LogName: "mysql-bin.000001", LogPos: 1234, Timestamp: 1600000000}
+}
+
+// testRecordRow testRecordEvent中行的值：DECIMAL为字符串（Protobuf）或者非缩放的整数（Avro），DATETIME为微秒
+func testRecordRow(name any, flag bool) []any {
+	return []any{int64(-1), "18446744073709551615", name, "12.50", 0.25, flag, time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC).UnixMicro(), []byte{0, 1}}
+}
+
+// avroReader 测试中用于解码Avro的二进制，与avroWriter独立实现
+type avroReader struct {
+	buf []byte
+}
+
+func (r *avroReader) long(t *testing.T) int64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		t.Fatalf("invalid varint")
+	}
+	r.buf = r.buf[n:]
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *avroReader) fixed(t *testing.T, n int) []byte {
+	if len(r.buf) < n {
+		t.Fatalf("expected %d bytes, got %d", n, len(r.buf))
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *avroReader) bytes(t *testing.T) []byte {
+	return r.fixed(t, int(r.long(t)))
+}
+
+// row Row中的字段均为 ["null", T]，DECIMAL转为字符串
+func (r *avroReader) row(t *testing.T, s *registry.RecordSchema) []any {
+	var values []any
+	for _, f := range s.Fields {
+		if r.long(t) == 0 {
+			values = append(values, nil)
+			continue
+		}
+		switch {
+		case f.Avro.LogicalType == "decimal":
+			values = append(values, decimalText(r.bytes(t), f.Avro.Scale))
+		case f.Avro.Type == "int" || f.Avro.Type == "long":
+			values = append(values, r.long(t))
+		case f.Avro.Type == "float":
+			values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(r.fixed(t, 4))))
+		case f.Avro.Type == "double":
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(r.fixed(t, 8))))
+		case f.Avro.Type == "boolean":
+			values = append(values, r.fixed(t, 1)[0] == 1)
+		case f.Avro.Type == "bytes":
+			values = append(values, r.bytes(t))
+		default:
+			values = append(values, string(r.bytes(t)))
+		}
+	}
+	return values
+}
+
+// decimalText 大端序补码的非缩放整数转为十进制字符串
+func decimalText(b []byte, scale int) string {
+	v := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(scale)
+}
+
+// confluentSchema 检查头部并返回schema id对应的版本
+func confluentSchema(t *testing.T, r *registry.Registry, buf []byte) (*registry.RecordSchema, []byte) {
+	if len(buf) < 5 || buf[0] != confluentMagic {
+		t.Fatalf("invalid header %v", buf)
+	}
+	s := r.GetByID(binary.BigEndian.Uint32(buf[1:5]))
+	if s == nil {
+		t.Fatalf("schema %d not found", binary.BigEndian.Uint32(buf[1:5]))
+	}
+	return s, buf[5:]
+}
+
+func TestAvroMarshal(t *testing.T) {
+	setRecordTable()
+	r := newTestRegistry(t)
+	serializer, err := New("avro", Options{Registry: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, meta := testRecordEvent()
+	buf, err := serializer.Marshal(event, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, body := confluentSchema(t, r, buf)
+	reader := &avroReader{buf: body}
+	if id := reader.long(t); id != 7 {
+		t.Errorf("expected id 7, got %d", id)
+	}
+	if action := string(reader.bytes(t)); action != "update" {
+		t.Errorf("expected update, got %s", action)
+	}
+	for i, expected := range [][]any{testRecordRow("a", true), testRecordRow(nil, false)} {
+		if reader.long(t) != 1 {
+			t.Fatalf("row %d is null", i)
+		}
+		if row := reader.row(t, s); !reflect.DeepEqual(row, expected) {
+			t.Errorf("row %d: expected %v, got %v", i, expected, row)
+		}
+	}
+
+	var diffCols []string
+	for n := reader.long(t); n != 0; n = reader.long(t) {
+		for ; n > 0; n-- {
+			diffCols = append(diffCols, string(reader.bytes(t)))
+		}
+	}
+	if !reflect.DeepEqual(diffCols, event.DiffCols) {
+		t.Errorf("expected diff_cols %v, got %v", event.DiffCols, diffCols)
+	}
+	if position := string(reader.bytes(t)); position != "mysql-bin.000001:1234" {
+		t.Errorf("unexpected position %s", position)
+	}
+	if reader.long(t) != 1 || reader.long(t) != 1600000000000 {
+		t.Errorf("unexpected commit_time")
+	}
+	if snapshot := reader.fixed(t, 1)[0]; snapshot != 0 || len(reader.buf) != 0 {
+		t.Errorf("unexpected snapshot %d, %d bytes left", snapshot, len(reader.buf))
+	}
+}
+
+func TestAvroMarshalDelete(t *testing.T) {
+	setRecordTable()
+	r := newTestRegistry(t)
+	event, _ := testRecordEvent()
+	event.Action, event.NewRow, event.DiffCols = "delete", nil, nil
+	buf, err := NewAvro(Options{Registry: r}).Marshal(event, EventMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, body := confluentSchema(t, r, buf)
+	reader := &avroReader{buf: body}
+	reader.long(t)
+	reader.bytes(t)
+	if reader.long(t) != 1 {
+		t.Fatal("expected before")
+	}
+	reader.row(t, s)
+	// after为null，diff_cols为空，没有位置和时间
+	if after, diffCols, position, commitTime := reader.long(t), reader.long(t), reader.bytes(t), reader.long(t); after != 0 || diffCols != 0 || len(position) != 0 || commitTime != 0 {
+		t.Errorf("unexpected after %d, diff_cols %d, position %q, commit_time %d", after, diffCols, position, commitTime)
+	}
+}
+
+func TestRecordIncompatible(t *testing.T) {
+	r := newTestRegistry(t)
+	event, meta := testRecordEvent()
+	for _, name := range []string{"avro", "protobuf"} {
+		serializer, err := New(name, Options{Registry: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		setRecordTable()
+		if _, err = serializer.Marshal(event, meta); err != nil {
+			t.Fatal(err)
+		}
+
+		// id由int改为varchar，不是backward兼容的
+		table := setRecordTable()
+		columns := append([]consumer.TableColumn{{Name: "id", Type: consumer.TYPE_STRING, RawType: "varchar(20)"}}, table.Columns[1:]...)
+		setRecordTable(columns...)
+		if _, err = serializer.Marshal(event, meta); !registry.IsIncompatible(err) {
+			t.Errorf("%s: expected an IncompatibleError, got %v", name, err)
+		}
+	}
+}
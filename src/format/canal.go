@@ -0,0 +1,224 @@
+package format
+
+import (
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"strings"
+	"time"
+)
+
+// canalSQLTypes MySQL的类型对应的java.sql.Types，与阿里巴巴Canal相同
+var canalSQLTypes = map[string]int{
+	"tinyint":    -6,
+	"smallint":   5,
+	"mediumint":  4,
+	"int":        4,
+	"integer":    4,
+	"bigint":     -5,
+	"float":      7,
+	"double":     8,
+	"real":       8,
+	"decimal":    3,
+	"numeric":    3,
+	"bit":        -7,
+	"bool":       -6,
+	"boolean":    -6,
+	"char":       1,
+	"varchar":    12,
+	"tinytext":   2005,
+	"text":       2005,
+	"mediumtext": 2005,
+	"longtext":   2005,
+	"binary":     2004,
+	"varbinary":  2004,
+	"tinyblob":   2004,
+	"blob":       2004,
+	"mediumblob": 2004,
+	"longblob":   2004,
+	"date":       91,
+	"time":       92,
+	"datetime":   93,
+	"timestamp":  93,
+	"year":       12,
+	"enum":       1,
+	"set":        1,
+	"json":       12,
+}
+
+// canalUnsignedSQLTypes 无符号的整数使用更大的类型
+var canalUnsignedSQLTypes = map[string]int{
+	"tinyint":   5,
+	"smallint":  4,
+	"mediumint": 4,
+	"int":       -5,
+	"integer":   -5,
+	"bigint":    3,
+}
+
+// CanalMessage 阿里巴巴Canal的FlatMessage，即canal.mq.flatMessage=true时的格式
+type CanalMessage struct {
+	Data      []map[string]any  `json:"data"`
+	Database  string            `json:"database"`
+	Es        int64             `json:"es"`
+	ID        uint64            `json:"id"`
+	IsDdl     bool              `json:"isDdl"`
+	MysqlType map[string]string `json:"mysqlType"`
+	Old       []map[string]any  `json:"old"`
+	PkNames   []string          `json:"pkNames"`
+	Sql       string            `json:"sql"`
+	SqlType   map[string]int    `json:"sqlType"`
+	Table     string            `json:"table"`
+	Ts        int64             `json:"ts"`
+	Type      string            `json:"type"`
+}
+
+// CanalJson 将RowEvent转为Canal的FlatMessage
+//
+//	每个消息只有一行；data、old中的值均为字符串（NULL为null），old只包含修改的列；
+//	需要storage中的表结构
+type CanalJson struct {
+	options Options
+}
+
+func init() {
+	Register("canal-json", func(options Options) (Serializer, error) { return NewCanalJson(options), nil })
+}
+
+func NewCanalJson(options Options) *CanalJson {
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	return &CanalJson{options: options}
+}
+
+func (c *CanalJson) ContentType() string {
+	return "application/json"
+}
+
+func (c *CanalJson) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	message, err := c.Message(event, meta)
+	if err != nil {
+		return nil, err
+	}
+	return text_utils.JsonMarshalToBytes(message)
+}
+
+// Message 生成FlatMessage，es为binlog事件的时间（毫秒），快照的行为当前时间
+func (c *CanalJson) Message(event consumer.RowEvent, meta EventMeta) (CanalMessage, error) {
+	table := event.GetTable()
+	if table == nil {
+		return CanalMessage{}, errors.Errorf("[Format]table structure of \"%s.%s\" not found", event.Schema, event.Table)
+	}
+
+	now := c.options.Now()
+	message := CanalMessage{
+		Database:  event.Schema,
+		Es:        now.UnixMilli(),
+		ID:        event.ID,
+		MysqlType: make(map[string]string, len(table.Columns)),
+		SqlType:   make(map[string]int, len(table.Columns)),
+		Table:     event.Table,
+		Ts:        now.UnixMilli(),
+	}
+	if !meta.IsEmpty() {
+		message.Es = meta.CommitTime().UnixMilli()
+	}
+	for _, column := range table.Columns {
+		message.MysqlType[column.Name] = column.RawType
+		message.SqlType[column.Name] = CanalSQLType(column)
+	}
+	for _, i := range table.PKColumns {
+		message.PkNames = append(message.PkNames, table.Columns[i].Name)
+	}
+
+	switch event.Action {
+	case "insert":
+		message.Type = "INSERT"
+		message.Data = []map[string]any{c.row(table.Columns, event.NewRow)}
+	case "update":
+		message.Type = "UPDATE"
+		message.Data = []map[string]any{c.row(table.Columns, event.NewRow)}
+		message.Old = []map[string]any{c.row(changedColumns(table, event), event.OldRow)}
+	case "delete":
+		message.Type = "DELETE"
+		message.Data = []map[string]any{c.row(table.Columns, event.OldRow)}
+	default:
+		return CanalMessage{}, errors.Errorf("[Format]unsupported action \"%s\"", event.Action)
+	}
+	return message, nil
+}
+
+func (c *CanalJson) row(columns []consumer.TableColumn, row map[string]any) map[string]any {
+	values := make(map[string]any, len(columns))
+	for _, column := range columns {
+		values[column.Name] = c.value(column, row[column.Name])
+	}
+	return values
+}
+
+// value 与Canal相同的字符串：ENUM、SET为值，DECIMAL保留小数位数，BINARY、BLOB等按ISO-8859-1解码
+func (c *CanalJson) value(column consumer.TableColumn, val any) any {
+	if val == nil {
+		return nil
+	}
+	switch column.Type {
+	case consumer.TYPE_ENUM:
+		return EnumString(column, val)
+	case consumer.TYPE_SET:
+		return SetString(column, val)
+	case consumer.TYPE_DECIMAL:
+		return DecimalString(column, val)
+	}
+	// BLOB的列类型也是TYPE_STRING，所以按sqlType判断
+	if t := CanalSQLType(column); t == 2004 || t == -2 {
+		b := ToBytes(val)
+		runes := make([]rune, len(b))
+		for i, v := range b {
+			runes[i] = rune(v)
+		}
+		return string(runes)
+	}
+	return ToString(val)
+}
+
+// CanalSQLType 列的java.sql.Types，未知的类型为 12（VARCHAR），GEOMETRY等为 -2（BINARY）
+func CanalSQLType(column consumer.TableColumn) int {
+	name := rawTypeName(column.RawType)
+	if column.IsUnsigned {
+		if t, ok := canalUnsignedSQLTypes[name]; ok {
+			return t
+		}
+	}
+	if t, ok := canalSQLTypes[name]; ok {
+		return t
+	} else if column.Type == consumer.TYPE_POINT {
+		return -2
+	}
+	return 12
+}
+
+// rawTypeName "int(10) unsigned" 中的 "int"
+func rawTypeName(rawType string) string {
+	name, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(rawType)), "(")
+	name, _, _ = strings.Cut(name, " ")
+	return name
+}
+
+// changedColumns update修改的列，event中没有DiffCols时比较新旧的值
+func changedColumns(table *consumer.Table, event consumer.RowEvent) []consumer.TableColumn {
+	var columns []consumer.TableColumn
+	for _, column := range table.Columns {
+		if len(event.DiffCols) > 0 {
+			for _, name := range event.DiffCols {
+				if name == column.Name {
+					columns = append(columns, column)
+					break
+				}
+			}
+		} else if old, _new := event.OldRow[column.Name], event.NewRow[column.Name]; (old == nil) != (_new == nil) || ToString(old) != ToString(_new) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,406 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Debezium MySQL connector的默认配置（time.precision.mode=adaptive_time_microseconds）下的逻辑类型
+const (
+	debeziumDate            = "io.debezium.time.Date"
+	debeziumMicroTime       = "io.debezium.time.MicroTime"
+	debeziumTimestamp       = "io.debezium.time.Timestamp"
+	debeziumMicroTimestamp  = "io.debezium.time.MicroTimestamp"
+	debeziumZonedTimestamp  = "io.debezium.time.ZonedTimestamp"
+	debeziumYear            = "io.debezium.time.Year"
+	debeziumJson            = "io.debezium.data.Json"
+	debeziumEnum            = "io.debezium.data.Enum"
+	debeziumEnumSet         = "io.debezium.data.EnumSet"
+	debeziumBits            = "io.debezium.data.Bits"
+	debeziumGeometry        = "io.debezium.data.geometry.Geometry"
+	debeziumDecimal         = "org.apache.kafka.connect.data.Decimal"
+	debeziumZonedTimeLayout = "2006-01-02T15:04:05.999999Z"
+)
+
+// DebeziumField Kafka Connect的schema
+type DebeziumField struct {
+	Type       string            `json:"type"`
+	Optional   bool              `json:"optional"`
+	Name       string            `json:"name,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Default    any               `json:"default,omitempty"`
+	Fields     []DebeziumField   `json:"fields,omitempty"`
+	Field      string            `json:"field,omitempty"`
+}
+
+// DebeziumSource 事件的来源，字段与Debezium MySQL connector相同
+type DebeziumSource struct {
+	Version   string  `json:"version"`
+	Connector string  `json:"connector"`
+	Name      string  `json:"name"`
+	TsMs      int64   `json:"ts_ms"`
+	Snapshot  string  `json:"snapshot"`
+	Db        string  `json:"db"`
+	Sequence  *string `json:"sequence"`
+	Table     string  `json:"table"`
+	ServerID  int64   `json:"server_id"`
+	Gtid      *string `json:"gtid"`
+	File      string  `json:"file"`
+	Pos       int64   `json:"pos"`
+	Row       int     `json:"row"`
+	Thread    *int64  `json:"thread"`
+	Query     *string `json:"query"`
+}
+
+// DebeziumPayload 变更事件
+type DebeziumPayload struct {
+	Before      map[string]any `json:"before"`
+	After       map[string]any `json:"after"`
+	Source      DebeziumSource `json:"source"`
+	Op          string         `json:"op"`
+	TsMs        int64          `json:"ts_ms"`
+	Transaction any            `json:"transaction"`
+}
+
+// DebeziumEnvelope 开启schema时的消息
+type DebeziumEnvelope struct {
+	Schema  DebeziumField   `json:"schema"`
+	Payload DebeziumPayload `json:"payload"`
+}
+
+// Debezium 将RowEvent转为Debezium的 before/after/source/op/ts_ms 格式
+//
+//	op：insert为c、update为u、delete为d，快照的insert为r；
+//	值的表示与Debezium MySQL connector的默认配置相同，需要storage中的表结构
+type Debezium struct {
+	options Options
+}
+
+func init() {
+	Register("debezium", func(options Options) (Serializer, error) { return NewDebezium(options) })
+}
+
+func NewDebezium(options Options) (*Debezium, error) {
+	switch options.DecimalHandling {
+	case "", "precise", "string", "double":
+	default:
+		return nil, errors.Errorf("[Format]unsupported decimal_handling \"%s\"", options.DecimalHandling)
+	}
+	if options.DecimalHandling == "" {
+		options.DecimalHandling = "precise"
+	}
+	if options.ServerName == "" {
+		options.ServerName = "dm"
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	return &Debezium{options: options}, nil
+}
+
+func (d *Debezium) ContentType() string {
+	return "application/json"
+}
+
+func (d *Debezium) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	envelope, err := d.Envelope(event, meta)
+	if err != nil {
+		return nil, err
+	}
+	if !d.options.Schema {
+		return text_utils.JsonMarshalToBytes(envelope.Payload)
+	}
+	return text_utils.JsonMarshalToBytes(envelope)
+}
+
+// Envelope 生成消息，没有开启schema时Schema为空
+func (d *Debezium) Envelope(event consumer.RowEvent, meta EventMeta) (DebeziumEnvelope, error) {
+	table := event.GetTable()
+	if table == nil {
+		return DebeziumEnvelope{}, errors.Errorf("[Format]table structure of \"%s.%s\" not found", event.Schema, event.Table)
+	}
+
+	now := d.options.Now()
+	payload := DebeziumPayload{
+		Source: DebeziumSource{
+			Version:   "dm",
+			Connector: "mysql",
+			Name:      d.options.ServerName,
+			TsMs:      now.UnixMilli(),
+			Snapshot:  "false",
+			Db:        event.Schema,
+			Table:     event.Table,
+			File:      meta.LogName,
+			Pos:       int64(meta.LogPos),
+		},
+		TsMs: now.UnixMilli(),
+	}
+	if !meta.IsEmpty() {
+		payload.Source.TsMs = meta.CommitTime().UnixMilli()
+	}
+
+	switch event.Action {
+	case "insert":
+		payload.Op = "c"
+		if meta.Snapshot {
+			payload.Op, payload.Source.Snapshot = "r", "true"
+		}
+		payload.After = d.row(table, event.NewRow)
+	case "update":
+		payload.Op = "u"
+		payload.Before = d.row(table, event.OldRow)
+		payload.After = d.row(table, event.NewRow)
+	case "delete":
+		payload.Op = "d"
+		payload.Before = d.row(table, event.OldRow)
+	default:
+		return DebeziumEnvelope{}, errors.Errorf("[Format]unsupported action \"%s\"", event.Action)
+	}
+
+	envelope := DebeziumEnvelope{Payload: payload}
+	if d.options.Schema {
+		envelope.Schema = d.Schema(table)
+	}
+	return envelope, nil
+}
+
+// Schema 表对应的Envelope的schema
+func (d *Debezium) Schema(table *consumer.Table) DebeziumField {
+	prefix := d.options.ServerName + "." + table.Schema + "." + table.Name
+
+	value := DebeziumField{Type: "struct", Optional: true, Name: prefix + ".Value"}
+	for _, column := range table.Columns {
+		field := d.field(column)
+		field.Field = column.Name
+		value.Fields = append(value.Fields, field)
+	}
+
+	before, after := value, value
+	before.Field, after.Field = "before", "after"
+	return DebeziumField{
+		Type: "struct",
+		Name: prefix + ".Envelope",
+		Fields: []DebeziumField{
+			before,
+			after,
+			{Type: "struct", Name: "io.debezium.connector.mysql.Source", Field: "source", Fields: []DebeziumField{
+				{Type: "string", Field: "version"},
+				{Type: "string", Field: "connector"},
+				{Type: "string", Field: "name"},
+				{Type: "int64", Field: "ts_ms"},
+				{Type: "string", Optional: true, Name: debeziumEnum, Version: 1, Parameters: map[string]string{"allowed": "true,last,false,incremental"}, Default: "false", Field: "snapshot"},
+				{Type: "string", Field: "db"},
+				{Type: "string", Optional: true, Field: "sequence"},
+				{Type: "string", Optional: true, Field: "table"},
+				{Type: "int64", Field: "server_id"},
+				{Type: "string", Optional: true, Field: "gtid"},
+				{Type: "string", Field: "file"},
+				{Type: "int64", Field: "pos"},
+				{Type: "int32", Field: "row"},
+				{Type: "int64", Optional: true, Field: "thread"},
+				{Type: "string", Optional: true, Field: "query"},
+			}},
+			{Type: "string", Field: "op"},
+			{Type: "int64", Optional: true, Field: "ts_ms"},
+			{Type: "struct", Optional: true, Field: "transaction", Fields: []DebeziumField{
+				{Type: "string", Field: "id"},
+				{Type: "int64", Field: "total_order"},
+				{Type: "int64", Field: "data_collection_order"},
+			}},
+		},
+	}
+}
+
+// field 列的schema，所有的列都是optional
+func (d *Debezium) field(column consumer.TableColumn) DebeziumField {
+	rawType := strings.ToLower(column.RawType)
+	f := DebeziumField{Optional: true}
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT:
+		f.Type = debeziumIntegerType(rawType, column.IsUnsigned)
+		if strings.HasPrefix(rawType, "year") {
+			f.Type, f.Name, f.Version = "int32", debeziumYear, 1
+		}
+	case consumer.TYPE_FLOAT:
+		f.Type = "double"
+		if strings.HasPrefix(rawType, "float") {
+			f.Type = "float"
+		}
+	case consumer.TYPE_DECIMAL:
+		precision, scale, _ := ParseDecimalType(rawType)
+		switch d.options.DecimalHandling {
+		case "string":
+			f.Type = "string"
+		case "double":
+			f.Type = "double"
+		default:
+			f.Type, f.Name, f.Version = "bytes", debeziumDecimal, 1
+			f.Parameters = map[string]string{"scale": strconv.Itoa(int(scale)), "connect.decimal.precision": strconv.Itoa(int(precision))}
+		}
+	case consumer.TYPE_DATE:
+		f.Type, f.Name, f.Version = "int32", debeziumDate, 1
+	case consumer.TYPE_TIME:
+		f.Type, f.Name, f.Version = "int64", debeziumMicroTime, 1
+	case consumer.TYPE_DATETIME:
+		f.Type, f.Name, f.Version = "int64", debeziumTimestamp, 1
+		if Fsp(rawType) > 3 {
+			f.Name = debeziumMicroTimestamp
+		}
+	case consumer.TYPE_TIMESTAMP:
+		f.Type, f.Name, f.Version = "string", debeziumZonedTimestamp, 1
+	case consumer.TYPE_JSON:
+		f.Type, f.Name, f.Version = "string", debeziumJson, 1
+	case consumer.TYPE_ENUM:
+		f.Type, f.Name, f.Version = "string", debeziumEnum, 1
+		f.Parameters = map[string]string{"allowed": strings.Join(column.EnumValues, ",")}
+	case consumer.TYPE_SET:
+		f.Type, f.Name, f.Version = "string", debeziumEnumSet, 1
+		f.Parameters = map[string]string{"allowed": strings.Join(column.SetValues, ",")}
+	case consumer.TYPE_BIT:
+		if bits := debeziumBitLength(rawType); bits == 1 {
+			f.Type = "boolean"
+		} else {
+			f.Type, f.Name, f.Version = "bytes", debeziumBits, 1
+			f.Parameters = map[string]string{"length": strconv.Itoa(bits)}
+		}
+	case consumer.TYPE_BINARY:
+		f.Type = "bytes"
+	case consumer.TYPE_POINT:
+		f.Type, f.Name, f.Version = "struct", debeziumGeometry, 1
+		f.Fields = []DebeziumField{{Type: "bytes", Field: "wkb"}, {Type: "int32", Optional: true, Field: "srid"}}
+	default:
+		f.Type = "string"
+	}
+	return f
+}
+
+// row 按列的schema转换一行，缺少表结构中的列时为null
+func (d *Debezium) row(table *consumer.Table, row map[string]any) map[string]any {
+	values := make(map[string]any, len(table.Columns))
+	for _, column := range table.Columns {
+		values[column.Name] = d.value(column, row[column.Name])
+	}
+	return values
+}
+
+// value 与field对应的值，无法转换的值（比如 0000-00-00）为null
+func (d *Debezium) value(column consumer.TableColumn, val any) any {
+	if val == nil {
+		return nil
+	}
+
+	rawType := strings.ToLower(column.RawType)
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT:
+		if i, ok := ToInt64(val); ok {
+			return i
+		}
+		return nil
+	case consumer.TYPE_FLOAT:
+		if f, ok := ToFloat64(val); ok {
+			return f
+		}
+		return nil
+	case consumer.TYPE_DECIMAL:
+		switch d.options.DecimalHandling {
+		case "string":
+			return ToString(val)
+		case "double":
+			if f, ok := ToFloat64(val); ok {
+				return f
+			}
+			return nil
+		}
+		_, scale, _ := ParseDecimalType(rawType)
+		if b := DecimalBytes(ToString(val), int(scale)); b != nil {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		return nil
+	case consumer.TYPE_DATE:
+		if days, ok := ParseDate(val); ok {
+			return days
+		}
+		return nil
+	case consumer.TYPE_TIME:
+		if micros, ok := ParseTime(val); ok {
+			return micros
+		}
+		return nil
+	case consumer.TYPE_DATETIME:
+		t, ok := ParseDatetime(val, time.UTC)
+		if !ok {
+			return nil
+		}
+		if Fsp(rawType) > 3 {
+			return t.UnixMicro()
+		}
+		return t.UnixMilli()
+	case consumer.TYPE_TIMESTAMP:
+		if t, ok := ParseDatetime(val, d.options.Location); ok {
+			return t.UTC().Format(debeziumZonedTimeLayout)
+		}
+		return nil
+	case consumer.TYPE_ENUM:
+		return EnumString(column, val)
+	case consumer.TYPE_SET:
+		return SetString(column, val)
+	case consumer.TYPE_BIT:
+		i, ok := ToInt64(val)
+		if !ok {
+			return nil
+		}
+		bits := debeziumBitLength(rawType)
+		if bits == 1 {
+			return i != 0
+		}
+		// 小端序
+		buf := binary.LittleEndian.AppendUint64(nil, uint64(i))
+		return base64.StdEncoding.EncodeToString(buf[:(bits+7)/8])
+	case consumer.TYPE_BINARY:
+		return base64.StdEncoding.EncodeToString(ToBytes(val))
+	case consumer.TYPE_POINT:
+		// MySQL内部的格式：4字节的SRID + WKB
+		b := ToBytes(val)
+		if len(b) < 4 {
+			return nil
+		}
+		return map[string]any{"wkb": base64.StdEncoding.EncodeToString(b[4:]), "srid": int32(binary.LittleEndian.Uint32(b))}
+	}
+	return ToString(val)
+}
+
+// debeziumIntegerType 与Debezium相同，无符号的列使用更大的类型，bigint unsigned仍为int64
+func debeziumIntegerType(rawType string, unsigned bool) string {
+	switch {
+	case strings.HasPrefix(rawType, "tinyint"):
+		return "int16"
+	case strings.HasPrefix(rawType, "smallint"):
+		return core.If(unsigned, "int32", "int16")
+	case strings.HasPrefix(rawType, "mediumint"):
+		return "int32"
+	case strings.HasPrefix(rawType, "int"):
+		return core.If(unsigned, "int64", "int32")
+	}
+	return "int64"
+}
+
+// debeziumBitLength BIT(n)的n，默认为1
+func debeziumBitLength(rawType string) int {
+	if _, after, ok := strings.Cut(rawType, "("); ok {
+		if n, err := strconv.Atoi(strings.TrimSuffix(after, ")")); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
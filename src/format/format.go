@@ -0,0 +1,92 @@
+package format
+
+import (
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Serializer 将RowEvent序列化为下游的消息格式
+type Serializer interface {
+	// Marshal meta可以为空，比如脚本中没有binlog位置
+	Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error)
+	// ContentType 比如 "application/json"
+	ContentType() string
+}
+
+// EventMeta 即common.EventMeta，脚本中可以使用 format.EventMeta
+type EventMeta = common.EventMeta
+
+// Options 各个格式的options，不适用的字段会被忽略
+type Options struct {
+	// debezium: 输出schema块
+	Schema bool `yaml:"schema"`
+	// debezium: source.name，也是schema名称的前缀
+	ServerName string `yaml:"server_name"`
+	// debezium: DECIMAL的表示方式，precise（base64的非缩放整数）、string或者double
+	DecimalHandling string `yaml:"decimal_handling"`
+
+	// TIMESTAMP列的字符串所在的时区，即MySQL的时区
+	Location *time.Location `yaml:"-"`
+	// 消息中的当前时间，为空时使用time.Now，golden文件中固定为某个时间
+	Now func() time.Time `yaml:"-"`
+	// avro、protobuf: 表结构对应的schema版本，没有启用schema_registry时为nil
+	Registry *registry.Registry `yaml:"-"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		ServerName:      "dm",
+		DecimalHandling: "precise",
+		Location:        time.UTC,
+	}
+}
+
+// Factory 创建一个Serializer
+type Factory func(options Options) (Serializer, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]Factory{}
+)
+
+// Register 注册一个格式，重复注册会覆盖之前的
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+// New 创建name对应的Serializer
+func New(name string, options Options) (Serializer, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[name]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("[Format]format \"%s\" is not registered", name)
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	return factory(options)
+}
+
+// Names 已注册的格式
+func Names() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
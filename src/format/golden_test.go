@@ -0,0 +1,177 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-mysql-org/go-mysql/schema"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/go-common.v1/conf.v1"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// golden testdata中的golden文件，检查序列化的结果与下游的格式一致
+type golden struct {
+	Format  string  `yaml:"format" validate:"required"`
+	Options Options `yaml:"options"`
+	// TIMESTAMP列的字符串所在的时区，默认为UTC
+	TimeZone string `yaml:"time_zone"`
+	// 消息中的当前时间（RFC3339），快照的行等会使用
+	Now time.Time `yaml:"now"`
+
+	Table goldenTable   `yaml:"table" validate:"required"`
+	Cases []*goldenCase `yaml:"cases" validate:"required,gt=0,dive"`
+}
+
+// goldenTable 表结构，列的类型与 SHOW FULL COLUMNS 中的Type相同，比如 "int(10) unsigned"
+type goldenTable struct {
+	Schema  string         `yaml:"schema" validate:"required"`
+	Name    string         `yaml:"name" validate:"required"`
+	Columns []goldenColumn `yaml:"columns" validate:"required,gt=0,dive"`
+	PK      []string       `yaml:"pk"`
+}
+
+type goldenColumn struct {
+	Name    string `yaml:"name" validate:"required"`
+	RawType string `yaml:"type" validate:"required"`
+}
+
+type goldenCase struct {
+	Name     string         `yaml:"name" validate:"required"`
+	ID       uint64         `yaml:"id"`
+	Action   string         `yaml:"action" validate:"required,oneof=insert update delete"`
+	OldRow   map[string]any `yaml:"old_row"`
+	NewRow   map[string]any `yaml:"new_row"`
+	DiffCols []string       `yaml:"diff_cols"`
+	Meta     goldenMeta     `yaml:"meta"`
+	// 期望的消息，按JSON的值比较，与字段的顺序、空白无关
+	Expect string `yaml:"expect" validate:"required"`
+}
+
+type goldenMeta struct {
+	LogName   string `yaml:"log_name"`
+	LogPos    uint32 `yaml:"log_pos"`
+	Timestamp uint32 `yaml:"timestamp"`
+	Snapshot  bool   `yaml:"snapshot"`
+	TxnPos    uint32 `yaml:"txn_pos"`
+}
+
+func loadGolden(t *testing.T, file string) *golden {
+	g := &golden{Options: DefaultOptions()}
+	if err := conf.LoadSettings(g, file); err != nil {
+		t.Fatalf("load golden file \"%s\" error: %s", file, err)
+	}
+	return g
+}
+
+// schemaTable 转为canal中的表结构
+func (g *golden) schemaTable(t *testing.T) *schema.Table {
+	table := &schema.Table{Schema: g.Table.Schema, Name: g.Table.Name}
+	for _, column := range g.Table.Columns {
+		table.AddColumn(column.Name, column.RawType, "", "")
+	}
+	for _, name := range g.Table.PK {
+		i := table.FindColumn(name)
+		if i < 0 {
+			t.Fatalf("pk \"%s\" is not a column", name)
+		}
+		table.PKColumns = append(table.PKColumns, i)
+	}
+	return table
+}
+
+func (g *golden) serializer(t *testing.T) Serializer {
+	options := g.Options
+	options.Location = time.UTC
+	if g.TimeZone != "" {
+		location, err := time.LoadLocation(g.TimeZone)
+		if err != nil {
+			t.Fatalf("invalid time_zone: %s", err)
+		}
+		options.Location = location
+	}
+	now := g.Now
+	options.Now = func() time.Time { return now }
+
+	serializer, err := New(g.Format, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serializer
+}
+
+func (c *goldenCase) check(t *testing.T, g *golden, serializer Serializer) {
+	event := consumer.RowEvent{
+		ID:       c.ID,
+		Schema:   g.Table.Schema,
+		Table:    g.Table.Name,
+		Alias:    g.Table.Schema + "." + g.Table.Name,
+		OldRow:   c.OldRow,
+		NewRow:   c.NewRow,
+		DiffCols: c.DiffCols,
+		Action:   c.Action,
+	}
+	meta := EventMeta{
+		LogName:   c.Meta.LogName,
+		LogPos:    c.Meta.LogPos,
+		Timestamp: c.Meta.Timestamp,
+		Snapshot:  c.Meta.Snapshot,
+		TxnPos:    c.Meta.TxnPos,
+	}
+
+	actual, err := serializer.Marshal(event, meta)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	var want, got any
+	if err = decodeJsonNumber([]byte(c.Expect), &want); err != nil {
+		t.Fatalf("invalid expect: %s", err)
+	}
+	if err = decodeJsonNumber(actual, &got); err != nil {
+		t.Fatalf("invalid output: %s", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("output mismatch:\n    expect: %s\n    actual: %s", compactJson([]byte(c.Expect)), actual)
+	}
+}
+
+// decodeJsonNumber 数字按字面值比较，避免大整数丢失精度
+func decodeJsonNumber(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func compactJson(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.yml"))
+	if err != nil || len(files) <= 0 {
+		t.Fatalf("no golden files: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			g := loadGolden(t, file)
+			table := common.ToConsumerTable(g.schemaTable(t))
+			consumer.GetTableFn = func(string) *consumer.Table { return table }
+			serializer := g.serializer(t)
+
+			for _, c := range g.Cases {
+				t.Run(c.Name, func(t *testing.T) {
+					c.check(t, g, serializer)
+				})
+			}
+		})
+	}
+}
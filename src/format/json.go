@@ -0,0 +1,53 @@
+package format
+
+import (
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+)
+
+// EventMessage RowEvent的JSON格式，用于redis_publish、webhook等
+type EventMessage struct {
+	ID       uint64         `json:"id"`
+	Schema   string         `json:"schema"`
+	Table    string         `json:"table"`
+	Action   string         `json:"action"`
+	Old      map[string]any `json:"old,omitempty"`
+	New      map[string]any `json:"new,omitempty"`
+	DiffCols []string       `json:"diff_cols,omitempty"`
+}
+
+func NewEventMessage(event consumer.RowEvent) EventMessage {
+	return EventMessage{
+		ID:       event.ID,
+		Schema:   event.Schema,
+		Table:    event.Table,
+		Action:   event.Action,
+		Old:      event.OldRow,
+		New:      event.NewRow,
+		DiffCols: event.DiffCols,
+	}
+}
+
+// NewEventMessages 批量转换
+func NewEventMessages(events []consumer.RowEvent) []EventMessage {
+	messages := make([]EventMessage, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, NewEventMessage(event))
+	}
+	return messages
+}
+
+// jsonSerializer 默认的格式，即EventMessage
+type jsonSerializer struct{}
+
+func init() {
+	Register("json", func(options Options) (Serializer, error) { return jsonSerializer{}, nil })
+}
+
+func (jsonSerializer) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	return text_utils.JsonMarshalToBytes(NewEventMessage(event))
+}
+
+func (jsonSerializer) ContentType() string {
+	return "application/json"
+}
@@ -0,0 +1,199 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"math"
+	"strings"
+	"time"
+)
+
+const maxwellTimeLayout = "2006-01-02 15:04:05"
+
+// MaxwellMessage Maxwell的消息，xid、commit以外的字段与Maxwell相同
+//
+//	xid：canal无法获取InnoDB的事务ID，使用 EventMeta.TxnPos，同一个事务中的行相同；
+//	commit：无法知道一行是否为事务的最后一行，所以不输出
+type MaxwellMessage struct {
+	Database string         `json:"database"`
+	Table    string         `json:"table"`
+	Type     string         `json:"type"`
+	Ts       int64          `json:"ts"`
+	Xid      uint64         `json:"xid,omitempty"`
+	Position string         `json:"position,omitempty"`
+	Data     map[string]any `json:"data"`
+	Old      map[string]any `json:"old,omitempty"`
+}
+
+// Maxwell 将RowEvent转为Maxwell的JSON
+//
+//	type：insert、update、delete，快照的行为bootstrap-insert；
+//	值的表示与Maxwell相同，需要storage中的表结构
+type Maxwell struct {
+	options Options
+}
+
+func init() {
+	Register("maxwell", func(options Options) (Serializer, error) { return NewMaxwell(options), nil })
+}
+
+func NewMaxwell(options Options) *Maxwell {
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	return &Maxwell{options: options}
+}
+
+func (m *Maxwell) ContentType() string {
+	return "application/json"
+}
+
+func (m *Maxwell) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	message, err := m.Message(event, meta)
+	if err != nil {
+		return nil, err
+	}
+	return text_utils.JsonMarshalToBytes(message)
+}
+
+// Message 生成消息，ts为binlog事件的时间（秒），快照的行为当前时间
+func (m *Maxwell) Message(event consumer.RowEvent, meta EventMeta) (MaxwellMessage, error) {
+	table := event.GetTable()
+	if table == nil {
+		return MaxwellMessage{}, errors.Errorf("[Format]table structure of \"%s.%s\" not found", event.Schema, event.Table)
+	}
+
+	message := MaxwellMessage{
+		Database: event.Schema,
+		Table:    event.Table,
+		Ts:       m.options.Now().Unix(),
+		Xid:      uint64(meta.TxnPos),
+		Position: meta.Position(),
+	}
+	if meta.Timestamp > 0 {
+		message.Ts = int64(meta.Timestamp)
+	}
+
+	switch event.Action {
+	case "insert":
+		message.Type = "insert"
+		if meta.Snapshot {
+			message.Type = "bootstrap-insert"
+		}
+		message.Data = m.row(table.Columns, event.NewRow)
+	case "update":
+		message.Type = "update"
+		message.Data = m.row(table.Columns, event.NewRow)
+		message.Old = m.row(changedColumns(table, event), event.OldRow)
+	case "delete":
+		message.Type = "delete"
+		message.Data = m.row(table.Columns, event.OldRow)
+	default:
+		return MaxwellMessage{}, errors.Errorf("[Format]unsupported action \"%s\"", event.Action)
+	}
+	return message, nil
+}
+
+func (m *Maxwell) row(columns []consumer.TableColumn, row map[string]any) map[string]any {
+	values := make(map[string]any, len(columns))
+	for _, column := range columns {
+		values[column.Name] = m.value(column, row[column.Name])
+	}
+	return values
+}
+
+// value 整数、浮点数、DECIMAL为数字，SET为数组，JSON原样嵌入，BLOB等为base64，
+// TIMESTAMP转为UTC，POINT为WKT
+func (m *Maxwell) value(column consumer.TableColumn, val any) any {
+	if val == nil {
+		return nil
+	}
+
+	rawType := strings.ToLower(column.RawType)
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT:
+		if column.IsUnsigned && strings.HasPrefix(rawType, "bigint") {
+			if i, ok := ToInt64(val); ok {
+				return uint64(i)
+			}
+		} else if i, ok := ToInt64(val); ok {
+			return i
+		}
+	case consumer.TYPE_FLOAT:
+		if f, ok := ToFloat64(val); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	case consumer.TYPE_DECIMAL:
+		if s := DecimalString(column, val); json.Valid([]byte(s)) {
+			return json.Number(s)
+		}
+	case consumer.TYPE_TIMESTAMP:
+		if t, ok := ParseDatetime(val, m.options.Location); ok {
+			return t.UTC().Format(maxwellTimeLayout + fspLayout(Fsp(rawType)))
+		}
+	case consumer.TYPE_ENUM:
+		return EnumString(column, val)
+	case consumer.TYPE_SET:
+		values := []string{}
+		if s := SetString(column, val); s != "" {
+			values = strings.Split(s, ",")
+		}
+		return values
+	case consumer.TYPE_BIT:
+		if i, ok := ToInt64(val); ok {
+			if debeziumBitLength(rawType) == 1 {
+				return i != 0
+			}
+			return i
+		}
+	case consumer.TYPE_JSON:
+		if b := ToBytes(val); json.Valid(b) {
+			return json.RawMessage(b)
+		}
+	case consumer.TYPE_POINT:
+		if wkt, ok := PointWKT(ToBytes(val)); ok {
+			return wkt
+		}
+	case consumer.TYPE_BINARY:
+		return base64.StdEncoding.EncodeToString(ToBytes(val))
+	case consumer.TYPE_STRING:
+		if strings.Contains(rawType, "blob") {
+			return base64.StdEncoding.EncodeToString(ToBytes(val))
+		}
+	}
+	return ToString(val)
+}
+
+// fspLayout 小数秒的格式，比如fsp为3时为 ".000"
+func fspLayout(fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	return "." + strings.Repeat("0", fsp)
+}
+
+// PointWKT MySQL内部的POINT（4字节的SRID + WKB）转为 "POINT(x y)"，其它几何类型返回false
+func PointWKT(b []byte) (string, bool) {
+	if len(b) != 4+21 {
+		return "", false
+	}
+	wkb := b[4:]
+	var order binary.ByteOrder = binary.LittleEndian
+	if wkb[0] == 0 {
+		order = binary.BigEndian
+	}
+	if order.Uint32(wkb[1:5]) != 1 {
+		return "", false
+	}
+	x := math.Float64frombits(order.Uint64(wkb[5:13]))
+	y := math.Float64frombits(order.Uint64(wkb[13:21]))
+	return fmt.Sprintf("POINT(%v %v)", x, y), true
+}
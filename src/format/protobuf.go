@@ -0,0 +1,121 @@
+package format
+
+import (
+	"encoding/binary"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"math"
+	"time"
+)
+
+// Protobuf的wire type
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// Protobuf 使用schema_registry中的版本编码为Protobuf的Envelope消息，头部为Confluent格式的
+// schema id和消息序号（Envelope是第一个消息，所以为0），.proto参见 registry.RecordSchema.Proto
+type Protobuf struct {
+	options Options
+}
+
+func init() {
+	Register("protobuf", func(options Options) (Serializer, error) { return NewProtobuf(options), nil })
+}
+
+func NewProtobuf(options Options) *Protobuf {
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	return &Protobuf{options: options}
+}
+
+func (p *Protobuf) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Marshal proto3中Envelope的默认值（0、空字符串、false）不输出
+func (p *Protobuf) Marshal(event consumer.RowEvent, meta EventMeta) ([]byte, error) {
+	table, s, err := recordSchema(p.options.Registry, event)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &protoWriter{buf: append(confluentHeader(s.ID), 0)}
+	if event.ID != 0 {
+		w.varint(1, event.ID)
+	}
+	if event.Action != "" {
+		w.bytes(2, []byte(event.Action))
+	}
+	for i, row := range beforeAfter(event) {
+		if row != nil {
+			w.bytes(3+i, p.row(table, s, row))
+		}
+	}
+	for _, col := range event.DiffCols {
+		w.bytes(5, []byte(col))
+	}
+	if position := meta.Position(); position != "" {
+		w.bytes(6, []byte(position))
+	}
+	if meta.Timestamp > 0 {
+		w.varint(7, uint64(meta.CommitTime().UnixMilli()))
+	}
+	if meta.Snapshot {
+		w.varint(8, 1)
+	}
+	return w.buf, nil
+}
+
+// row Row中的字段均为optional，null不输出
+func (p *Protobuf) row(table *consumer.Table, s *registry.RecordSchema, row map[string]any) []byte {
+	w := &protoWriter{}
+	for i, field := range s.Fields {
+		column := table.Columns[i]
+		v, ok := recordValue(field, column, row[column.Name], p.options.Location)
+		if !ok {
+			continue
+		}
+
+		switch field.Proto {
+		case "int32", "int64", "uint32", "uint64", "bool":
+			// 负数的int32也按int64编码为10个字节
+			w.varint(field.Tag, uint64(recordInt64(v)))
+		case "float":
+			w.key(field.Tag, protoFixed32)
+			w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v.(float32)))
+		case "double":
+			w.key(field.Tag, protoFixed64)
+			w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v.(float64)))
+		case "bytes":
+			w.bytes(field.Tag, v.([]byte))
+		default:
+			w.bytes(field.Tag, []byte(recordDecimal(v)))
+		}
+	}
+	return w.buf
+}
+
+// protoWriter Protobuf的二进制编码
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) key(tag int, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(tag)<<3|uint64(wireType))
+}
+
+func (w *protoWriter) varint(tag int, v uint64) {
+	w.key(tag, protoVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) bytes(tag int, v []byte) {
+	w.key(tag, protoBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
@@ -0,0 +1,150 @@
+package format
+
+import (
+	"encoding/binary"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// protoFields 测试中用于解码Protobuf的消息，与protoWriter独立实现，
+// 字段编号 -> 值：uint64（varint、fixed64）、uint32（fixed32）或者[]byte
+func protoFields(t *testing.T, buf []byte) map[int][]any {
+	fields := map[int][]any{}
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf("invalid varint")
+		}
+		buf = buf[n:]
+		return v
+	}
+	for len(buf) > 0 {
+		key := uvarint()
+		tag := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			fields[tag] = append(fields[tag], uvarint())
+		case 1:
+			fields[tag] = append(fields[tag], binary.LittleEndian.Uint64(buf))
+			buf = buf[8:]
+		case 2:
+			n := int(uvarint())
+			fields[tag] = append(fields[tag], buf[:n])
+			buf = buf[n:]
+		case 5:
+			fields[tag] = append(fields[tag], binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// protoRow 按schema的字段顺序转为与testRecordRow相同的值，bigint unsigned转为十进制字符串
+func protoRow(t *testing.T, s *registry.RecordSchema, buf []byte) []any {
+	fields := protoFields(t, buf)
+	var values []any
+	for _, f := range s.Fields {
+		if len(fields[f.Tag]) != 1 {
+			values = append(values, nil)
+			continue
+		}
+		v := fields[f.Tag][0]
+		switch f.Proto {
+		case "int32", "int64":
+			values = append(values, int64(v.(uint64)))
+		case "uint32", "uint64":
+			values = append(values, strconv.FormatUint(v.(uint64), 10))
+		case "bool":
+			values = append(values, v.(uint64) == 1)
+		case "float":
+			values = append(values, math.Float32frombits(v.(uint32)))
+		case "double":
+			values = append(values, math.Float64frombits(v.(uint64)))
+		case "bytes":
+			values = append(values, v.([]byte))
+		default:
+			values = append(values, string(v.([]byte)))
+		}
+	}
+	return values
+}
+
+func TestProtobufMarshal(t *testing.T) {
+	setRecordTable()
+	r := newTestRegistry(t)
+	serializer, err := New("protobuf", Options{Registry: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, meta := testRecordEvent()
+	buf, err := serializer.Marshal(event, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, body := confluentSchema(t, r, buf)
+	// 消息序号，Envelope是第一个消息
+	if body[0] != 0 {
+		t.Fatalf("expected message index 0, got %d", body[0])
+	}
+	envelope := protoFields(t, body[1:])
+	for tag, expected := range map[int][]any{
+		1: {uint64(7)},
+		2: {[]byte("update")},
+		5: {[]byte("name"), []byte("flag")},
+		6: {[]byte("mysql-bin.000001:1234")},
+		7: {uint64(1600000000000)},
+	} {
+		if !reflect.DeepEqual(envelope[tag], expected) {
+			t.Errorf("field %d: expected %v, got %v", tag, expected, envelope[tag])
+		}
+	}
+	// proto3的默认值不输出
+	if _, ok := envelope[8]; ok {
+		t.Errorf("unexpected snapshot %v", envelope[8])
+	}
+
+	for tag, expected := range map[int][]any{3: testRecordRow("a", true), 4: testRecordRow(nil, false)} {
+		if len(envelope[tag]) != 1 {
+			t.Fatalf("field %d: expected a row, got %v", tag, envelope[tag])
+		}
+		if row := protoRow(t, s, envelope[tag][0].([]byte)); !reflect.DeepEqual(row, expected) {
+			t.Errorf("field %d: expected %v, got %v", tag, expected, row)
+		}
+	}
+}
+
+func TestProtobufTags(t *testing.T) {
+	table := setRecordTable()
+	r := newTestRegistry(t)
+	p := NewProtobuf(Options{Registry: r})
+	event, meta := testRecordEvent()
+	if _, err := p.Marshal(event, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除name之后，后面的列仍然使用原来的字段编号
+	setRecordTable(append(append([]consumer.TableColumn{}, table.Columns[:2]...), table.Columns[3:]...)...)
+	delete(event.OldRow, "name")
+	buf, err := p.Marshal(event, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, body := confluentSchema(t, r, buf)
+	if s.Version != 2 {
+		t.Fatalf("expected version 2, got %d", s.Version)
+	}
+	before := protoFields(t, protoFields(t, body[1:])[3][0].([]byte))
+	if _, ok := before[3]; ok {
+		t.Errorf("unexpected field 3 of the dropped column: %v", before[3])
+	}
+	if string(before[4][0].([]byte)) != "12.50" {
+		t.Errorf("expected amount in field 4, got %v", before)
+	}
+}
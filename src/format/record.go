@@ -0,0 +1,117 @@
+package format
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"strconv"
+	"time"
+)
+
+// confluentMagic Confluent的消息格式：0x00 + 4字节大端序的schema id + 数据
+const confluentMagic byte = 0
+
+// recordSchema 表的列结构在registry中的版本，avro、protobuf使用
+func recordSchema(r *registry.Registry, event consumer.RowEvent) (*consumer.Table, *registry.RecordSchema, error) {
+	if r == nil {
+		return nil, nil, errors.New("[Format]schema_registry is not enabled")
+	}
+	table := event.GetTable()
+	if table == nil {
+		return nil, nil, errors.Errorf("[Format]table structure of \"%s.%s\" not found", event.Schema, event.Table)
+	}
+	s, err := r.Register(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.Fields) != len(table.Columns) {
+		return nil, nil, errors.Errorf("[Format]schema %d of \"%s\" does not match the table structure", s.ID, s.Subject)
+	}
+	return table, s, nil
+}
+
+// confluentHeader 消息的头部
+func confluentHeader(id uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{confluentMagic}, id)
+}
+
+// beforeAfter 变更前、后的行，insert没有变更前的行，delete没有变更后的行
+func beforeAfter(event consumer.RowEvent) [2]map[string]any {
+	switch event.Action {
+	case "insert":
+		return [2]map[string]any{nil, event.NewRow}
+	case "delete":
+		return [2]map[string]any{event.OldRow, nil}
+	}
+	return [2]map[string]any{event.OldRow, event.NewRow}
+}
+
+// recordValue 按字段的种类转换值：int64、uint64、float32、float64、bool、string、[]byte，
+// DECIMAL为字符串，DATE为天数（int32），TIME、DATETIME、TIMESTAMP为微秒（int64）；
+// nil以及无法转换的值（比如 0000-00-00）返回false
+func recordValue(field registry.Field, column consumer.TableColumn, val any, location *time.Location) (any, bool) {
+	if val == nil {
+		return nil, false
+	}
+
+	switch field.Kind {
+	case registry.KindInt:
+		return ToInt64(val)
+	case registry.KindUint, registry.KindBit:
+		i, ok := ToInt64(val)
+		return uint64(i), ok
+	case registry.KindFloat:
+		f, ok := ToFloat64(val)
+		return float32(f), ok
+	case registry.KindDouble:
+		return ToFloat64(val)
+	case registry.KindDecimal:
+		return DecimalString(column, val), true
+	case registry.KindDate:
+		return ParseDate(val)
+	case registry.KindTime:
+		return ParseTime(val)
+	case registry.KindDatetime:
+		t, ok := ParseDatetime(val, time.UTC)
+		return t.UnixMicro(), ok
+	case registry.KindTimestamp:
+		t, ok := ParseDatetime(val, location)
+		return t.UnixMicro(), ok
+	case registry.KindEnum:
+		return EnumString(column, val), true
+	case registry.KindSet:
+		return SetString(column, val), true
+	case registry.KindBool:
+		i, ok := ToInt64(val)
+		return i != 0, ok
+	case registry.KindBytes:
+		return ToBytes(val), true
+	}
+	return ToString(val), true
+}
+
+// recordInt64 recordValue中的整数
+func recordInt64(v any) int64 {
+	switch i := v.(type) {
+	case int64:
+		return i
+	case uint64:
+		return int64(i)
+	case int32:
+		return int64(i)
+	case bool:
+		if i {
+			return 1
+		}
+	}
+	return 0
+}
+
+// recordDecimal recordValue中DECIMAL或者bigint unsigned的十进制字符串
+func recordDecimal(v any) string {
+	if u, ok := v.(uint64); ok {
+		return strconv.FormatUint(u, 10)
+	}
+	return ToString(v)
+}
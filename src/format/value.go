@@ -0,0 +1,244 @@
+package format
+
+import (
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canal中的值：ParseTime为false时DATE、DATETIME、TIMESTAMP、TIME均为字符串，
+// binlog中的ENUM为序号、SET为位图，快照中则为字符串
+
+var (
+	decimalRawTypeRegexp = regexp.MustCompile(`^decimal\((\d+),\s*(\d+)\)`)
+	fspRawTypeRegexp     = regexp.MustCompile(`^(?:datetime|timestamp|time)\((\d)\)`)
+)
+
+// ToString nil为空字符串，其它非标量转为JSON
+func ToString(val any) string {
+	if val == nil {
+		return ""
+	}
+	return text_utils.ToString(val, true)
+}
+
+// ToInt64 整数或者整数的字符串，uint64按位转换
+func ToInt64(val any) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+
+	s := ToString(val)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	} else if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return int64(u), true
+	}
+	return 0, false
+}
+
+// ToFloat64 浮点数或者数字的字符串
+func ToFloat64(val any) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	if i, ok := ToInt64(val); ok {
+		return float64(i), true
+	}
+	f, err := strconv.ParseFloat(ToString(val), 64)
+	return f, err == nil
+}
+
+// ParseDecimalType 从 "decimal(10,2)" 中解析精度和小数位数
+func ParseDecimalType(rawType string) (precision int32, scale int32, ok bool) {
+	matches := decimalRawTypeRegexp.FindStringSubmatch(strings.ToLower(rawType))
+	if matches == nil {
+		return 0, 0, false
+	}
+	p, _ := strconv.Atoi(matches[1])
+	s, _ := strconv.Atoi(matches[2])
+	return int32(p), int32(s), true
+}
+
+// DecimalString UseDecimal为false时binlog中的DECIMAL为float64，按列的小数位数格式化
+func DecimalString(column consumer.TableColumn, val any) string {
+	switch v := val.(type) {
+	case float64:
+		if _, scale, ok := ParseDecimalType(column.RawType); ok {
+			return strconv.FormatFloat(v, 'f', int(scale), 64)
+		}
+	case float32:
+		return DecimalString(column, float64(v))
+	}
+	return ToString(val)
+}
+
+// Fsp DATETIME、TIMESTAMP、TIME的小数秒位数
+func Fsp(rawType string) int {
+	matches := fspRawTypeRegexp.FindStringSubmatch(strings.ToLower(rawType))
+	if matches == nil {
+		return 0
+	}
+	fsp, _ := strconv.Atoi(matches[1])
+	return fsp
+}
+
+// DecimalUnscaled 十进制字符串按scale转为非缩放整数，多余的小数位被截断
+func DecimalUnscaled(s string, scale int) (*big.Int, bool) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+
+	integer, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > scale {
+		fraction = fraction[:scale]
+	}
+	fraction += strings.Repeat("0", scale-len(fraction))
+
+	v, ok := new(big.Int).SetString(integer+fraction, 10)
+	if !ok {
+		return nil, false
+	}
+	if negative {
+		v.Neg(v)
+	}
+	return v, true
+}
+
+// DecimalBytes 十进制字符串转为非缩放整数的大端序补码，无法解析时返回nil
+func DecimalBytes(s string, scale int) []byte {
+	v, ok := DecimalUnscaled(s, scale)
+	if !ok {
+		return nil
+	}
+
+	if v.Sign() >= 0 {
+		b := v.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// 负数：2^(8n) + v
+	n := len(new(big.Int).Sub(new(big.Int).Neg(v), big.NewInt(1)).Bytes()) + 1
+	return new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(8*n)), v).Bytes()
+}
+
+// ParseDate 返回自1970-01-01起的天数，0000-00-00等无法解析
+func ParseDate(val any) (int32, bool) {
+	t, err := time.ParseInLocation("2006-01-02", ToString(val), time.UTC)
+	if err != nil {
+		return 0, false
+	}
+	return int32(t.Unix() / 86400), true
+}
+
+// ParseDatetime 解析DATETIME、TIMESTAMP，字符串为location的时间，DATETIME可以使用time.UTC保留字面值
+func ParseDatetime(val any, location *time.Location) (time.Time, bool) {
+	if t, ok := val.(time.Time); ok {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", ToString(val), location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ParseTime 将TIME（-838:59:59 ~ 838:59:59）解析为微秒
+func ParseTime(val any) (int64, bool) {
+	s := ToString(val)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	s, fraction, _ := strings.Cut(s, ".")
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	var micros int64
+	for i, unit := range []int64{3600, 60, 1} {
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		micros += n * unit * 1e6
+	}
+	if fraction != "" {
+		fraction = (fraction + "000000")[:6]
+		n, err := strconv.ParseInt(fraction, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		micros += n
+	}
+	if negative {
+		micros = -micros
+	}
+	return micros, true
+}
+
+// EnumString binlog中的序号（从1开始）转为ENUM的值，快照中的字符串原样返回
+func EnumString(column consumer.TableColumn, val any) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	if i, ok := ToInt64(val); ok && i >= 1 && int(i) <= len(column.EnumValues) {
+		return column.EnumValues[i-1]
+	} else if ok && i == 0 {
+		return ""
+	}
+	return ToString(val)
+}
+
+// SetString binlog中的位图转为逗号分隔的SET的值，快照中的字符串原样返回
+func SetString(column consumer.TableColumn, val any) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	bits, ok := ToInt64(val)
+	if !ok || len(column.SetValues) <= 0 {
+		return ToString(val)
+	}
+	var values []string
+	for i, value := range column.SetValues {
+		if bits&(1<<i) != 0 {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// ToBytes BINARY、BLOB等的原始字节
+func ToBytes(val any) []byte {
+	if b, ok := val.([]byte); ok {
+		return b
+	}
+	return []byte(ToString(val))
+}
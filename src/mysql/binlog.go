@@ -0,0 +1,177 @@
+package mysql
+
+import (
+	"context"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pingcap/errors"
+	"github.com/siddontang/go-log/log"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/go-common.v1/utils/conv"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// binlogEventTimeout 定位binlog位置时，等待一个事件的最长时间
+const binlogEventTimeout = 30 * time.Second
+
+type BinaryLog struct {
+	Name string `db:"Log_name"`
+	Size uint64 `db:"File_size"`
+}
+
+// BinaryLogs SHOW BINARY LOGS
+func (s *MySql) BinaryLogs() ([]BinaryLog, error) {
+	var logs []BinaryLog
+	// MySQL 8.0 多了 Encrypted 字段, 需要忽略未定义的字段
+	if err := s.connection.Unsafe().Select(&logs, "SHOW BINARY LOGS"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return logs, nil
+}
+
+// LocatePosition 根据时间查找binlog的位置
+//
+//  1. 倒序读取每个binlog文件的第一个事件，找到第一个时间小于等于t的文件；
+//  2. 顺序扫描该文件，返回第一个在t之后开始的事务的位置；
+//  3. t超过了所有binlog，返回最后一个文件的结尾
+func (s *MySql) LocatePosition(ctx context.Context, t time.Time) (common.BinLogPosition, error) {
+	logs, err := s.BinaryLogs()
+	if err != nil {
+		return common.BinLogPosition{}, err
+	} else if len(logs) <= 0 {
+		return common.BinLogPosition{}, errors.New("no binary logs found, is the log_bin enabled?")
+	}
+
+	timestamp := uint32(t.Unix())
+	start := 0
+	for i := len(logs) - 1; i >= 0; i-- {
+		ts, err := s.firstEventTimestamp(ctx, logs[i].Name)
+		if err != nil {
+			return common.BinLogPosition{}, err
+		}
+		s.logger.Debug("[MySql]binlog first event", zap.String("file", logs[i].Name), zap.Time("time", time.Unix(int64(ts), 0)))
+		if ts <= timestamp {
+			start = i
+			break
+		}
+	}
+
+	for _, binLog := range logs[start:] {
+		pos, found, err := s.scanPosition(ctx, binLog, timestamp)
+		if err != nil {
+			return common.BinLogPosition{}, err
+		} else if found {
+			return pos, nil
+		}
+	}
+
+	last := logs[len(logs)-1]
+	return common.BinLogPosition{File: last.Name, Position: uint32(last.Size)}, nil
+}
+
+func (s *MySql) newBinlogSyncer() (*replication.BinlogSyncer, error) {
+	host, port, err := net.SplitHostPort(s.settings.MySqlOptions.Host)
+	if err != nil {
+		return nil, errors.Errorf("the host \"%s\" error: %s", s.settings.MySqlOptions.Host, err.Error())
+	}
+
+	streamHandler, _ := log.NewTimeRotatingFileHandler(filepath.Join(filepath.Dir(s.settings.LoggerOptions.FilePath), common.LogCanalFilename), log.WhenDay, 1)
+
+	return replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:       s.settings.MySqlOptions.ServerID,
+		Flavor:         s.settings.MySqlOptions.Flavor,
+		Host:           host,
+		Port:           uint16(conv.Atoi(port, 3306)),
+		User:           s.settings.MySqlOptions.Username,
+		Password:       s.settings.MySqlOptions.Password,
+		Charset:        s.settings.MySqlOptions.Charset,
+		Logger:         log.NewDefault(streamHandler),
+		RawModeEnabled: false,
+	}), nil
+}
+
+// 读取binlog文件第一个有时间的事件（跳过了伪造的RotateEvent）
+func (s *MySql) firstEventTimestamp(ctx context.Context, file string) (uint32, error) {
+	syncer, err := s.newBinlogSyncer()
+	if err != nil {
+		return 0, err
+	}
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(mysql.Position{Name: file, Pos: 4})
+	if err != nil {
+		return 0, errors.Annotatef(err, "read binlog \"%s\" error", file)
+	}
+
+	for {
+		e, err := getEvent(ctx, streamer)
+		if err != nil {
+			return 0, errors.Annotatef(err, "read binlog \"%s\" error", file)
+		}
+		if e.Header.Timestamp > 0 {
+			return e.Header.Timestamp, nil
+		}
+	}
+}
+
+// 扫描binlog文件，找到第一个时间大于等于timestamp、并且处于事务边界的位置
+func (s *MySql) scanPosition(ctx context.Context, binLog BinaryLog, timestamp uint32) (common.BinLogPosition, bool, error) {
+	syncer, err := s.newBinlogSyncer()
+	if err != nil {
+		return common.BinLogPosition{}, false, err
+	}
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(mysql.Position{Name: binLog.Name, Pos: 4})
+	if err != nil {
+		return common.BinLogPosition{}, false, errors.Annotatef(err, "read binlog \"%s\" error", binLog.Name)
+	}
+
+	// boundary 为最近一个事务边界的位置，atBoundary 表示当前事件是否从该边界开始
+	var boundary uint32 = 4
+	atBoundary := true
+	for {
+		e, err := getEvent(ctx, streamer)
+		if err != nil {
+			return common.BinLogPosition{}, false, errors.Annotatef(err, "read binlog \"%s\" error", binLog.Name)
+		}
+
+		switch ev := e.Event.(type) {
+		case *replication.RotateEvent:
+			if e.Header.Timestamp > 0 { // 不是伪造的RotateEvent，文件结束
+				return common.BinLogPosition{}, false, nil
+			}
+		case *replication.FormatDescriptionEvent, *replication.PreviousGTIDsEvent:
+		default:
+			if atBoundary && e.Header.Timestamp >= timestamp {
+				return common.BinLogPosition{File: binLog.Name, Position: boundary}, true, nil
+			}
+			atBoundary = false
+
+			switch ev := ev.(type) {
+			case *replication.XIDEvent:
+				boundary, atBoundary = e.Header.LogPos, true
+			case *replication.QueryEvent:
+				if !strings.EqualFold(string(ev.Query), "BEGIN") { // DDL 或非事务的语句
+					boundary, atBoundary = e.Header.LogPos, true
+				}
+			}
+		}
+
+		// 最新的binlog读到结尾之后不会再有事件（比如只有文件头），需要按SHOW BINARY LOGS时的大小结束
+		if uint64(e.Header.LogPos) >= binLog.Size {
+			return common.BinLogPosition{}, false, nil
+		}
+	}
+}
+
+// getEvent 读取下一个事件，超过binlogEventTimeout没有事件时返回错误，避免在binlog的结尾一直阻塞
+func getEvent(ctx context.Context, streamer *replication.BinlogStreamer) (*replication.BinlogEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, binlogEventTimeout)
+	defer cancel()
+	return streamer.GetEvent(ctx)
+}
@@ -9,6 +9,7 @@ import (
 	"gopkg.in/go-mixed/dm.v1/src/common"
 	"gopkg.in/go-mixed/dm.v1/src/settings"
 	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/conv"
 	"net/url"
 	"strings"
 )
@@ -28,6 +29,15 @@ func NewMySql(settings *settings.Settings, logger *logger.Logger) *MySql {
 	}
 }
 
+// NewMySqlWithDB 使用已经打开的连接，不需要再调用Connect，比如测试中的sqlmock
+func NewMySqlWithDB(settings *settings.Settings, logger *logger.Logger, db *sqlx.DB) *MySql {
+	return &MySql{
+		settings:   settings,
+		logger:     logger,
+		connection: db,
+	}
+}
+
 func (s *MySql) Connect() error {
 	param := url.Values{}
 	param.Add("parseTime", "true")
@@ -123,3 +133,71 @@ func (s *MySql) Close() error {
 
 	return nil
 }
+
+// Variable SHOW VARIABLES LIKE name，不存在时返回空字符串
+func (s *MySql) Variable(name string) (string, error) {
+	type variable struct {
+		Name  string `db:"Variable_name"`
+		Value string `db:"Value"`
+	}
+	var vars []variable
+	if err := s.connection.Select(&vars, "SHOW VARIABLES LIKE ?", name); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if len(vars) <= 0 {
+		return "", nil
+	}
+	return vars[0].Value, nil
+}
+
+// Grants 当前用户的权限 SHOW GRANTS
+func (s *MySql) Grants() ([]string, error) {
+	var grants []string
+	if err := s.connection.Select(&grants, "SHOW GRANTS"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return grants, nil
+}
+
+// ReplicaServerIDs 已经连接到master的所有replica的server_id
+func (s *MySql) ReplicaServerIDs() ([]uint32, error) {
+	// MySQL 8.0.22 之后使用 SHOW REPLICAS
+	rows, err := s.connection.Queryx("SHOW REPLICAS")
+	if err != nil {
+		if rows, err = s.connection.Queryx("SHOW SLAVE HOSTS"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	defer rows.Close()
+
+	var ids []uint32
+	for rows.Next() {
+		row := map[string]any{}
+		if err = rows.MapScan(row); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for k, v := range row {
+			if strings.EqualFold(k, "Server_id") {
+				ids = append(ids, uint32(conv.AnyToUint64(v)))
+			}
+		}
+	}
+	return ids, errors.WithStack(rows.Err())
+}
+
+// TableNames 所有的表名，格式为 schema.table
+func (s *MySql) TableNames() ([]string, error) {
+	var tables []struct {
+		Schema string `db:"TABLE_SCHEMA"`
+		Name   string `db:"TABLE_NAME"`
+	}
+	if err := s.connection.Select(&tables, "SELECT `TABLE_SCHEMA`, `TABLE_NAME` FROM `INFORMATION_SCHEMA`.`TABLES` WHERE `TABLE_TYPE` = 'BASE TABLE'"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+	for _, table := range tables {
+		names = append(names, common.BuildTableName(table.Schema, table.Name, nil))
+	}
+	return names, nil
+}
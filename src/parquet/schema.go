@@ -0,0 +1,184 @@
+package parquet
+
+// Type parquet的物理类型
+type Type int32
+
+const (
+	Boolean   Type = 0
+	Int32     Type = 1
+	Int64     Type = 2
+	Float     Type = 4
+	Double    Type = 5
+	ByteArray Type = 6
+)
+
+// Codec 数据页的压缩方式
+type Codec int32
+
+const (
+	Uncompressed Codec = 0
+	Gzip         Codec = 2
+)
+
+// LogicalKind 逻辑类型
+type LogicalKind int
+
+const (
+	LogicalNone LogicalKind = iota
+	LogicalString
+	LogicalJson
+	LogicalEnum
+	LogicalDate
+	LogicalTimestamp
+	LogicalInteger
+	LogicalDecimal
+)
+
+// LogicalType 逻辑类型及其参数
+type LogicalType struct {
+	Kind LogicalKind
+	// Timestamp: 是否为UTC时间，false表示本地时间（比如MySQL的DATETIME）
+	AdjustedToUTC bool
+	// Integer
+	BitWidth int8
+	Signed   bool
+	// Decimal
+	Precision int32
+	Scale     int32
+}
+
+func StringType() LogicalType {
+	return LogicalType{Kind: LogicalString}
+}
+
+func JsonType() LogicalType {
+	return LogicalType{Kind: LogicalJson}
+}
+
+func EnumType() LogicalType {
+	return LogicalType{Kind: LogicalEnum}
+}
+
+// DateType 存储为Int32，自1970-01-01起的天数
+func DateType() LogicalType {
+	return LogicalType{Kind: LogicalDate}
+}
+
+// TimestampType 存储为Int64的微秒
+func TimestampType(adjustedToUTC bool) LogicalType {
+	return LogicalType{Kind: LogicalTimestamp, AdjustedToUTC: adjustedToUTC}
+}
+
+func IntegerType(bitWidth int8, signed bool) LogicalType {
+	return LogicalType{Kind: LogicalInteger, BitWidth: bitWidth, Signed: signed}
+}
+
+// DecimalType 存储为ByteArray，值为大端序补码的非缩放整数
+func DecimalType(precision, scale int32) LogicalType {
+	return LogicalType{Kind: LogicalDecimal, Precision: precision, Scale: scale}
+}
+
+// Column 一个扁平的列
+type Column struct {
+	Name     string
+	Type     Type
+	Logical  LogicalType
+	Optional bool
+}
+
+// convertedType 旧版本的逻辑类型，-1表示没有
+func (c Column) convertedType() int32 {
+	switch c.Logical.Kind {
+	case LogicalString:
+		return 0 // UTF8
+	case LogicalEnum:
+		return 4 // ENUM
+	case LogicalDecimal:
+		return 5 // DECIMAL
+	case LogicalDate:
+		return 6 // DATE
+	case LogicalTimestamp:
+		if c.Logical.AdjustedToUTC {
+			return 10 // TIMESTAMP_MICROS
+		}
+	case LogicalInteger:
+		base := int32(15) // INT_8
+		if !c.Logical.Signed {
+			base = 11 // UINT_8
+		}
+		switch c.Logical.BitWidth {
+		case 8:
+			return base
+		case 16:
+			return base + 1
+		case 32:
+			return base + 2
+		case 64:
+			return base + 3
+		}
+	case LogicalJson:
+		return 19 // JSON
+	}
+	return -1
+}
+
+// writeSchemaElement 写入SchemaElement
+func (c Column) writeSchemaElement(w *thriftWriter) {
+	w.BeginListStruct()
+	w.I32(1, int32(c.Type))
+	if c.Optional {
+		w.I32(3, 1) // OPTIONAL
+	} else {
+		w.I32(3, 0) // REQUIRED
+	}
+	w.String(4, c.Name)
+	if converted := c.convertedType(); converted >= 0 {
+		w.I32(6, converted)
+	}
+	if c.Logical.Kind == LogicalDecimal {
+		w.I32(7, c.Logical.Scale)
+		w.I32(8, c.Logical.Precision)
+	}
+	if c.Logical.Kind != LogicalNone {
+		w.BeginStruct(10)
+		c.writeLogicalType(w)
+		w.EndStruct()
+	}
+	w.EndStruct()
+}
+
+// writeLogicalType 写入LogicalType的union
+func (c Column) writeLogicalType(w *thriftWriter) {
+	switch c.Logical.Kind {
+	case LogicalString:
+		w.BeginStruct(1)
+		w.EndStruct()
+	case LogicalEnum:
+		w.BeginStruct(4)
+		w.EndStruct()
+	case LogicalDecimal:
+		w.BeginStruct(5)
+		w.I32(1, c.Logical.Scale)
+		w.I32(2, c.Logical.Precision)
+		w.EndStruct()
+	case LogicalDate:
+		w.BeginStruct(6)
+		w.EndStruct()
+	case LogicalTimestamp:
+		w.BeginStruct(8)
+		w.Bool(1, c.Logical.AdjustedToUTC)
+		w.BeginStruct(2) // TimeUnit
+		w.BeginStruct(2) // MICROS
+		w.EndStruct()
+		w.EndStruct()
+		w.EndStruct()
+	case LogicalInteger:
+		w.BeginStruct(10)
+		w.Byte(1, c.Logical.BitWidth)
+		w.Bool(2, c.Logical.Signed)
+		w.EndStruct()
+	case LogicalJson:
+		w.BeginStruct(12)
+		w.EndStruct()
+	}
+}
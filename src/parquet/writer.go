@@ -0,0 +1,328 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	magic     = "PAR1"
+	createdBy = "dm"
+
+	encodingPlain = 0
+	encodingRle   = 3
+)
+
+// Writer 只追加写入的parquet文件：扁平的schema，每个列块一个PLAIN编码的数据页
+//
+//	每次WriteFooter之后文件都是完整的，之后可以继续写入行组并再次WriteFooter，
+//	读取时只使用最后一个footer，之前的footer成为文件中未被引用的数据
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	columns []Column
+	codec   Codec
+
+	rowGroups []rowGroup
+	numRows   int64
+	metadata  map[string]string
+}
+
+type rowGroup struct {
+	chunks    []columnChunk
+	numRows   int64
+	totalSize int64
+}
+
+type columnChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+func NewWriter(w io.Writer, columns []Column, codec Codec) (*Writer, error) {
+	if len(columns) <= 0 {
+		return nil, errors.New("[Parquet]no columns")
+	}
+	pw := &Writer{w: w, columns: columns, codec: codec, metadata: map[string]string{}}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (w *Writer) write(buf []byte) error {
+	n, err := w.w.Write(buf)
+	w.offset += int64(n)
+	return errors.WithStack(err)
+}
+
+// SetMetadata 写入footer的key_value_metadata
+func (w *Writer) SetMetadata(key, value string) {
+	w.metadata[key] = value
+}
+
+func (w *Writer) NumRows() int64 {
+	return w.numRows
+}
+
+func (w *Writer) Columns() []Column {
+	return w.columns
+}
+
+func (w *Writer) NumRowGroups() int {
+	return len(w.rowGroups)
+}
+
+// Size 已经写入的字节数，WriteFooter之后为完整文件的大小
+func (w *Writer) Size() int64 {
+	return w.offset
+}
+
+// WriteRowGroup 写入一个行组，每一行的值需要和columns一一对应：
+//
+//	Boolean: bool; Int32: int32; Int64: int64; Float: float32; Double: float64; ByteArray: []byte或string; nil表示NULL
+func (w *Writer) WriteRowGroup(rows [][]any) error {
+	if len(rows) <= 0 {
+		return nil
+	}
+
+	group := rowGroup{numRows: int64(len(rows))}
+	for i, column := range w.columns {
+		chunk, err := w.writeColumn(i, column, rows)
+		if err != nil {
+			return errors.WithMessagef(err, "[Parquet]column \"%s\"", column.Name)
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.totalSize += chunk.uncompressedSize
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += group.numRows
+	return nil
+}
+
+func (w *Writer) writeColumn(index int, column Column, rows [][]any) (columnChunk, error) {
+	var page bytes.Buffer
+
+	// 只有OPTIONAL的列有definition levels
+	if column.Optional {
+		levels := make([]bool, len(rows))
+		for i, row := range rows {
+			levels[i] = row[index] != nil
+		}
+		encoded := encodeLevels(levels)
+		_ = binary.Write(&page, binary.LittleEndian, uint32(len(encoded)))
+		page.Write(encoded)
+	}
+
+	var bits []bool
+	for _, row := range rows {
+		val := row[index]
+		if val == nil {
+			if !column.Optional {
+				return columnChunk{}, errors.New("NULL value in a required column")
+			}
+			continue
+		}
+		if column.Type == Boolean {
+			b, ok := val.(bool)
+			if !ok {
+				return columnChunk{}, errors.Errorf("expect bool, got %T", val)
+			}
+			bits = append(bits, b)
+			continue
+		}
+		if err := encodePlain(&page, column.Type, val); err != nil {
+			return columnChunk{}, err
+		}
+	}
+	if column.Type == Boolean {
+		page.Write(packBits(bits))
+	}
+
+	uncompressed := page.Bytes()
+	compressed := uncompressed
+	if w.codec == Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(uncompressed); err != nil {
+			return columnChunk{}, errors.WithStack(err)
+		}
+		if err := gz.Close(); err != nil {
+			return columnChunk{}, errors.WithStack(err)
+		}
+		compressed = buf.Bytes()
+	}
+
+	// PageHeader
+	header := newThriftWriter()
+	header.I32(1, 0) // DATA_PAGE
+	header.I32(2, int32(len(uncompressed)))
+	header.I32(3, int32(len(compressed)))
+	header.BeginStruct(5) // DataPageHeader
+	header.I32(1, int32(len(rows)))
+	header.I32(2, encodingPlain)
+	header.I32(3, encodingRle)
+	header.I32(4, encodingRle)
+	header.EndStruct()
+	header.Stop()
+
+	chunk := columnChunk{
+		offset:           w.offset,
+		numValues:        int64(len(rows)),
+		uncompressedSize: int64(len(header.Bytes()) + len(uncompressed)),
+		compressedSize:   int64(len(header.Bytes()) + len(compressed)),
+	}
+	if err := w.write(header.Bytes()); err != nil {
+		return columnChunk{}, err
+	}
+	if err := w.write(compressed); err != nil {
+		return columnChunk{}, err
+	}
+	return chunk, nil
+}
+
+// WriteFooter 写入包含所有行组的FileMetaData，之后文件是完整的
+func (w *Writer) WriteFooter() error {
+	meta := newThriftWriter()
+	meta.I32(1, 1) // version
+
+	meta.ListBegin(2, thriftStruct, len(w.columns)+1)
+	meta.BeginListStruct() // root
+	meta.String(4, "schema")
+	meta.I32(5, int32(len(w.columns)))
+	meta.EndStruct()
+	for _, column := range w.columns {
+		column.writeSchemaElement(meta)
+	}
+
+	meta.I64(3, w.numRows)
+
+	meta.ListBegin(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		meta.BeginListStruct()
+		meta.ListBegin(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			meta.BeginListStruct()
+			meta.I64(2, chunk.offset)
+			meta.BeginStruct(3) // ColumnMetaData
+			meta.I32(1, int32(w.columns[i].Type))
+			meta.ListI32(2, []int32{encodingPlain, encodingRle})
+			meta.ListString(3, []string{w.columns[i].Name})
+			meta.I32(4, int32(w.codec))
+			meta.I64(5, chunk.numValues)
+			meta.I64(6, chunk.uncompressedSize)
+			meta.I64(7, chunk.compressedSize)
+			meta.I64(9, chunk.offset)
+			meta.EndStruct()
+			meta.EndStruct()
+		}
+		meta.I64(2, group.totalSize)
+		meta.I64(3, group.numRows)
+		meta.EndStruct()
+	}
+
+	if len(w.metadata) > 0 {
+		var keys []string
+		for k := range w.metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		meta.ListBegin(5, thriftStruct, len(keys))
+		for _, k := range keys {
+			meta.BeginListStruct()
+			meta.String(1, k)
+			meta.String(2, w.metadata[k])
+			meta.EndStruct()
+		}
+	}
+	meta.String(6, createdBy)
+	meta.Stop()
+
+	footer := meta.Bytes()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, magic...)
+	return w.write(footer)
+}
+
+// encodePlain PLAIN编码一个非NULL的值
+func encodePlain(buf *bytes.Buffer, typ Type, val any) error {
+	switch typ {
+	case Int32:
+		v, ok := val.(int32)
+		if !ok {
+			return errors.Errorf("expect int32, got %T", val)
+		}
+		return binary.Write(buf, binary.LittleEndian, v)
+	case Int64:
+		v, ok := val.(int64)
+		if !ok {
+			return errors.Errorf("expect int64, got %T", val)
+		}
+		return binary.Write(buf, binary.LittleEndian, v)
+	case Float:
+		v, ok := val.(float32)
+		if !ok {
+			return errors.Errorf("expect float32, got %T", val)
+		}
+		return binary.Write(buf, binary.LittleEndian, math.Float32bits(v))
+	case Double:
+		v, ok := val.(float64)
+		if !ok {
+			return errors.Errorf("expect float64, got %T", val)
+		}
+		return binary.Write(buf, binary.LittleEndian, math.Float64bits(v))
+	case ByteArray:
+		var b []byte
+		switch v := val.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			return errors.Errorf("expect []byte or string, got %T", val)
+		}
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(b)))
+		buf.Write(b)
+		return nil
+	}
+	return errors.Errorf("unsupported type %d", typ)
+}
+
+// encodeLevels 位宽为1的RLE编码
+func encodeLevels(levels []bool) []byte {
+	var buf []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		if levels[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	return buf
+}
+
+// packBits Boolean的PLAIN编码，低位在前
+func packBits(bits []bool) []byte {
+	buf := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			buf[i/8] |= 1 << (i % 8)
+		}
+	}
+	return buf
+}
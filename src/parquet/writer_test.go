@@ -0,0 +1,340 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftFields Thrift compact protocol解码后的struct，字段ID -> 值
+//
+//	值为 bool、int64（byte、i16、i32、i64）、float64、[]byte、[]any 或者 thriftFields
+type thriftFields map[int16]any
+
+// thriftReader 测试中用于解码footer和页头，与thriftWriter独立实现
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (r *thriftReader) uvarint(t *testing.T) uint64 {
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func (r *thriftReader) zigzag(t *testing.T) int64 {
+	v := r.uvarint(t)
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) byte(t *testing.T) byte {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (r *thriftReader) readStruct(t *testing.T) thriftFields {
+	s := thriftFields{}
+	var last int16
+	for {
+		b := r.byte(t)
+		if b == 0 {
+			return s
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.zigzag(t))
+		}
+		last = id
+		s[id] = r.readValue(t, b&0x0f)
+	}
+}
+
+func (r *thriftReader) readValue(t *testing.T, typ byte) any {
+	switch typ {
+	case thriftBoolTrue:
+		return true
+	case thriftBoolFalse:
+		return false
+	case thriftByte:
+		return int64(int8(r.byte(t)))
+	case 4, thriftI32, thriftI64:
+		return r.zigzag(t)
+	case 7:
+		var buf [8]byte
+		_, _ = io.ReadFull(r.r, buf[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+	case thriftBinary:
+		buf := make([]byte, r.uvarint(t))
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	case thriftList, 10:
+		header := r.byte(t)
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint(t))
+		}
+		list := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			list = append(list, r.readValue(t, header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct(t)
+	}
+	t.Fatalf("unsupported thrift type %d", typ)
+	return nil
+}
+
+// readFile 按footer读取文件中所有行组的行，返回schema（不包括root）、key_value_metadata和行
+func readFile(t *testing.T, file []byte) ([]thriftFields, map[string]string, [][]any) {
+	if string(file[:4]) != magic || string(file[len(file)-4:]) != magic {
+		t.Fatalf("invalid magic")
+	}
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := file[len(file)-8-size : len(file)-8]
+	meta := (&thriftReader{r: bytes.NewReader(footer)}).readStruct(t)
+
+	var schema []thriftFields
+	for _, element := range meta[2].([]any)[1:] {
+		schema = append(schema, element.(thriftFields))
+	}
+	metadata := map[string]string{}
+	if kvs, ok := meta[5].([]any); ok {
+		for _, kv := range kvs {
+			metadata[string(kv.(thriftFields)[1].([]byte))] = string(kv.(thriftFields)[2].([]byte))
+		}
+	}
+
+	var rows [][]any
+	for _, g := range meta[4].([]any) {
+		group := g.(thriftFields)
+		numRows := int(group[3].(int64))
+		groupRows := make([][]any, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]any, len(schema))
+		}
+		for i, c := range group[1].([]any) {
+			chunk := c.(thriftFields)[3].(thriftFields)
+			values := readChunk(t, file, chunk, schema[i])
+			if len(values) != numRows {
+				t.Fatalf("column %d: expected %d values, got %d", i, numRows, len(values))
+			}
+			for j, v := range values {
+				groupRows[j][i] = v
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if int(meta[3].(int64)) != len(rows) {
+		t.Fatalf("num_rows is %d, but %d rows in row groups", meta[3], len(rows))
+	}
+	return schema, metadata, rows
+}
+
+// readChunk 读取一个列块的数据页，nil表示NULL
+func readChunk(t *testing.T, file []byte, chunk thriftFields, element thriftFields) []any {
+	offset := chunk[9].(int64)
+	reader := bytes.NewReader(file[offset:])
+	header := (&thriftReader{r: reader}).readStruct(t)
+	headerSize := int64(len(file[offset:])) - int64(reader.Len())
+	if header[1].(int64) != 0 {
+		t.Fatalf("expected DATA_PAGE, got %d", header[1])
+	}
+	if chunk[7].(int64) != headerSize+header[3].(int64) {
+		t.Fatalf("total_compressed_size %d, page %d", chunk[7], headerSize+header[3].(int64))
+	}
+
+	page := file[offset+headerSize : offset+headerSize+header[3].(int64)]
+	if chunk[4].(int64) == int64(Gzip) {
+		gz, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = io.ReadAll(gz); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Fatalf("uncompressed_page_size %d, got %d", header[2], len(page))
+	}
+
+	numValues := int(header[5].(thriftFields)[1].(int64))
+	defined := make([]bool, numValues)
+	for i := range defined {
+		defined[i] = true
+	}
+	if element[3].(int64) == 1 { // OPTIONAL
+		n := binary.LittleEndian.Uint32(page)
+		levels := bytes.NewReader(page[4 : 4+n])
+		page = page[4+n:]
+		for i := 0; i < numValues; {
+			run, err := binary.ReadUvarint(levels)
+			if err != nil || run&1 != 0 {
+				t.Fatalf("expected a RLE run, got %d %v", run, err)
+			}
+			value, _ := levels.ReadByte()
+			for j := 0; j < int(run>>1); j++ {
+				defined[i] = value == 1
+				i++
+			}
+		}
+	}
+
+	values := make([]any, numValues)
+	var bit int
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch Type(element[1].(int64)) {
+		case Boolean:
+			values[i] = page[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case Int32:
+			values[i] = int32(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+		case Int64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case Float:
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+		case Double:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case ByteArray:
+			n := binary.LittleEndian.Uint32(page)
+			values[i] = string(page[4 : 4+n])
+			page = page[4+n:]
+		}
+	}
+	return values
+}
+
+func testColumns() []Column {
+	return []Column{
+		{Name: "id", Type: Int64, Logical: IntegerType(64, false)},
+		{Name: "name", Type: ByteArray, Logical: StringType(), Optional: true},
+		{Name: "flag", Type: Boolean, Optional: true},
+		{Name: "day", Type: Int32, Logical: DateType(), Optional: true},
+		{Name: "ratio", Type: Float, Optional: true},
+		{Name: "amount", Type: Double, Optional: true},
+		{Name: "price", Type: ByteArray, Logical: DecimalType(10, 2), Optional: true},
+		{Name: "at", Type: Int64, Logical: TimestampType(true), Optional: true},
+	}
+}
+
+func testRows(start int64, n int) [][]any {
+	var rows [][]any
+	for i := start; i < start+int64(n); i++ {
+		row := []any{i, "name", i%2 == 0, int32(19000 + i), float32(i) / 2, float64(i) * 1.5, string([]byte{0x01, byte(i)}), i * 1000000}
+		if i%3 == 0 { // 所有可以为NULL的列
+			for j := 1; j < len(row); j++ {
+				row[j] = nil
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestWriterReadBack(t *testing.T) {
+	for _, codec := range []Codec{Uncompressed, Gzip} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, testColumns(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetMetadata("dm.table", "test_db.users")
+
+		// 每个footer之后文件都是完整的
+		var expected [][]any
+		for i, n := range []int{1, 20, 7} {
+			rows := testRows(int64(len(expected)), n)
+			if err = w.WriteRowGroup(rows); err != nil {
+				t.Fatal(err)
+			}
+			if err = w.WriteFooter(); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, rows...)
+
+			schema, metadata, actual := readFile(t, buf.Bytes())
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("codec %d, row group %d: expected %v, got %v", codec, i, expected, actual)
+			}
+			if metadata["dm.table"] != "test_db.users" {
+				t.Errorf("unexpected metadata %v", metadata)
+			}
+			for j, column := range testColumns() {
+				if string(schema[j][4].([]byte)) != column.Name {
+					t.Errorf("column %d: expected \"%s\", got \"%s\"", j, column.Name, schema[j][4])
+				}
+			}
+		}
+		if w.NumRowGroups() != 3 || w.NumRows() != 28 || w.Size() != int64(buf.Len()) {
+			t.Errorf("unexpected row groups %d, rows %d, size %d", w.NumRowGroups(), w.NumRows(), w.Size())
+		}
+	}
+}
+
+func TestWriterSchema(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, testColumns(), Uncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRowGroup(testRows(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteFooter(); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, _, _ := readFile(t, buf.Bytes())
+	// converted_type和logicalType
+	for i, expected := range []struct {
+		converted any
+		logical   int16
+	}{
+		{int64(14), 10}, // UINT_64, INTEGER
+		{int64(0), 1},   // UTF8, STRING
+		{nil, 0},
+		{int64(6), 6}, // DATE
+		{nil, 0},
+		{nil, 0},
+		{int64(5), 5},  // DECIMAL
+		{int64(10), 8}, // TIMESTAMP_MICROS, TIMESTAMP
+	} {
+		if schema[i][6] != expected.converted {
+			t.Errorf("column %d: expected converted_type %v, got %v", i, expected.converted, schema[i][6])
+		}
+		logical, ok := schema[i][10].(thriftFields)
+		if expected.logical == 0 {
+			if ok {
+				t.Errorf("column %d: unexpected logicalType %v", i, logical)
+			}
+			continue
+		}
+		if _, ok = logical[expected.logical]; !ok {
+			t.Errorf("column %d: expected logicalType %d, got %v", i, expected.logical, logical)
+		}
+	}
+	if schema[6][7] != int64(2) || schema[6][8] != int64(10) {
+		t.Errorf("expected DECIMAL(10, 2), got scale %v precision %v", schema[6][7], schema[6][8])
+	}
+	if schema[0][3] != int64(0) || schema[1][3] != int64(1) {
+		t.Errorf("unexpected repetition %v %v", schema[0][3], schema[1][3])
+	}
+}
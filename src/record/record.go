@@ -0,0 +1,159 @@
+package record
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"os"
+	"sync"
+	"time"
+)
+
+const Version = 1
+
+// Header 录制文件的头
+type Header struct {
+	Version   int
+	Host      string
+	StartedAt time.Time
+}
+
+// Entry 一次 Task.OnRow 收到的events
+type Entry struct {
+	At time.Time
+	// 首次出现的table结构，键为别名
+	Tables map[string]*schema.Table
+	Events []consumer.RowEvent
+}
+
+// Recorder 将events写入gzip压缩的gob流，每一个Entry都会flush，进程崩溃时最多丢失最后一个Entry
+type Recorder struct {
+	logger *logger.Logger
+
+	lock   sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	enc    *gob.Encoder
+	tables map[string]struct{}
+	count  uint64
+}
+
+func NewRecorder(path string, host string, logger *logger.Logger) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[Record]create \"%s\" error", path)
+	}
+
+	gz := gzip.NewWriter(file)
+	r := &Recorder{
+		logger: logger,
+		file:   file,
+		gz:     gz,
+		enc:    gob.NewEncoder(gz),
+		tables: map[string]struct{}{},
+	}
+
+	if err = r.enc.Encode(Header{Version: Version, Host: host, StartedAt: time.Now()}); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "[Record]write header of \"%s\" error", path)
+	}
+	return r, nil
+}
+
+// Write 记录一次OnRow的events，table只在第一次出现时写入
+func (r *Recorder) Write(alias string, table *schema.Table, events []consumer.RowEvent) {
+	if len(events) <= 0 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry := Entry{At: time.Now(), Events: events}
+	if _, ok := r.tables[alias]; !ok {
+		entry.Tables = map[string]*schema.Table{alias: table}
+		r.tables[alias] = struct{}{}
+	}
+
+	if err := r.enc.Encode(entry); err != nil {
+		r.logger.Error("[Record]write events error", zap.String("file", r.file.Name()), zap.Error(err))
+		return
+	}
+	if err := r.gz.Flush(); err != nil {
+		r.logger.Error("[Record]flush events error", zap.String("file", r.file.Name()), zap.Error(err))
+	}
+	r.count += uint64(len(events))
+}
+
+func (r *Recorder) Count() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.count
+}
+
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.gz.Close()
+	if _err := r.file.Close(); err == nil {
+		err = _err
+	}
+	r.logger.Info("[Record]recorder closed", zap.String("file", r.file.Name()), zap.Uint64("events", r.count))
+	return err
+}
+
+// Reader 读取录制文件
+type Reader struct {
+	Header Header
+
+	file *os.File
+	gz   *gzip.Reader
+	dec  *gob.Decoder
+}
+
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[Record]open \"%s\" error", path)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "[Record]\"%s\" is not a record file", path)
+	}
+
+	r := &Reader{file: file, gz: gz, dec: gob.NewDecoder(gz)}
+	if err = r.dec.Decode(&r.Header); err != nil {
+		_ = r.Close()
+		return nil, errors.Wrapf(err, "[Record]read header of \"%s\" error", path)
+	} else if r.Header.Version != Version {
+		_ = r.Close()
+		return nil, errors.Errorf("[Record]unsupported version %d of \"%s\"", r.Header.Version, path)
+	}
+	return r, nil
+}
+
+// Next 读取下一个Entry，读完时返回 io.EOF
+//
+//	录制时进程崩溃会导致文件被截断，此时返回 io.ErrUnexpectedEOF
+func (r *Reader) Next() (*Entry, error) {
+	var entry Entry
+	if err := r.dec.Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *Reader) Close() error {
+	err := r.gz.Close()
+	if _err := r.file.Close(); err == nil {
+		err = _err
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/script"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/dm.v1/src/sink"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RuleStats 回放时每一个rule的统计
+type RuleStats struct {
+	Rule     string
+	Events   uint64
+	Batches  uint64
+	Failures uint64
+	Duration time.Duration
+}
+
+// Replayer 将录制的events按rules分组后交给脚本执行，不会读写storage和binlog位置
+type Replayer struct {
+	*component.Components
+
+	script *script.Script
+	sinks  *sink.Manager
+	// 0表示不等待，1表示按原速，2表示2倍速
+	speed       float64
+	stopOnError bool
+
+	tablesLock sync.RWMutex
+	tables     map[string]*schema.Table
+
+	stats  map[string]*RuleStats
+	nextID uint64
+}
+
+func NewReplayer(components *component.Components, speed float64, stopOnError bool) *Replayer {
+	r := &Replayer{
+		Components:  components,
+		script:      script.NewScript(components.Settings, components.Logger),
+		speed:       speed,
+		stopOnError: stopOnError,
+		tables:      map[string]*schema.Table{},
+		stats:       map[string]*RuleStats{},
+	}
+	r.sinks = sink.NewManager(components, r.script)
+	return r
+}
+
+// Initial 编译脚本，需要在 exporter.Export 之后调用
+func (r *Replayer) Initial() error {
+	if err := r.script.Load(); err != nil {
+		return errors.WithMessagef(err, "positions: %v", script.ErrorPositions(err))
+	}
+	return nil
+}
+
+// GetTable 返回录制的table结构，用于 exporter.SetGetTableFn
+func (r *Replayer) GetTable(alias string) *schema.Table {
+	r.tablesLock.RLock()
+	defer r.tablesLock.RUnlock()
+
+	table, ok := r.tables[alias]
+	if !ok {
+		table = r.tables[common.CleanTableName(alias)]
+	}
+	return table
+}
+
+// Run 回放录制文件，直到读完或者ctx结束
+func (r *Replayer) Run(ctx context.Context, reader *Reader) error {
+	var firstAt time.Time
+	startedAt := time.Now()
+
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "[Replay]read entry error")
+		}
+
+		if firstAt.IsZero() {
+			firstAt = entry.At
+		}
+		if r.speed > 0 {
+			wait := time.Until(startedAt.Add(time.Duration(float64(entry.At.Sub(firstAt)) / r.speed)))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+
+		r.tablesLock.Lock()
+		for alias, table := range entry.Tables {
+			r.tables[alias] = table
+			r.tables[common.BuildTableName(table.Schema, table.Name, nil)] = table
+		}
+		r.tablesLock.Unlock()
+
+		if err = r.replay(ctx, entry.Events); err != nil && r.stopOnError {
+			return err
+		}
+	}
+}
+
+// replay 和 Task.consumer 一样，将连续的同一个rule的events合并为一个批次
+func (r *Replayer) replay(ctx context.Context, events []consumer.RowEvent) error {
+	var errs error
+	var lastRule *settings.RuleOptions
+	var batch []consumer.RowEvent
+
+	flush := func() {
+		if len(batch) > 0 {
+			errs = multierr.Append(errs, r.call(ctx, lastRule, batch))
+		}
+		batch = nil
+	}
+
+	for _, event := range events {
+		r.nextID++
+		event.ID = r.nextID
+
+		rule := r.Settings.TaskOptions.MatchRule(event.Schema, event.Table)
+		if rule == nil {
+			continue
+		} else if lastRule != nil && rule != lastRule {
+			flush()
+		}
+		lastRule = rule
+		batch = append(batch, event)
+	}
+	flush()
+
+	return errs
+}
+
+func (r *Replayer) call(ctx context.Context, rule *settings.RuleOptions, events []consumer.RowEvent) error {
+	stats, ok := r.stats[rule.Key()]
+	if !ok {
+		stats = &RuleStats{Rule: rule.Key()}
+		r.stats[rule.Key()] = stats
+	}
+
+	now := time.Now()
+	err := r.sinks.Write(ctx, rule, events)
+
+	stats.Duration += time.Since(now)
+	stats.Events += uint64(len(events))
+	stats.Batches++
+	if err != nil {
+		stats.Failures++
+		r.Logger.Error("[Replay]write sink error",
+			zap.String("sink", rule.SinkName()),
+			zap.Uint64("start-id", events[0].ID),
+			zap.Int("count", len(events)),
+			zap.Error(err),
+		)
+	}
+	return err
+}
+
+// Close 关闭所有的Sink，并结束常驻的解释器
+func (r *Replayer) Close(ctx context.Context) error {
+	return multierr.Append(r.sinks.Close(), r.script.Close(ctx))
+}
+
+// Stats 按rule排序的统计
+func (r *Replayer) Stats() []RuleStats {
+	var stats []RuleStats
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Rule < stats[j].Rule
+	})
+	return stats
+}
+
+func (s RuleStats) String() string {
+	return fmt.Sprintf("%s: %d events in %d batches, %d failures, %s",
+		s.Rule, s.Events, s.Batches, s.Failures, s.Duration.Round(time.Millisecond))
+}
+
+// Summary 所有rule的统计文字
+func (r *Replayer) Summary() string {
+	var lines []string
+	for _, s := range r.Stats() {
+		lines = append(lines, s.String())
+	}
+	return strings.Join(lines, "\n")
+}
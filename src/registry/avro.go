@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var avroNull = json.RawMessage("null")
+
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Doc       string      `json:"doc,omitempty"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string          `json:"name"`
+	Type    any             `json:"type"`
+	Default json.RawMessage `json:"default,omitempty"`
+	Doc     string          `json:"doc,omitempty"`
+}
+
+type avroLogical struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+	Precision   int    `json:"precision,omitempty"`
+	Scale       int    `json:"scale,omitempty"`
+}
+
+type avroArray struct {
+	Type  string `json:"type"`
+	Items string `json:"items"`
+}
+
+// Namespace Avro的namespace、Protobuf的package
+func (s *RecordSchema) Namespace() string {
+	return "dm." + FieldName(s.Schema) + "." + FieldName(s.Table)
+}
+
+// Avro 生成.avsc，记录为Envelope，其中before、after为Row：
+//
+//	id、action、before、after、diff_cols、position、commit_time（毫秒）、snapshot，
+//	Row中的字段均为 ["null", T]，默认值为null
+func (s *RecordSchema) Avro() ([]byte, error) {
+	row := avroRecord{Type: "record", Name: "Row", Fields: []avroField{}}
+	for _, f := range s.Fields {
+		row.Fields = append(row.Fields, avroField{Name: f.Name, Type: []any{"null", f.Avro.schema()}, Default: avroNull, Doc: f.RawType})
+	}
+
+	envelope := avroRecord{
+		Type:      "record",
+		Name:      "Envelope",
+		Namespace: s.Namespace(),
+		Doc:       fmt.Sprintf("%s version %d", s.Subject, s.Version),
+		Fields: []avroField{
+			{Name: "id", Type: "long"},
+			{Name: "action", Type: "string"},
+			{Name: "before", Type: []any{"null", row}, Default: avroNull},
+			{Name: "after", Type: []any{"null", "Row"}, Default: avroNull},
+			{Name: "diff_cols", Type: avroArray{Type: "array", Items: "string"}},
+			{Name: "position", Type: "string"},
+			{Name: "commit_time", Type: []any{"null", avroLogical{Type: "long", LogicalType: "timestamp-millis"}}, Default: avroNull},
+			{Name: "snapshot", Type: "boolean"},
+		},
+	}
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+func (t AvroType) schema() any {
+	if t.LogicalType == "" {
+		return t.Type
+	}
+	return avroLogical{Type: t.Type, LogicalType: t.LogicalType, Precision: t.Precision, Scale: t.Scale}
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// 新版本与上一个版本的兼容性，与Confluent Schema Registry的含义相同
+const (
+	// CompatibilityBackward 使用新版本可以读取上一个版本写入的数据
+	CompatibilityBackward = "backward"
+	// CompatibilityForward 使用上一个版本可以读取新版本写入的数据
+	CompatibilityForward = "forward"
+	// CompatibilityFull 同时满足backward和forward
+	CompatibilityFull = "full"
+	// CompatibilityNone 不检查
+	CompatibilityNone = "none"
+)
+
+// avroPromotions Avro的读取方可以将写入方的类型提升为这些类型
+var avroPromotions = map[string][]string{
+	"int":    {"long", "float", "double"},
+	"long":   {"float", "double"},
+	"float":  {"double"},
+	"string": {"bytes"},
+	"bytes":  {"string"},
+}
+
+// protoVarintTypes 使用varint编码，可以互相转换的Protobuf类型
+var protoVarintTypes = map[string]bool{"int32": true, "int64": true, "uint32": true, "uint64": true, "bool": true}
+
+// IncompatibleError 新版本与上一个版本不兼容，表结构不变时重试也不会成功
+type IncompatibleError struct {
+	Subject  string
+	Mode     string
+	Previous int
+	Version  int
+	Problems []string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("[Registry]version %d of \"%s\" is not %s compatible with version %d: %s", e.Version, e.Subject, e.Mode, e.Previous, strings.Join(e.Problems, "; "))
+}
+
+// IsIncompatible err中是否包含IncompatibleError
+func IsIncompatible(err error) bool {
+	var incompatible *IncompatibleError
+	return errors.As(err, &incompatible)
+}
+
+// CheckCompatibility 检查next相对于previous的兼容性，不兼容时返回*IncompatibleError
+//
+//	所有的列都可以为null（默认值为null），所以增加、删除列总是兼容的，只需要检查同名列的类型变化
+func CheckCompatibility(previous, next *RecordSchema, mode string) error {
+	var backward, forward bool
+	switch mode {
+	case CompatibilityNone:
+		return nil
+	case CompatibilityBackward:
+		backward = true
+	case CompatibilityForward:
+		forward = true
+	case CompatibilityFull:
+		backward, forward = true, true
+	default:
+		return errors.Errorf("[Registry]unsupported compatibility \"%s\"", mode)
+	}
+
+	fields := map[string]Field{}
+	for _, f := range previous.Fields {
+		fields[f.Column] = f
+	}
+
+	var problems []string
+	for _, f := range next.Fields {
+		old, ok := fields[f.Column]
+		if !ok {
+			continue
+		}
+		if backward && !avroReadable(old.Avro, f.Avro) || forward && !avroReadable(f.Avro, old.Avro) {
+			problems = append(problems, "column \""+f.Column+"\" changed from "+old.RawType+" to "+f.RawType)
+		} else if old.Tag == f.Tag && !protoCompatible(old.Proto, f.Proto) {
+			problems = append(problems, "column \""+f.Column+"\" changed from proto "+old.Proto+" to "+f.Proto)
+		}
+	}
+	if len(problems) > 0 {
+		return &IncompatibleError{Subject: next.Subject, Mode: mode, Previous: previous.Version, Version: next.Version, Problems: problems}
+	}
+	return nil
+}
+
+// avroReadable reader是否可以读取writer写入的值，逻辑类型必须相同
+func avroReadable(writer, reader AvroType) bool {
+	if writer == reader {
+		return true
+	}
+	if writer.LogicalType != "" || reader.LogicalType != "" {
+		return false
+	}
+	for _, t := range avroPromotions[writer.Type] {
+		if t == reader.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// protoCompatible 两个Protobuf类型是否可以使用同一个字段编号
+func protoCompatible(a, b string) bool {
+	if a == b || protoVarintTypes[a] && protoVarintTypes[b] {
+		return true
+	}
+	return (a == "string" || a == "bytes") && (b == "string" || b == "bytes")
+}
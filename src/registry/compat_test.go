@@ -0,0 +1,85 @@
+package registry
+
+import (
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"testing"
+)
+
+func testTable(columns ...consumer.TableColumn) *consumer.Table {
+	return &consumer.Table{Schema: "test_db", Name: "users", Columns: columns}
+}
+
+func testColumn(name string, typ int, rawType string) consumer.TableColumn {
+	return consumer.TableColumn{Name: name, Type: typ, RawType: rawType}
+}
+
+var (
+	columnID       = testColumn("id", consumer.TYPE_NUMBER, "int(11)")
+	columnBigintID = testColumn("id", consumer.TYPE_NUMBER, "bigint(20)")
+	columnName     = testColumn("name", consumer.TYPE_STRING, "varchar(20)")
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		previous *consumer.Table
+		next     *consumer.Table
+		// backward、forward、full是否兼容
+		backward, forward, full bool
+	}{
+		{"add column", testTable(columnID), testTable(columnID, columnName), true, true, true},
+		{"drop column", testTable(columnID, columnName), testTable(columnID), true, true, true},
+		{"int to bigint", testTable(columnID), testTable(columnBigintID), true, false, false},
+		{"bigint to int", testTable(columnBigintID), testTable(columnID), false, true, false},
+		{"varchar to text", testTable(columnName), testTable(testColumn("name", consumer.TYPE_STRING, "text")), true, true, true},
+		{"varchar to blob", testTable(columnName), testTable(testColumn("name", consumer.TYPE_STRING, "blob")), true, true, true},
+		// Protobuf中使用新的字段编号
+		{"float to double", testTable(testColumn("ratio", consumer.TYPE_FLOAT, "float")), testTable(testColumn("ratio", consumer.TYPE_FLOAT, "double")), true, false, false},
+		{"int to varchar", testTable(columnID), testTable(testColumn("id", consumer.TYPE_STRING, "varchar(20)")), false, false, false},
+		{"decimal precision", testTable(testColumn("amount", consumer.TYPE_DECIMAL, "decimal(10,2)")), testTable(testColumn("amount", consumer.TYPE_DECIMAL, "decimal(12,2)")), false, false, false},
+		{"datetime to timestamp", testTable(testColumn("at", consumer.TYPE_DATETIME, "datetime")), testTable(testColumn("at", consumer.TYPE_TIMESTAMP, "timestamp")), false, false, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			previous := newRecordSchema(c.previous, nil)
+			next := newRecordSchema(c.next, previous)
+			for mode, compatible := range map[string]bool{CompatibilityBackward: c.backward, CompatibilityForward: c.forward, CompatibilityFull: c.full, CompatibilityNone: true} {
+				err := CheckCompatibility(previous, next, mode)
+				if compatible && err != nil {
+					t.Errorf("expected %s compatible, got %s", mode, err)
+				} else if !compatible && !IsIncompatible(err) {
+					t.Errorf("expected %s incompatible, got %v", mode, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCompatibilityMode(t *testing.T) {
+	previous := newRecordSchema(testTable(columnID), nil)
+	err := CheckCompatibility(previous, newRecordSchema(testTable(columnID), previous), "transitive")
+	if err == nil || IsIncompatible(err) {
+		t.Errorf("expected an error of the unsupported mode, got %v", err)
+	}
+}
+
+func TestNewRecordSchemaTags(t *testing.T) {
+	v1 := newRecordSchema(testTable(columnID, columnName), nil)
+	// 删除name，id的Protobuf类型兼容，增加age
+	v2 := newRecordSchema(testTable(columnBigintID, testColumn("age", consumer.TYPE_NUMBER, "int(11)")), v1)
+	// 再次增加name，不能使用已经保留的tag
+	v3 := newRecordSchema(testTable(columnBigintID, columnName), v2)
+
+	tags := func(s *RecordSchema) map[string]int {
+		m := map[string]int{}
+		for _, f := range s.Fields {
+			m[f.Column] = f.Tag
+		}
+		return m
+	}
+	if m := tags(v2); m["id"] != 1 || m["age"] != 3 || len(v2.Reserved) != 1 || v2.Reserved[0].Tag != 2 {
+		t.Errorf("unexpected v2 tags %v, reserved %v", m, v2.Reserved)
+	}
+	if m := tags(v3); m["id"] != 1 || m["name"] != 4 || v3.Version != 3 {
+		t.Errorf("unexpected v3 tags %v, version %d", m, v3.Version)
+	}
+}
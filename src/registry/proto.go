@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Proto 生成.proto（proto3），Envelope是文件中的第一个消息，Row中的字段均为optional，
+// 字段的含义与 Avro 相同，DATE为天数，TIME、DATETIME、TIMESTAMP为微秒，DECIMAL为字符串
+func (s *RecordSchema) Proto() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "// %s version %d, schema id %d, generated by dm\n", s.Subject, s.Version, s.ID)
+	sb.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(sb, "package %s;\n\n", s.Namespace())
+
+	sb.WriteString("message Envelope {\n")
+	sb.WriteString("  uint64 id = 1;\n")
+	sb.WriteString("  string action = 2;\n")
+	sb.WriteString("  Row before = 3;\n")
+	sb.WriteString("  Row after = 4;\n")
+	sb.WriteString("  repeated string diff_cols = 5;\n")
+	sb.WriteString("  string position = 6;\n")
+	sb.WriteString("  int64 commit_time = 7; // milliseconds, 0 if unknown\n")
+	sb.WriteString("  bool snapshot = 8;\n")
+	sb.WriteString("}\n\n")
+
+	sb.WriteString("message Row {\n")
+	if tags, names := s.reserved(); len(tags) > 0 {
+		fmt.Fprintf(sb, "  reserved %s;\n", strings.Join(tags, ", "))
+		if len(names) > 0 {
+			fmt.Fprintf(sb, "  reserved %s;\n", strings.Join(names, ", "))
+		}
+	}
+	for _, f := range s.Fields {
+		fmt.Fprintf(sb, "  optional %s %s = %d; // %s\n", f.Proto, f.Name, f.Tag, f.RawType)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// reserved 不再使用的tag，以及没有被当前字段使用的名称
+func (s *RecordSchema) reserved() ([]string, []string) {
+	current := map[string]bool{}
+	for _, f := range s.Fields {
+		current[f.Name] = true
+	}
+
+	var tags []int
+	var names []string
+	seen := map[string]bool{}
+	for _, f := range s.Reserved {
+		tags = append(tags, f.Tag)
+		if !current[f.Name] && !seen[f.Name] {
+			seen[f.Name] = true
+			names = append(names, strconv.Quote(f.Name))
+		}
+	}
+	sort.Ints(tags)
+
+	_tags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		_tags = append(_tags, strconv.Itoa(tag))
+	}
+	return _tags, names
+}
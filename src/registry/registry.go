@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Registry 基于本地文件的schema registry，每个表的每个版本保存为 {dir}/{schema}.{table}/v{version}.json
+type Registry struct {
+	options settings.SchemaRegistryOptions
+	logger  *logger.Logger
+
+	lock     sync.RWMutex
+	subjects map[string][]*RecordSchema
+	ids      map[uint32]*RecordSchema
+	nextID   uint32
+}
+
+// NewRegistry 读取dir中已有的版本，dir不存在时在第一次注册时创建
+func NewRegistry(options settings.SchemaRegistryOptions, logger *logger.Logger) (*Registry, error) {
+	r := &Registry{
+		options:  options,
+		logger:   logger,
+		subjects: map[string][]*RecordSchema{},
+		ids:      map[uint32]*RecordSchema{},
+		nextID:   1,
+	}
+
+	files, err := filepath.Glob(filepath.Join(options.Dir, "*", "v*.json"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[Registry]read schema \"%s\" error", file)
+		}
+		s := &RecordSchema{}
+		if err = json.Unmarshal(buf, s); err != nil {
+			return nil, errors.Wrapf(err, "[Registry]decode schema \"%s\" error", file)
+		}
+		r.add(s)
+	}
+	for _, versions := range r.subjects {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return r, nil
+}
+
+func (r *Registry) add(s *RecordSchema) {
+	r.subjects[s.Subject] = append(r.subjects[s.Subject], s)
+	r.ids[s.ID] = s
+	if s.ID >= r.nextID {
+		r.nextID = s.ID + 1
+	}
+}
+
+// Register 返回表的列结构对应的版本，没有时从最新的版本派生一个新的版本，
+// 新版本需要通过兼容性检查，参见 CheckCompatibility
+func (r *Registry) Register(table *consumer.Table) (*RecordSchema, error) {
+	subject := Subject(table.Schema, table.Name)
+	fingerprint := Fingerprint(table)
+
+	r.lock.RLock()
+	s := r.find(subject, fingerprint)
+	r.lock.RUnlock()
+	if s != nil {
+		return s, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s = r.find(subject, fingerprint); s != nil {
+		return s, nil
+	}
+
+	var previous *RecordSchema
+	if versions := r.subjects[subject]; len(versions) > 0 {
+		previous = versions[len(versions)-1]
+	}
+	s = newRecordSchema(table, previous)
+	s.ID = r.nextID
+	if previous != nil {
+		if err := CheckCompatibility(previous, s, r.options.Compatibility); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.save(s); err != nil {
+		return nil, err
+	}
+	r.add(s)
+
+	r.logger.Info("[Registry]schema version registered", zap.String("subject", subject), zap.Int("version", s.Version), zap.Uint32("id", s.ID))
+	return s, nil
+}
+
+func (r *Registry) find(subject, fingerprint string) *RecordSchema {
+	for _, s := range r.subjects[subject] {
+		if s.Fingerprint == fingerprint {
+			return s
+		}
+	}
+	return nil
+}
+
+// save 先写入临时文件再改名，避免写入一半的文件
+func (r *Registry) save(s *RecordSchema) error {
+	dir := filepath.Join(r.options.Dir, s.Subject)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "[Registry]create dir \"%s\" error", dir)
+	}
+
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file := filepath.Join(dir, fmt.Sprintf("v%d.json", s.Version))
+	if err = os.WriteFile(file+".tmp", buf, 0o644); err != nil {
+		return errors.Wrapf(err, "[Registry]write schema \"%s\" error", file)
+	}
+	return errors.Wrapf(os.Rename(file+".tmp", file), "[Registry]write schema \"%s\" error", file)
+}
+
+// Subjects 所有的 schema.table
+func (r *Registry) Subjects() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Versions subject的所有版本，按版本号排序
+func (r *Registry) Versions(subject string) []*RecordSchema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]*RecordSchema(nil), r.subjects[subject]...)
+}
+
+// GetByID 消息头部的schema id对应的版本
+func (r *Registry) GetByID(id uint32) *RecordSchema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.ids[id]
+}
@@ -0,0 +1,53 @@
+package registry
+
+import (
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T, dir string) *Registry {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRegistry(settings.SchemaRegistryOptions{Enabled: true, Dir: dir, Compatibility: CompatibilityBackward}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegister(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRegistry(t, dir)
+
+	v1, err := r.Register(testTable(columnID, columnName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相同的列结构使用同一个版本
+	if s, err := r.Register(testTable(columnID, columnName)); err != nil || s != v1 {
+		t.Errorf("expected version 1, got %v %v", s, err)
+	}
+	v2, err := r.Register(testTable(columnBigintID, columnName))
+	if err != nil || v2.Version != 2 || v2.ID != v1.ID+1 {
+		t.Fatalf("expected version 2, got %+v %v", v2, err)
+	}
+
+	// 不兼容的版本不会保存
+	_, err = r.Register(testTable(testColumn("id", consumer.TYPE_STRING, "varchar(20)"), columnName))
+	if !IsIncompatible(err) {
+		t.Fatalf("expected an IncompatibleError, got %v", err)
+	}
+
+	reopened := newTestRegistry(t, dir)
+	versions := reopened.Versions("test_db.users")
+	if len(versions) != 2 || versions[1].Fingerprint != v2.Fingerprint {
+		t.Errorf("expected 2 versions, got %v", versions)
+	}
+	if s := reopened.GetByID(v2.ID); s == nil || s.Version != 2 {
+		t.Errorf("expected version 2 of id %d, got %v", v2.ID, s)
+	}
+}
@@ -0,0 +1,245 @@
+package registry
+
+import (
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 列的种类，决定了Avro、Protobuf中的类型以及值的转换方式
+const (
+	KindInt       = "int"
+	KindUint      = "uint"
+	KindFloat     = "float"
+	KindDouble    = "double"
+	KindDecimal   = "decimal"
+	KindDate      = "date"
+	KindTime      = "time"
+	KindDatetime  = "datetime"
+	KindTimestamp = "timestamp"
+	KindEnum      = "enum"
+	KindSet       = "set"
+	KindBool      = "bool"
+	KindBit       = "bit"
+	KindBytes     = "bytes"
+	KindString    = "string"
+)
+
+var (
+	invalidNameRegexp    = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	decimalRawTypeRegexp = regexp.MustCompile(`^decimal\((\d+),\s*(\d+)\)`)
+)
+
+// RecordSchema 表的某个列结构对应的记录的schema，同一个表的每个版本保存为一个文件
+type RecordSchema struct {
+	// 全局唯一，写在消息的头部
+	ID      uint32 `json:"id"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	// 列名和类型的md5，与storage中表的别名相同
+	Fingerprint string    `json:"fingerprint"`
+	Fields      []Field   `json:"fields"`
+	Reserved    []Field   `json:"reserved,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Field 一个列，Tag为Protobuf的字段编号，同名的列在各个版本中保持不变
+type Field struct {
+	Name    string   `json:"name"`
+	Column  string   `json:"column"`
+	RawType string   `json:"raw_type"`
+	Kind    string   `json:"kind"`
+	Tag     int      `json:"tag"`
+	Avro    AvroType `json:"avro"`
+	Proto   string   `json:"proto"`
+}
+
+// AvroType Avro的基本类型和逻辑类型
+type AvroType struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logical_type,omitempty"`
+	Precision   int    `json:"precision,omitempty"`
+	Scale       int    `json:"scale,omitempty"`
+}
+
+// Subject 即 schema.table
+func Subject(schema, table string) string {
+	return schema + "." + table
+}
+
+// Fingerprint 与 common.BuildTableName 相同的列结构的md5
+func Fingerprint(table *consumer.Table) string {
+	sb := strings.Builder{}
+	for _, column := range table.Columns {
+		sb.WriteString(column.Name)
+		sb.WriteString(",")
+		sb.WriteString(column.RawType)
+		sb.WriteString("|")
+	}
+	return text_utils.Md5(sb.String())
+}
+
+// Kind 列的种类，BLOB、TEXT的列类型均为TYPE_STRING，所以按RawType区分
+func Kind(column consumer.TableColumn) string {
+	rawType := strings.ToLower(column.RawType)
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT:
+		if column.IsUnsigned && !strings.HasPrefix(rawType, "year") {
+			return KindUint
+		}
+		return KindInt
+	case consumer.TYPE_FLOAT:
+		if strings.HasPrefix(rawType, "float") {
+			return KindFloat
+		}
+		return KindDouble
+	case consumer.TYPE_DECIMAL:
+		return KindDecimal
+	case consumer.TYPE_DATE:
+		return KindDate
+	case consumer.TYPE_TIME:
+		return KindTime
+	case consumer.TYPE_DATETIME:
+		return KindDatetime
+	case consumer.TYPE_TIMESTAMP:
+		return KindTimestamp
+	case consumer.TYPE_ENUM:
+		return KindEnum
+	case consumer.TYPE_SET:
+		return KindSet
+	case consumer.TYPE_BIT:
+		if bitLength(rawType) == 1 {
+			return KindBool
+		}
+		return KindBit
+	case consumer.TYPE_BINARY, consumer.TYPE_POINT:
+		return KindBytes
+	}
+	if strings.Contains(rawType, "blob") || strings.Contains(rawType, "binary") {
+		return KindBytes
+	}
+	return KindString
+}
+
+// NewField 列对应的字段，tag由调用者分配
+//
+//	bigint unsigned在Avro中为decimal(20,0)，Protobuf中为uint64；
+//	DATETIME为字面值当作UTC的微秒，TIMESTAMP为UTC的微秒
+func NewField(column consumer.TableColumn, tag int) Field {
+	rawType := strings.ToLower(column.RawType)
+	f := Field{Name: FieldName(column.Name), Column: column.Name, RawType: column.RawType, Kind: Kind(column), Tag: tag}
+	switch f.Kind {
+	case KindInt:
+		f.Avro.Type, f.Proto = "int", "int32"
+		if strings.HasPrefix(rawType, "bigint") {
+			f.Avro.Type, f.Proto = "long", "int64"
+		}
+	case KindUint:
+		f.Avro.Type, f.Proto = "int", "uint32"
+		if strings.HasPrefix(rawType, "int") {
+			f.Avro.Type = "long"
+		} else if strings.HasPrefix(rawType, "bigint") {
+			f.Avro, f.Proto = AvroType{Type: "bytes", LogicalType: "decimal", Precision: 20}, "uint64"
+		}
+	case KindFloat:
+		f.Avro.Type, f.Proto = "float", "float"
+	case KindDouble:
+		f.Avro.Type, f.Proto = "double", "double"
+	case KindDecimal:
+		f.Avro, f.Proto = AvroType{Type: "bytes", LogicalType: "decimal", Precision: 10}, "string"
+		if matches := decimalRawTypeRegexp.FindStringSubmatch(rawType); matches != nil {
+			f.Avro.Precision, _ = strconv.Atoi(matches[1])
+			f.Avro.Scale, _ = strconv.Atoi(matches[2])
+		}
+	case KindDate:
+		f.Avro, f.Proto = AvroType{Type: "int", LogicalType: "date"}, "int32"
+	case KindTime:
+		f.Avro, f.Proto = AvroType{Type: "long", LogicalType: "time-micros"}, "int64"
+	case KindDatetime:
+		f.Avro, f.Proto = AvroType{Type: "long", LogicalType: "local-timestamp-micros"}, "int64"
+	case KindTimestamp:
+		f.Avro, f.Proto = AvroType{Type: "long", LogicalType: "timestamp-micros"}, "int64"
+	case KindBool:
+		f.Avro.Type, f.Proto = "boolean", "bool"
+	case KindBit:
+		f.Avro.Type, f.Proto = "long", "uint64"
+	case KindBytes:
+		f.Avro.Type, f.Proto = "bytes", "bytes"
+	default: // enum、set、json、字符串
+		f.Avro.Type, f.Proto = "string", "string"
+	}
+	return f
+}
+
+// newRecordSchema 从previous派生新的版本：同名且Protobuf类型兼容的列沿用tag，
+// 其它的列使用新的tag，不再使用的tag保留在Reserved中
+func newRecordSchema(table *consumer.Table, previous *RecordSchema) *RecordSchema {
+	s := &RecordSchema{
+		Subject:     Subject(table.Schema, table.Name),
+		Version:     1,
+		Schema:      table.Schema,
+		Table:       table.Name,
+		Fingerprint: Fingerprint(table),
+		CreatedAt:   time.Now(),
+	}
+
+	maxTag := 0
+	tags := map[string]Field{}
+	if previous != nil {
+		s.Version = previous.Version + 1
+		s.Reserved = append(s.Reserved, previous.Reserved...)
+		for _, f := range append(append([]Field{}, previous.Fields...), previous.Reserved...) {
+			if f.Tag > maxTag {
+				maxTag = f.Tag
+			}
+		}
+		for _, f := range previous.Fields {
+			tags[f.Column] = f
+		}
+	}
+
+	used := map[int]bool{}
+	for _, column := range table.Columns {
+		field := NewField(column, 0)
+		if old, ok := tags[column.Name]; ok && protoCompatible(old.Proto, field.Proto) {
+			field.Tag = old.Tag
+		} else {
+			maxTag++
+			field.Tag = maxTag
+		}
+		used[field.Tag] = true
+		s.Fields = append(s.Fields, field)
+	}
+	if previous != nil {
+		for _, f := range previous.Fields {
+			if !used[f.Tag] {
+				s.Reserved = append(s.Reserved, f)
+			}
+		}
+	}
+	return s
+}
+
+// FieldName 转为Avro、Protobuf可用的名称：[A-Za-z_][A-Za-z0-9_]*
+func FieldName(name string) string {
+	name = invalidNameRegexp.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// bitLength BIT(n)的n，默认为1
+func bitLength(rawType string) int {
+	if _, after, ok := strings.Cut(rawType, "("); ok {
+		if n, err := strconv.Atoi(strings.TrimSuffix(after, ")")); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
@@ -0,0 +1,344 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateLayout  = "20060102T150405Z"
+	amzShortLayout = "20060102"
+)
+
+// Options S3兼容的对象存储，使用path-style的地址：endpoint/bucket/key
+type Options struct {
+	// 比如 "https://s3.us-east-1.amazonaws.com" 或者 "http://127.0.0.1:9000"
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// 为空时使用环境变量 AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY AWS_SESSION_TOKEN
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+}
+
+// Client 只实现了上传需要的接口，使用Signature Version 4签名
+type Client struct {
+	options  Options
+	endpoint *url.URL
+	http     *http.Client
+	now      func() time.Time
+}
+
+// Error S3返回的错误
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[S3]status %d, %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable 5xx、429以及SlowDown等可以重试，CompleteMultipartUpload返回200时的InternalError也可以重试
+func (e *Error) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.Code == "SlowDown" || e.Code == "RequestTimeout" || e.Code == "InternalError"
+}
+
+// Part 分段上传中已经上传的分段
+type Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// ObjectInfo HeadObject的结果
+type ObjectInfo struct {
+	Size int64
+	ETag string
+}
+
+// NewClient httpClient为nil时使用http.DefaultClient，凭证为空时读取环境变量
+func NewClient(options Options, httpClient *http.Client) (*Client, error) {
+	if options.Endpoint == "" || options.Bucket == "" {
+		return nil, errors.New("[S3]endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(options.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.Errorf("[S3]invalid endpoint \"%s\"", options.Endpoint)
+	}
+
+	if options.AccessKeyID == "" {
+		options.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		options.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		options.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if options.AccessKeyID == "" || options.SecretAccessKey == "" {
+		return nil, errors.New("[S3]credentials are required, set access_key_id/secret_access_key or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY")
+	}
+	if options.Region == "" {
+		if options.Region = os.Getenv("AWS_REGION"); options.Region == "" {
+			options.Region = "us-east-1"
+		}
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{options: options, endpoint: endpoint, http: httpClient, now: time.Now}, nil
+}
+
+func (c *Client) Bucket() string {
+	return c.options.Bucket
+}
+
+// PutObject 单次上传，返回ETag
+func (c *Client) PutObject(ctx context.Context, key string, body []byte) (string, error) {
+	sum := md5.Sum(body)
+	res, err := c.do(ctx, http.MethodPut, key, nil, body, map[string]string{"Content-MD5": base64MD5(sum[:])})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	return res.Header.Get("ETag"), nil
+}
+
+// CreateMultipartUpload 开始分段上传，返回UploadId
+func (c *Client) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	res, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err = xml.NewDecoder(res.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", errors.Errorf("[S3]invalid response of CreateMultipartUpload \"%s\"", key)
+	}
+	return result.UploadID, nil
+}
+
+// UploadPart 上传一个分段，partNumber从1开始
+func (c *Client) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body []byte) (Part, error) {
+	sum := md5.Sum(body)
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	res, err := c.do(ctx, http.MethodPut, key, query, body, map[string]string{"Content-MD5": base64MD5(sum[:])})
+	if err != nil {
+		return Part{}, err
+	}
+	defer res.Body.Close()
+	return Part{PartNumber: partNumber, ETag: res.Header.Get("ETag")}, nil
+}
+
+// CompleteMultipartUpload 完成分段上传，返回ETag
+func (c *Client) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (string, error) {
+	body, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []Part   `xml:"Part"`
+	}{Parts: parts})
+
+	res, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	// 状态码为200时也可能返回错误
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "[S3]read response of CompleteMultipartUpload \"%s\" error", key)
+	}
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err = xml.Unmarshal(buf, &result); err != nil {
+		return "", errors.Wrapf(err, "[S3]invalid response of CompleteMultipartUpload \"%s\"", key)
+	}
+	if result.XMLName.Local == "Error" {
+		return "", &Error{StatusCode: res.StatusCode, Code: result.Code, Message: result.Message}
+	}
+	return result.ETag, nil
+}
+
+// AbortMultipartUpload 放弃分段上传，删除已经上传的分段
+func (c *Client) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	res, err := c.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// HeadObject 返回对象的大小和ETag
+func (c *Client) HeadObject(ctx context.Context, key string) (ObjectInfo, error) {
+	res, err := c.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer res.Body.Close()
+	return ObjectInfo{Size: res.ContentLength, ETag: res.Header.Get("ETag")}, nil
+}
+
+// do 签名并发送请求，非2xx时返回*Error
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = c.endpoint.Path + "/" + c.options.Bucket + "/" + strings.TrimLeft(key, "/")
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	c.sign(req, body)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[S3]%s \"%s\" error", method, key)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		defer res.Body.Close()
+		e := &Error{StatusCode: res.StatusCode}
+		buf, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		_ = xml.Unmarshal(buf, e)
+		if e.Code == "" {
+			e.Code = http.StatusText(res.StatusCode)
+		}
+		return nil, e
+	}
+	return res, nil
+}
+
+// sign Signature Version 4，https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (c *Client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateLayout))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.options.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.options.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format(amzShortLayout) + "/" + c.options.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(amzDateLayout) + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.options.SecretAccessKey), now.Format(amzShortLayout))
+	key = hmacSHA256(key, c.options.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.options.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// MultipartETag 分段上传的ETag：所有分段MD5拼接后的MD5，加上 "-分段数"
+func MultipartETag(partMD5s [][]byte) string {
+	h := md5.New()
+	for _, sum := range partMD5s {
+		h.Write(sum)
+	}
+	return fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(h.Sum(nil)), len(partMD5s))
+}
+
+// canonicalQuery 按key排序，使用RFC 3986的编码
+func canonicalQuery(query url.Values) string {
+	if len(query) <= 0 {
+		return ""
+	}
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escapePath 按段编码，保留 "/"
+func escapePath(path string) string {
+	return uriEncode(path, false)
+}
+
+// uriEncode 只保留 A-Z a-z 0-9 - _ . ~
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return sb.String()
+}
+
+func base64MD5(sum []byte) string {
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(Options{Endpoint: server.URL, Bucket: "dm", AccessKeyID: "AKID", SecretAccessKey: "secret"}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return c
+}
+
+// checkSigned 请求带有签名需要的头
+func checkSigned(t *testing.T, r *http.Request, body []byte) {
+	if r.Header.Get("X-Amz-Date") != "20260102T030405Z" {
+		t.Errorf("unexpected X-Amz-Date \"%s\"", r.Header.Get("X-Amz-Date"))
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		t.Errorf("unexpected X-Amz-Content-Sha256 \"%s\"", r.Header.Get("X-Amz-Content-Sha256"))
+	}
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260102/us-east-1/s3/aws4_request, SignedHeaders=") {
+		t.Errorf("unexpected Authorization \"%s\"", auth)
+	}
+}
+
+func TestClientPutObject(t *testing.T) {
+	body := []byte("hello")
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut || r.URL.EscapedPath() != "/dm/logs/a%20b.log" || string(buf) != "hello" {
+			t.Errorf("unexpected request %s %s %q", r.Method, r.URL.EscapedPath(), buf)
+		}
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			t.Errorf("unexpected Content-MD5 \"%s\"", r.Header.Get("Content-MD5"))
+		}
+		checkSigned(t, r, buf)
+		w.Header().Set("ETag", "\""+hex.EncodeToString(sum[:])+"\"")
+	})
+
+	etag, err := c.PutObject(context.Background(), "/logs/a b.log", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "\"5d41402abc4b2a76b9719d911017c592\"" {
+		t.Errorf("unexpected ETag %s", etag)
+	}
+}
+
+func TestClientMultipartUpload(t *testing.T) {
+	var completed []Part
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		checkSigned(t, r, buf)
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut && query.Get("uploadId") == "upload-1":
+			w.Header().Set("ETag", "\"etag-"+query.Get("partNumber")+"\"")
+		case r.Method == http.MethodPost && query.Get("uploadId") == "upload-1":
+			var request struct {
+				Parts []Part `xml:"Part"`
+			}
+			if err := xml.Unmarshal(buf, &request); err != nil {
+				t.Error(err)
+			}
+			completed = request.Parts
+			_, _ = w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"abc-2"</ETag></CompleteMultipartUploadResult>`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	ctx := context.Background()
+	uploadID, err := c.CreateMultipartUpload(ctx, "a.log")
+	if err != nil || uploadID != "upload-1" {
+		t.Fatalf("unexpected upload id %s %v", uploadID, err)
+	}
+	var parts []Part
+	for number, body := range []string{"part1", "part2"} {
+		part, err := c.UploadPart(ctx, "a.log", uploadID, number+1, []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part)
+	}
+	etag, err := c.CompleteMultipartUpload(ctx, "a.log", uploadID, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "\"abc-2\"" {
+		t.Errorf("unexpected ETag %s", etag)
+	}
+	if len(completed) != 2 || completed[1].PartNumber != 2 || completed[1].ETag != "\"etag-2\"" {
+		t.Errorf("unexpected parts %v", completed)
+	}
+}
+
+func TestClientCompleteError(t *testing.T) {
+	// 状态码为200，但是响应是 <Error>
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>`))
+	})
+
+	_, err := c.CompleteMultipartUpload(context.Background(), "a.log", "upload-1", []Part{{PartNumber: 1, ETag: "\"etag-1\""}})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if e.StatusCode != http.StatusOK || e.Code != "InternalError" || !e.Retryable() {
+		t.Errorf("unexpected error %v, retryable %v", e, e.Retryable())
+	}
+}
+
+func TestClientError(t *testing.T) {
+	for _, c := range []struct {
+		status    int
+		body      string
+		code      string
+		retryable bool
+	}{
+		{http.StatusServiceUnavailable, `<Error><Code>SlowDown</Code><Message>Reduce your request rate.</Message></Error>`, "SlowDown", true},
+		{http.StatusInternalServerError, "", "Internal Server Error", true},
+		{http.StatusForbidden, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`, "AccessDenied", false},
+	} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			_, _ = w.Write([]byte(c.body))
+		})
+
+		_, err := client.PutObject(context.Background(), "a.log", []byte("hello"))
+		e, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("expected *Error, got %v", err)
+		}
+		if e.StatusCode != c.status || e.Code != c.code || e.Retryable() != c.retryable {
+			t.Errorf("unexpected error %v, retryable %v", e, e.Retryable())
+		}
+	}
+}
+
+func TestMultipartETag(t *testing.T) {
+	a, b := md5.Sum([]byte("part1")), md5.Sum([]byte("part2"))
+	expected := md5.Sum(append(a[:], b[:]...))
+	if etag := MultipartETag([][]byte{a[:], b[:]}); etag != "\""+hex.EncodeToString(expected[:])+"-2\"" {
+		t.Errorf("unexpected ETag %s", etag)
+	}
+}
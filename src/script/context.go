@@ -0,0 +1,51 @@
+package script
+
+import (
+	"context"
+	"github.com/goplus/igop"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/igop.v1/mod"
+)
+
+// acceptsContext 脚本函数的第一个参数是否为 context.Context
+func acceptsContext(ctx *mod.Context, method string) bool {
+	fn := ctx.GetMainPackage().Func(method)
+	if fn == nil {
+		return false
+	}
+	params := fn.Signature.Params()
+	return params.Len() > 0 && params.At(0).Type().String() == "context.Context"
+}
+
+// callArgs 构造call的参数：(ctx?, events, arguments)
+func callArgs(ctx context.Context, modCtx *mod.Context, method string, events []consumer.RowEvent, arguments []string) []igop.Value {
+	args := []igop.Value{events, arguments}
+	if acceptsContext(modCtx, method) {
+		args = append([]igop.Value{ctx}, args...)
+	}
+	return args
+}
+
+// runWithContext 在新的goroutine中执行fn，ctx结束时放弃等待并返回错误
+//
+//	igop无法中断正在运行的函数，被放弃的goroutine会在后台继续运行直到结束
+func runWithContext(ctx context.Context, fn func() (igop.Value, error)) (igop.Value, error) {
+	type result struct {
+		v   igop.Value
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "[igop]call abandoned")
+	}
+}
@@ -0,0 +1,242 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"github.com/goplus/igop"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/exporter"
+	"gopkg.in/go-mixed/go-common.v1/conf.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gopkg.in/go-mixed/igop.v1/mod"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fixture 脚本测试的夹具文件，JSON/YAML格式
+type Fixture struct {
+	// 默认的call和arguments，case中可以覆盖
+	Call      string   `yaml:"call"`
+	Arguments []string `yaml:"arguments"`
+
+	Cases []*FixtureCase `yaml:"cases" validate:"required,gt=0,dive"`
+}
+
+type FixtureCase struct {
+	Name      string   `yaml:"name" validate:"required"`
+	Call      string   `yaml:"call"`
+	Arguments []string `yaml:"arguments"`
+
+	// 执行前Redis/Etcd中的KV
+	Redis map[string]string `yaml:"redis"`
+	Etcd  map[string]string `yaml:"etcd"`
+
+	Events []FixtureEvent `yaml:"events" validate:"required,gt=0,dive"`
+	Expect FixtureExpect  `yaml:"expect"`
+}
+
+type FixtureEvent struct {
+	Schema   string         `yaml:"schema" validate:"required"`
+	Table    string         `yaml:"table" validate:"required"`
+	Action   string         `yaml:"action" validate:"required,oneof=insert update delete"`
+	OldRow   map[string]any `yaml:"old_row"`
+	NewRow   map[string]any `yaml:"new_row"`
+	DiffCols []string       `yaml:"diff_cols"`
+}
+
+// FixtureExpect 执行后的断言，Redis/Etcd中值为null的key表示必须不存在
+type FixtureExpect struct {
+	// 期望错误包含的文字，为空表示不能有错误
+	Error string `yaml:"error"`
+
+	Redis map[string]*string `yaml:"redis"`
+	Etcd  map[string]*string `yaml:"etcd"`
+	// 日志中必须包含的文字
+	Logs []string `yaml:"logs"`
+}
+
+// CaseResult 单个case的执行结果
+type CaseResult struct {
+	File     string
+	Name     string
+	Failures []string
+	Logs     []string
+	Duration time.Duration
+}
+
+func (r CaseResult) Passed() bool {
+	return len(r.Failures) <= 0
+}
+
+func LoadFixture(file string) (*Fixture, error) {
+	fixture := &Fixture{}
+	if err := conf.LoadSettings(fixture, file); err != nil {
+		return nil, errors.Wrapf(err, "[Script]load fixture \"%s\" error", file)
+	}
+	for _, c := range fixture.Cases {
+		if c.Call == "" {
+			c.Call = fixture.Call
+		}
+		if c.Arguments == nil {
+			c.Arguments = fixture.Arguments
+		}
+		if c.Call == "" {
+			return nil, errors.Errorf("[Script]fixture \"%s\" case \"%s\" has no call", file, c.Name)
+		}
+	}
+	return fixture, nil
+}
+
+// ToRowEvents 转为脚本接收的events，update未指定diff_cols时自动计算
+func (c *FixtureCase) ToRowEvents() []consumer.RowEvent {
+	var events []consumer.RowEvent
+	for i, e := range c.Events {
+		diffCols := e.DiffCols
+		if diffCols == nil && e.Action == "update" {
+			for k, v := range e.NewRow {
+				if !reflect.DeepEqual(e.OldRow[k], v) {
+					diffCols = append(diffCols, k)
+				}
+			}
+			sort.Strings(diffCols)
+		}
+
+		events = append(events, consumer.RowEvent{
+			ID:       uint64(i + 1),
+			Schema:   e.Schema,
+			Table:    e.Table,
+			Alias:    e.Schema + "." + e.Table,
+			OldRow:   e.OldRow,
+			NewRow:   e.NewRow,
+			DiffCols: diffCols,
+			Action:   e.Action,
+		})
+	}
+	return events
+}
+
+// Tester 在内存中的Redis/Etcd/Logger上运行夹具
+type Tester struct {
+	ctx     *mod.Context
+	timeout time.Duration
+
+	redis  *exporter.MemoryCache
+	etcd   *exporter.MemoryCache
+	logger *exporter.MemoryLogger
+}
+
+// NewTester 替换脚本中的Redis/Etcd/Logger为内存实现，并编译script目录
+func NewTester(dir string, verbose bool, timeout time.Duration) (*Tester, error) {
+	t := &Tester{
+		timeout: timeout,
+		redis:   exporter.NewMemoryCache(),
+		etcd:    exporter.NewMemoryCache(),
+		logger:  exporter.NewMemoryLogger(),
+	}
+
+	// 一定要在编译之前导出
+	exporter.SetConsumerFakes(t.redis, t.etcd, t.logger)
+	exporter.Export()
+
+	ctx, err := Build(dir, verbose)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "positions: %v", ErrorPositions(err))
+	}
+	t.ctx = ctx
+	return t, nil
+}
+
+// Run 依次执行夹具中的case，每个case都使用全新的解释器和KV
+func (t *Tester) Run(file string, fixture *Fixture) []CaseResult {
+	var results []CaseResult
+	for _, c := range fixture.Cases {
+		results = append(results, t.runCase(file, c))
+	}
+	return results
+}
+
+func (t *Tester) runCase(file string, c *FixtureCase) CaseResult {
+	t.redis.Reset(c.Redis)
+	t.etcd.Reset(c.Etcd)
+	t.logger.Reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	now := time.Now()
+	v, err := runWithContext(ctx, func() (igop.Value, error) {
+		return Call(t.ctx, c.Call, callArgs(ctx, t.ctx, c.Call, c.ToRowEvents(), c.Arguments))
+	})
+	methodErr, _ := v.(error)
+	if err == nil {
+		err = methodErr
+	}
+
+	result := CaseResult{File: file, Name: c.Name, Logs: t.logger.Lines(), Duration: time.Since(now)}
+	fail := func(format string, args ...any) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.Expect.Error == "" && err != nil:
+		fail("unexpected error: %s", err.Error())
+	case c.Expect.Error != "" && err == nil:
+		fail("expect error contains %q, got nil", c.Expect.Error)
+	case c.Expect.Error != "" && !strings.Contains(err.Error(), c.Expect.Error):
+		fail("expect error contains %q, got: %s", c.Expect.Error, err.Error())
+	}
+
+	compareKVs("redis", c.Expect.Redis, t.redis.Dump(), fail)
+	compareKVs("etcd", c.Expect.Etcd, t.etcd.Dump(), fail)
+
+	for _, expect := range c.Expect.Logs {
+		found := false
+		for _, line := range result.Logs {
+			if strings.Contains(line, expect) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("expect logs contain %q", expect)
+		}
+	}
+
+	return result
+}
+
+func compareKVs(name string, expect map[string]*string, actual map[string]string, fail func(format string, args ...any)) {
+	keys := make([]string, 0, len(expect))
+	for k := range expect {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		want := expect[k]
+		got, ok := actual[k]
+		switch {
+		case want == nil && ok:
+			fail("%s key %q should not exist, got %q", name, k, got)
+		case want != nil && !ok:
+			fail("%s key %q not exists, expect %q", name, k, *want)
+		case want != nil && !jsonEqual(*want, got):
+			fail("%s key %q expect %q, got %q", name, k, *want, got)
+		}
+	}
+}
+
+// jsonEqual 两个值都是JSON时按结构比较，忽略键的顺序和空白
+func jsonEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var _a, _b any
+	if text_utils.JsonUnmarshal(a, &_a) != nil || text_utils.JsonUnmarshal(b, &_b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(_a, _b)
+}
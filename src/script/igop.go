@@ -1,4 +1,4 @@
-package task
+package script
 
 import (
 	"github.com/goplus/igop"
@@ -6,7 +6,8 @@ import (
 	"gopkg.in/go-mixed/igop.v1/mod"
 )
 
-func buildIgop(path string, debug bool) (*mod.Context, error) {
+// Build 编译script目录
+func Build(path string, debug bool) (*mod.Context, error) {
 	ctx := mod.NewContext(path, debug)
 
 	if err := ctx.LoadVendor(""); err != nil {
@@ -20,8 +21,8 @@ func buildIgop(path string, debug bool) (*mod.Context, error) {
 	return ctx, nil
 }
 
-// 每一次运行都是全新的会话，即上一个运行的变量结果无法被下一个调用
-func igopCall(ctx *mod.Context, method string, args []igop.Value) (igop.Value, error) {
+// Call 每一次运行都是全新的会话，即上一个运行的变量结果无法被下一个调用
+func Call(ctx *mod.Context, method string, args []igop.Value) (igop.Value, error) {
 	interp, err := ctx.NewInterp(ctx.GetMainPackage())
 	if err != nil {
 		return nil, errors.Wrap(err, "[igop]make Interp error")
@@ -0,0 +1,121 @@
+package script
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go/scanner"
+	"go/types"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"gopkg.in/go-mixed/igop.v1/mod"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Script 编译后的script目录，修改文件后会在后台重新编译，编译成功才替换
+type Script struct {
+	settings *settings.Settings
+	logger   *logger.Logger
+
+	dir string
+
+	lock     sync.RWMutex
+	ctx      *mod.Context
+	loadedAt time.Time
+
+	// 常驻的解释器，键为rule.Key()
+	sessions     map[string]*session
+	sessionsLock sync.Mutex
+}
+
+func NewScript(settings *settings.Settings, logger *logger.Logger) *Script {
+	// igop编译时会切换工作目录，所以需要绝对路径
+	dir, err := filepath.Abs(settings.TaskOptions.ScriptDir)
+	if err != nil {
+		dir = settings.TaskOptions.ScriptDir
+	}
+
+	return &Script{
+		settings: settings,
+		logger:   logger,
+		dir:      dir,
+		sessions: map[string]*session{},
+	}
+}
+
+// Load 编译script目录，失败时保留之前的版本
+func (s *Script) Load() error {
+	ctx, err := Build(s.dir, s.settings.TaskOptions.ScriptVerbose)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.ctx = ctx
+	s.loadedAt = time.Now()
+	s.lock.Unlock()
+	return nil
+}
+
+// Context 当前的编译结果，每个批次开始时获取一次，以保证替换只发生在两个批次之间
+func (s *Script) Context() *mod.Context {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.ctx
+}
+
+func (s *Script) Dir() string {
+	return s.dir
+}
+
+func (s *Script) LoadedAt() time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.loadedAt
+}
+
+func (s *Script) Files() []string {
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*.go"))
+	return files
+}
+
+// Watch 监听script目录的修改，阻塞运行直到ctx结束
+func (s *Script) Watch(ctx context.Context) {
+	common.NewFileWatcher(s.settings.TaskOptions.WatchInterval, s.reload, s.dir).Run(ctx)
+}
+
+func (s *Script) reload() {
+	s.logger.Info("[Script]files changed, rebuilding", zap.String("dir", s.dir))
+	if err := s.Load(); err != nil {
+		s.logger.Error("[Script]rebuild error, keep the previous version",
+			zap.String("dir", s.dir),
+			zap.Strings("positions", ErrorPositions(err)),
+			zap.Error(err),
+		)
+		return
+	}
+	s.logger.Info("[Script]rebuilt and swapped", zap.String("dir", s.dir))
+}
+
+// ErrorPositions 从编译错误中提取 file:line:column
+func ErrorPositions(err error) []string {
+	var positions []string
+	var typeErr types.Error
+	var scanErrs scanner.ErrorList
+	var scanErr *scanner.Error
+
+	switch {
+	case errors.As(err, &scanErrs):
+		for _, e := range scanErrs {
+			positions = append(positions, e.Pos.String())
+		}
+	case errors.As(err, &scanErr):
+		positions = append(positions, scanErr.Pos.String())
+	case errors.As(err, &typeErr):
+		positions = append(positions, typeErr.Fset.Position(typeErr.Pos).String())
+	}
+	return positions
+}
@@ -0,0 +1,147 @@
+package script
+
+import (
+	"context"
+	"github.com/goplus/igop"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/igop.v1/mod"
+	"reflect"
+)
+
+const (
+	setupFunc    = "Setup"
+	teardownFunc = "Teardown"
+)
+
+// session 常驻的解释器，每个rule独享一个，脚本的全局变量在多次调用之间保留
+type session struct {
+	ctx       *mod.Context
+	interp    *igop.Interp
+	arguments []string
+}
+
+func newSession(ctx *mod.Context, arguments []string) (*session, error) {
+	interp, err := ctx.NewInterp(ctx.GetMainPackage())
+	if err != nil {
+		return nil, errors.Wrap(err, "[igop]make Interp error")
+	}
+
+	if ctx.GetMainPackage().Func("init") != nil {
+		if err = interp.RunInit(); err != nil {
+			return nil, errors.Wrap(err, "[igop]run \"init\" error")
+		}
+	}
+
+	s := &session{ctx: ctx, interp: interp, arguments: arguments}
+	if err = s.run(setupFunc, arguments); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// run 执行可选的生命周期函数，函数不存在时忽略
+func (s *session) run(method string, args ...igop.Value) error {
+	if s.ctx.GetMainPackage().Func(method) == nil {
+		return nil
+	}
+
+	v, err := s.interp.RunFunc(method, args...)
+	if err != nil {
+		return errors.Wrapf(err, "[igop]run \"%s\" error", method)
+	}
+	methodErr, _ := v.(error)
+	return errors.Wrapf(methodErr, "[igop]\"%s\" returns error", method)
+}
+
+func (s *session) call(method string, args []igop.Value) (igop.Value, error) {
+	v, err := s.interp.RunFunc(method, args...)
+	if err != nil {
+		return v, errors.Wrapf(err, "[igop]run \"%s\" error", method)
+	}
+	return v, nil
+}
+
+// CallRule 执行rule的call，rule.Persistent时复用该rule常驻的解释器
+//
+//	ctx结束时放弃等待，脚本函数的第一个参数为 context.Context 时会传入该ctx
+func (s *Script) CallRule(ctx context.Context, rule *settings.RuleOptions, events []consumer.RowEvent) (igop.Value, error) {
+	modCtx := s.Context()
+	args := callArgs(ctx, modCtx, rule.Method(), events, rule.Arguments)
+
+	if !rule.Persistent {
+		return runWithContext(ctx, func() (igop.Value, error) {
+			return Call(modCtx, rule.Method(), args)
+		})
+	}
+
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	sess, ok := s.sessions[rule.Key()]
+	// 脚本重新编译或arguments修改后，需要重建解释器
+	if ok && (sess.ctx != modCtx || !reflect.DeepEqual(sess.arguments, rule.Arguments)) {
+		s.teardown(ctx, rule.Key(), sess)
+		ok = false
+	}
+
+	v, err := runWithContext(ctx, func() (igop.Value, error) {
+		if !ok {
+			var err error
+			if sess, err = newSession(modCtx, rule.Arguments); err != nil {
+				return nil, err
+			}
+		}
+		return sess.call(rule.Method(), args)
+	})
+
+	switch {
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		// 被放弃的解释器仍在后台运行，不能再复用，也不能调用Teardown
+		delete(s.sessions, rule.Key())
+		s.logger.Warn("[Script]persistent interpreter abandoned", zap.String("rule", rule.Key()), zap.Error(ctx.Err()))
+	case !ok && sess != nil:
+		s.sessions[rule.Key()] = sess
+		s.logger.Info("[Script]persistent interpreter started", zap.String("rule", rule.Key()))
+	}
+	return v, err
+}
+
+// Release 结束某个rule常驻的解释器，会调用脚本的Teardown
+func (s *Script) Release(ctx context.Context, key string) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	if sess, ok := s.sessions[key]; ok {
+		s.teardown(ctx, key, sess)
+	}
+}
+
+// Close 结束所有常驻的解释器，返回所有Teardown的错误
+func (s *Script) Close(ctx context.Context) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	var err error
+	for key, sess := range s.sessions {
+		err = multierr.Append(err, s.teardown(ctx, key, sess))
+	}
+	return err
+}
+
+func (s *Script) teardown(ctx context.Context, key string, sess *session) error {
+	delete(s.sessions, key)
+
+	_, err := runWithContext(ctx, func() (igop.Value, error) {
+		return nil, sess.run(teardownFunc)
+	})
+	if err != nil {
+		s.logger.Error("[Script]teardown persistent interpreter error", zap.String("rule", key), zap.Error(err))
+	} else {
+		s.logger.Info("[Script]persistent interpreter stopped", zap.String("rule", key))
+	}
+	return err
+}
@@ -0,0 +1,14 @@
+package settings
+
+type AdminOptions struct {
+	// 是否启用管理用的HTTP API，默认关闭
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr" validate:"required_if=Enabled true"`
+}
+
+func defaultAdminOptions() AdminOptions {
+	return AdminOptions{
+		Enabled: false,
+		Addr:    "127.0.0.1:8086",
+	}
+}
@@ -0,0 +1,22 @@
+package settings
+
+import (
+	"gopkg.in/go-mixed/go-common.v1/utils/io"
+	"path/filepath"
+)
+
+type SchemaRegistryOptions struct {
+	// 是否启用本地的schema registry，avro、protobuf格式需要启用
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir" validate:"required_if=Enabled true"`
+	// 表结构变化时新版本与上一个版本的兼容性检查：backward、forward、full、none
+	Compatibility string `yaml:"compatibility" validate:"oneof=backward forward full none"`
+}
+
+func defaultSchemaRegistryOptions() SchemaRegistryOptions {
+	return SchemaRegistryOptions{
+		Enabled:       false,
+		Dir:           filepath.Join(io_utils.GetCurrentDir(), "schemas"),
+		Compatibility: "backward",
+	}
+}
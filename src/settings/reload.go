@@ -0,0 +1,39 @@
+package settings
+
+import (
+	"reflect"
+	"strings"
+)
+
+// 运行时可以修改的配置项（yaml的路径）
+var mutableSettings = map[string]bool{
+	"task.rules": true,
+}
+
+// ImmutableChanges 对比新的配置，返回运行时不能修改、但是有变化的配置项（yaml的路径）
+func (s *Settings) ImmutableChanges(newSettings *Settings) []string {
+	return diffFields("", reflect.ValueOf(*s), reflect.ValueOf(*newSettings))
+}
+
+func diffFields(prefix string, v1, v2 reflect.Value) []string {
+	var changes []string
+	for i := 0; i < v1.NumField(); i++ {
+		field := v1.Type().Field(i)
+		name := strings.SplitN(field.Tag.Get("yaml"), ",", 2)[0]
+		if name == "-" || name == "" {
+			continue
+		}
+		name = prefix + name
+		if mutableSettings[name] {
+			continue
+		}
+
+		f1, f2 := v1.Field(i), v2.Field(i)
+		if field.Type == reflect.TypeOf(TaskOptions{}) { // 进入task中对比
+			changes = append(changes, diffFields(name+".", f1, f2)...)
+		} else if !reflect.DeepEqual(f1.Interface(), f2.Interface()) {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
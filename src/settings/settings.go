@@ -12,20 +12,35 @@ type Settings struct {
 	DumplingOptions DumplingOptions `yaml:"dumpling"`
 	TargetOptions   TargetOptions   `yaml:"targets"`
 	TaskOptions     TaskOptions     `yaml:"task"`
+	AdminOptions    AdminOptions    `yaml:"admin"`
+
+	SchemaRegistryOptions SchemaRegistryOptions `yaml:"schema_registry"`
 
 	Storage       string               `yaml:"storage"`
 	LoggerOptions logger.LoggerOptions `yaml:"log"`
+
+	// 配置文件的路径，用于重新加载配置
+	ConfigFile string `yaml:"-"`
 }
 
 func LoadSettings(confPath string) (*Settings, error) {
+	if absPath, err := filepath.Abs(confPath); err == nil {
+		confPath = absPath
+	}
+
 	cfg := &Settings{
 		MySqlOptions:    defaultMySqlOptions(),
 		DumplingOptions: defaultDumplingOptions(),
 		TaskOptions:     defaultTaskOptions(),
 		TargetOptions:   defaultTargetOptions(),
+		AdminOptions:    defaultAdminOptions(),
+
+		SchemaRegistryOptions: defaultSchemaRegistryOptions(),
 
 		Storage:       filepath.Join(io_utils.GetCurrentDir(), "storage"),
 		LoggerOptions: logger.DefaultLoggerOptions(),
+
+		ConfigFile: confPath,
 	}
 
 	if err := conf.LoadSettings(cfg, confPath); err != nil {
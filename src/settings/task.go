@@ -1,11 +1,14 @@
 package settings
 
 import (
+	"github.com/pkg/errors"
 	"gopkg.in/go-mixed/dm.v1/src/common"
 	"gopkg.in/go-mixed/go-common.v1/utils/io"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type RuleOptions struct {
@@ -14,9 +17,21 @@ type RuleOptions struct {
 
 	TableRegexp *regexp.Regexp `yaml:"-"`
 
-	// execute the "call(events, args)" on the task.ScriptDir
-	Call      string   `yaml:"call" validate:"required"`
+	// execute the "call(events, args)" on the task.ScriptDir, "igop:" prefix is optional
+	// "process:command args..." runs a long-running child process in the task.ScriptDir, see sink.processSink
+	Call      string   `yaml:"call" validate:"required_without=Sink"`
 	Arguments []string `yaml:"arguments" validate:""`
+
+	// 使用已注册的Sink代替igop脚本，参见 sink.Register
+	Sink    string         `yaml:"sink" validate:"required_without=Call,excluded_with=Call"`
+	Options map[string]any `yaml:"options"`
+
+	// 为该rule保留一个常驻的解释器，脚本的全局变量在多次调用之间保留
+	// 脚本可选实现 Setup(args []string) error 和 Teardown() error
+	Persistent bool `yaml:"persistent"`
+
+	// 单次call的最长执行时间，超时视为失败并在下次触发时重试，0表示不限制
+	Timeout time.Duration `yaml:"timeout"`
 }
 
 type TaskOptions struct {
@@ -31,6 +46,15 @@ type TaskOptions struct {
 
 	MaxWait     time.Duration `yaml:"max_wait"`
 	MaxBulkSize uint64        `yaml:"max_bulk_size"`
+
+	// 监听配置文件的修改，自动重新加载rules
+	WatchSettings bool `yaml:"watch_settings"`
+	// 监听script_dir的修改，自动重新编译脚本
+	WatchScripts  bool          `yaml:"watch_scripts"`
+	WatchInterval time.Duration `yaml:"watch_interval"`
+
+	// 退出时等待正在执行的call的时间，超时后放弃
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
 }
 
 func defaultTaskOptions() TaskOptions {
@@ -40,7 +64,98 @@ func defaultTaskOptions() TaskOptions {
 
 		ScriptDir:     filepath.Join(io_utils.GetCurrentDir(), "scripts"),
 		ScriptVerbose: false,
+
+		WatchSettings: true,
+		WatchScripts:  true,
+		WatchInterval: 1 * time.Second,
+
+		ShutdownGrace: 10 * time.Second,
+	}
+}
+
+// Key rule的唯一标识，即 schema.table
+func (r *RuleOptions) Key() string {
+	return r.Schema + "." + r.Table
+}
+
+// IsProcess call是否为外部进程
+func (r *RuleOptions) IsProcess() bool {
+	return strings.HasPrefix(r.Call, common.ProcessPrefix)
+}
+
+// Command 外部进程的命令行，按shell的规则分割，参见 splitCommand
+func (r *RuleOptions) Command() ([]string, error) {
+	return splitCommand(strings.TrimPrefix(r.Call, common.ProcessPrefix))
+}
+
+// splitCommand 按空白分割命令行，支持单引号、双引号和反斜杠转义，不支持变量、通配符等其它shell语法
+func splitCommand(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	// inWord 当前是否在一个参数中，用于保留空的引号（""）
+	inWord := false
+	var quote rune
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(ch)
+			}
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			} else if ch == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') { // 双引号中只转义 " 和 \
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(ch)
+			}
+		case ch == '\\':
+			if i+1 >= len(runes) {
+				return nil, errors.Errorf("command \"%s\" ends with a backslash", line)
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case ch == '\'' || ch == '"':
+			quote, inWord = ch, true
+		case unicode.IsSpace(ch):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c in command \"%s\"", quote, line)
+	} else if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Method igop脚本中的函数名
+func (r *RuleOptions) Method() string {
+	return strings.TrimPrefix(r.Call, common.IgopPrefix)
+}
+
+// SinkName 用于日志和状态的sink名称
+func (r *RuleOptions) SinkName() string {
+	if r.Sink != "" {
+		return r.Sink
+	} else if r.IsProcess() {
+		return r.Call
 	}
+	return common.IgopPrefix + r.Method()
 }
 
 func (r *RuleOptions) pattern() string {
@@ -0,0 +1,33 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRuleCommand(t *testing.T) {
+	for _, c := range []struct {
+		call    string
+		command []string
+	}{
+		{"process:python3 consumer.py", []string{"python3", "consumer.py"}},
+		{"process:  python3\tconsumer.py  ", []string{"python3", "consumer.py"}},
+		{"process:python3 'my consumer.py' --name \"a b\"", []string{"python3", "my consumer.py", "--name", "a b"}},
+		{"process:python3 my\\ consumer.py \"\" 'it''s'", []string{"python3", "my consumer.py", "", "its"}},
+		{"process:echo \"a\\\"b\\\\c\\d\" 'a\\b'", []string{"echo", "a\"b\\c\\d", "a\\b"}},
+		{"process:", nil},
+	} {
+		command, err := (&RuleOptions{Call: c.call}).Command()
+		if err != nil {
+			t.Errorf("split \"%s\" error: %s", c.call, err)
+		} else if !reflect.DeepEqual(command, c.command) {
+			t.Errorf("split \"%s\", expected %q, got %q", c.call, c.command, command)
+		}
+	}
+
+	for _, call := range []string{"process:python3 'consumer.py", "process:python3 \"consumer.py", "process:python3 consumer.py\\"} {
+		if _, err := (&RuleOptions{Call: call}).Command(); err == nil {
+			t.Errorf("expected an error of \"%s\"", call)
+		}
+	}
+}
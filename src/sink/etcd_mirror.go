@@ -0,0 +1,286 @@
+package sink
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 对账时每次读取的key数量
+const etcdReconcilePageSize = 1000
+
+// etcdMirrorOptions etcd_mirror的options
+type etcdMirrorOptions struct {
+	// key的模板，比如 "/config/flags/{name}"
+	Key string `yaml:"key"`
+	// 只写入这些列，为空表示全部
+	Columns []string `yaml:"columns"`
+	// 一个批次的所有修改在一个事务中提交
+	Transaction bool `yaml:"transaction"`
+	// 每个事务的最大操作数，需要不大于etcd的--max-txn-ops（默认128），0表示不限
+	MaxTxnOps int `yaml:"max_txn_ops"`
+	// 不为空时，每个批次写入最后一个event的ID，开启事务时和修改在同一个事务中
+	RevisionKey string `yaml:"revision_key"`
+	// 全量快照之后删除Prefix下快照中不存在的key
+	Reconcile bool `yaml:"reconcile"`
+	// 对账的范围，开启Reconcile时必须指定，这个rule需要独占prefix下的所有key
+	Prefix string `yaml:"prefix"`
+}
+
+func defaultEtcdMirrorOptions() etcdMirrorOptions {
+	return etcdMirrorOptions{
+		Transaction: true,
+		MaxTxnOps:   128,
+	}
+}
+
+// etcdMirror 将行镜像到etcd：insert/update时写入JSON，delete时删除key
+type etcdMirror struct {
+	params  Params
+	options etcdMirrorOptions
+	key     *keyTemplate
+	client  *clientv3.Client
+
+	// 快照中写入的key，nil表示不在快照中
+	snapshotLock sync.Mutex
+	snapshot     map[string]struct{}
+}
+
+// etcdOp 合并之后的一个key的最终操作
+type etcdOp struct {
+	key    string
+	value  string
+	delete bool
+}
+
+func init() {
+	Register("etcd_mirror", func() Sink { return &etcdMirror{} })
+}
+
+func (s *etcdMirror) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultEtcdMirrorOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	} else if err = rejectFormat(params, "format", "format_options"); err != nil {
+		return err
+	}
+
+	if s.options.MaxTxnOps < 0 {
+		return errors.Errorf("[Sink]\"max_txn_ops\" must not be negative in rule \"%s\"", params.Rule.Key())
+	}
+
+	var err error
+	if s.key, err = parseKeyTemplate(s.options.Key); err != nil {
+		return err
+	}
+
+	// 对账会删除prefix下的其它key，所以必须明确指定，并且包含所有写入的key
+	if s.options.Reconcile {
+		if s.options.Prefix == "" {
+			return errors.Errorf("[Sink]\"prefix\" is required when reconcile is enabled in rule \"%s\"", params.Rule.Key())
+		} else if !strings.HasPrefix(s.key.Prefix(), s.options.Prefix) {
+			return errors.Errorf("[Sink]\"key\" \"%s\" is not under the \"prefix\" \"%s\" in rule \"%s\"", s.options.Key, s.options.Prefix, params.Rule.Key())
+		}
+	}
+
+	if params.Target == nil || params.Target.Etcd == nil {
+		return errors.Errorf("[Sink]etcd target is not configured for rule \"%s\"", params.Rule.Key())
+	}
+	s.client = params.Target.Etcd.EtcdClient
+	return nil
+}
+
+// Write 同一个key在一个批次中只保留最后一次操作，因为etcd的事务中不能重复修改同一个key
+func (s *etcdMirror) Write(ctx context.Context, events []consumer.RowEvent) error {
+	var ops []etcdOp
+	index := map[string]int{}
+	add := func(op etcdOp) {
+		if i, ok := index[op.key]; ok {
+			ops[i] = op
+			return
+		}
+		index[op.key] = len(ops)
+		ops = append(ops, op)
+	}
+
+	// 行中没有key模板的列时，重试也不会成功，跳过这些events，最后移入死信
+	var poison poisonBatch
+	for _, event := range events {
+		eventOps, err := s.eventOps(event)
+		if err != nil {
+			poison.add(errors.WithMessagef(err, "[Sink]event %d", event.ID), event)
+			continue
+		}
+		for _, op := range eventOps {
+			add(op)
+		}
+	}
+
+	if s.options.RevisionKey != "" && len(events) > 0 {
+		add(etcdOp{key: s.options.RevisionKey, value: strconv.FormatUint(events[len(events)-1].ID, 10)})
+	}
+
+	if err := s.commit(ctx, ops); err != nil {
+		return errors.Wrapf(err, "[Sink]etcd_mirror of rule \"%s\" error", s.params.Rule.Key())
+	}
+
+	s.track(ops)
+	return poison.err()
+}
+
+// eventOps 一个event的所有操作，返回错误时没有任何操作
+func (s *etcdMirror) eventOps(event consumer.RowEvent) ([]etcdOp, error) {
+	switch event.Action {
+	case "delete":
+		key, err := s.key.Execute(event.OldRow)
+		if err != nil {
+			return nil, err
+		}
+		return []etcdOp{{key: key, delete: true}}, nil
+	case "insert", "update":
+		key, err := s.key.Execute(event.NewRow)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := text_utils.JsonMarshalToBytes(selectColumns(event.NewRow, s.options.Columns))
+		if err != nil {
+			return nil, errors.Wrapf(err, "[Sink]encode row of key \"%s\" error", key)
+		}
+		var ops []etcdOp
+		// 修改了key中的列，需要删除旧的key
+		if event.OldRow != nil {
+			if oldKey, err := s.key.Execute(event.OldRow); err == nil && oldKey != key {
+				ops = append(ops, etcdOp{key: oldKey, delete: true})
+			}
+		}
+		return append(ops, etcdOp{key: key, value: string(buf)}), nil
+	}
+
+	s.params.Logger.Warn("[Sink]unsupported action", zap.String("rule", s.params.Rule.Key()), zap.String("action", event.Action))
+	return nil, nil
+}
+
+func (s *etcdMirror) commit(ctx context.Context, ops []etcdOp) error {
+	if !s.options.Transaction {
+		for _, op := range ops {
+			var err error
+			if op.delete {
+				_, err = s.client.Delete(ctx, op.key)
+			} else {
+				_, err = s.client.Put(ctx, op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	size := len(ops)
+	if s.options.MaxTxnOps > 0 && size > s.options.MaxTxnOps {
+		size = s.options.MaxTxnOps
+	}
+	for start := 0; start < len(ops); start += size {
+		end := start + size
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		var txnOps []clientv3.Op
+		for _, op := range ops[start:end] {
+			if op.delete {
+				txnOps = append(txnOps, clientv3.OpDelete(op.key))
+			} else {
+				txnOps = append(txnOps, clientv3.OpPut(op.key, op.value))
+			}
+		}
+		if _, err := s.client.Txn(ctx).Then(txnOps...).Commit(); errors.Is(err, rpctypes.ErrTooManyOps) {
+			// 配置错误，重试也不会成功
+			return NewPoisonError(errors.Wrapf(err, "[Sink]%d operations exceed the --max-txn-ops of etcd, lower the \"max_txn_ops\" of rule \"%s\"", len(txnOps), s.params.Rule.Key()))
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// track 记录快照中写入的key
+func (s *etcdMirror) track(ops []etcdOp) {
+	s.snapshotLock.Lock()
+	defer s.snapshotLock.Unlock()
+
+	if s.snapshot == nil {
+		return
+	}
+	for _, op := range ops {
+		if op.delete {
+			delete(s.snapshot, op.key)
+		} else {
+			s.snapshot[op.key] = struct{}{}
+		}
+	}
+}
+
+func (s *etcdMirror) BeginSnapshot() {
+	if !s.options.Reconcile {
+		return
+	}
+
+	s.snapshotLock.Lock()
+	defer s.snapshotLock.Unlock()
+	s.snapshot = map[string]struct{}{}
+}
+
+// Reconcile 删除Prefix下所有快照中没有写入的key（RevisionKey除外）
+func (s *etcdMirror) Reconcile(ctx context.Context) error {
+	s.snapshotLock.Lock()
+	snapshot := s.snapshot
+	s.snapshot = nil
+	s.snapshotLock.Unlock()
+
+	if snapshot == nil {
+		return nil
+	}
+
+	var stale []etcdOp
+	rangeEnd := clientv3.GetPrefixRangeEnd(s.options.Prefix)
+	for start := s.options.Prefix; ; {
+		response, err := s.client.Get(ctx, start, clientv3.WithRange(rangeEnd), clientv3.WithKeysOnly(), clientv3.WithLimit(etcdReconcilePageSize))
+		if err != nil {
+			return errors.Wrapf(err, "[Sink]list keys of \"%s\" error", s.options.Prefix)
+		}
+		for _, kv := range response.Kvs {
+			key := string(kv.Key)
+			if _, ok := snapshot[key]; !ok && key != s.options.RevisionKey {
+				stale = append(stale, etcdOp{key: key, delete: true})
+			}
+		}
+		if !response.More || len(response.Kvs) <= 0 {
+			break
+		}
+		start = string(response.Kvs[len(response.Kvs)-1].Key) + "\x00"
+	}
+
+	if err := s.commit(ctx, stale); err != nil {
+		return errors.Wrapf(err, "[Sink]delete stale keys of \"%s\" error", s.options.Prefix)
+	}
+	s.params.Logger.Info("[Sink]reconciled",
+		zap.String("rule", s.params.Rule.Key()),
+		zap.String("prefix", s.options.Prefix),
+		zap.Int("keys", len(snapshot)),
+		zap.Int("deleted", len(stale)),
+	)
+	return nil
+}
+
+func (s *etcdMirror) Close() error {
+	return nil
+}
@@ -0,0 +1,516 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/io"
+	"gopkg.in/go-mixed/go-common.v1/utils/unit"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileFormatJson = "json"
+	fileFormatCsv  = "csv"
+
+	// 轮转后文件名中的时间
+	fileRotateTimeLayout = "20060102150405"
+	// 没有Write时，检查rotate_interval的最长间隔
+	fileRotateCheckInterval = 10 * time.Second
+)
+
+// fileOptions file的options
+type fileOptions struct {
+	// 文件路径的模板，可以使用 {schema} {table} {date}，相对路径基于程序目录
+	Path string `yaml:"path"`
+	// {date}的格式
+	DateFormat string `yaml:"date_format"`
+	// csv: 第一行为表头；其它为每行一个序列化的事件，比如json、debezium，只能使用JSON的格式，参见 format.Register
+	Format        string         `yaml:"format"`
+	FormatOptions format.Options `yaml:"format_options"`
+	// csv的列，为空时使用源表的所有列
+	Columns []string `yaml:"columns"`
+	// 超过该大小时轮转，比如 "100MB"，为空表示不限
+	MaxSize string `yaml:"max_size"`
+	// 文件打开超过该时长时轮转，0表示不限
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	// 压缩轮转后的文件
+	Gzip bool `yaml:"gzip"`
+	// 每次Write之后fsync
+	Fsync bool `yaml:"fsync"`
+	// 上传轮转后的文件，上传成功后删除本地文件
+	Upload uploadOptions `yaml:"upload"`
+}
+
+func defaultFileOptions() fileOptions {
+	return fileOptions{
+		Path:          "events/{schema}/{table}-{date}.jsonl",
+		DateFormat:    "20060102",
+		Format:        fileFormatJson,
+		FormatOptions: format.DefaultOptions(),
+		Fsync:         true,
+		Upload:        defaultUploadOptions(),
+	}
+}
+
+// fileSink 将events追加到按表分开的文件中
+//
+//	正在写入的文件为模板生成的路径，轮转时重命名为 "名称-时间[-序号].扩展名"，开启gzip时再压缩为 ".gz"
+//	整批重试时会重复写入，可以按id去重
+type fileSink struct {
+	params     Params
+	options    fileOptions
+	path       *keyTemplate
+	maxSize    int64
+	serializer format.Serializer
+
+	// Write、Close与定时的轮转互斥
+	lock  sync.Mutex
+	files map[string]*rotatingFile
+	// 每个表正在写入的文件路径
+	current map[string]string
+	// 正在压缩的文件
+	compressing sync.WaitGroup
+	uploader    *uploader
+	// 关闭时停止定时的轮转
+	stopRotate chan struct{}
+	rotateDone chan struct{}
+}
+
+// rotatingFile 一个正在写入的文件
+type rotatingFile struct {
+	path     string
+	file     *os.File
+	writer   *bufio.Writer
+	csv      *csv.Writer
+	size     int64
+	openedAt time.Time
+	// csv表头中的列，不包括 _id _action
+	columns []string
+	// 需要在Write结束时fsync
+	dirty bool
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	f *rotatingFile
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.f.writer.Write(p)
+	w.f.size += int64(n)
+	return n, err
+}
+
+func init() {
+	Register("file", func() Sink { return &fileSink{} })
+}
+
+func (s *fileSink) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultFileOptions()
+	s.files = map[string]*rotatingFile{}
+	s.current = map[string]string{}
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	var err error
+	if s.options.Format != fileFormatCsv {
+		if s.serializer, err = newSerializer(params, s.options.Format, s.options.FormatOptions); err != nil {
+			return err
+		}
+		// 每行一个事件，所以不能使用avro等二进制的格式
+		if s.serializer.ContentType() != "application/json" {
+			return errors.Errorf("[Sink]format \"%s\" is not JSON, which can not be used in rule \"%s\"", s.options.Format, params.Rule.Key())
+		}
+	}
+
+	if s.path, err = parseKeyTemplate(io_utils.MakePathFromRelative("", s.options.Path)); err != nil {
+		return err
+	}
+	for _, column := range s.path.Columns() {
+		switch column {
+		case "schema", "table", "date":
+		default:
+			return errors.Errorf("[Sink]only {schema} {table} {date} can be used in \"path\" of rule \"%s\"", params.Rule.Key())
+		}
+	}
+
+	if s.options.MaxSize != "" {
+		if s.maxSize, err = unit.RAMInBytes(s.options.MaxSize); err != nil {
+			return errors.Wrapf(err, "[Sink]invalid max_size \"%s\" in rule \"%s\"", s.options.MaxSize, params.Rule.Key())
+		}
+	}
+
+	if s.uploader, err = newUploader(params, s.options.Upload, uploadRoot(s.path)); err != nil {
+		return err
+	}
+
+	// 表没有新的events时，也需要按rotate_interval轮转
+	if s.options.RotateInterval > 0 {
+		s.stopRotate, s.rotateDone = make(chan struct{}), make(chan struct{})
+		go s.rotateLoop(core.If(s.options.RotateInterval < fileRotateCheckInterval, s.options.RotateInterval, fileRotateCheckInterval))
+	}
+	return nil
+}
+
+func (s *fileSink) rotateLoop(interval time.Duration) {
+	defer close(s.rotateDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopRotate:
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			err := s.rotateExpired()
+			s.lock.Unlock()
+			if err != nil {
+				s.params.Logger.Error("[Sink]rotate file error", zap.String("rule", s.params.Rule.Key()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// rotateExpired 轮转所有打开超过RotateInterval的文件，需要持有lock
+func (s *fileSink) rotateExpired() error {
+	if s.options.RotateInterval <= 0 {
+		return nil
+	}
+	for _, f := range s.files {
+		if time.Since(f.openedAt) >= s.options.RotateInterval {
+			if err := s.rotate(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Write 不兼容schema_registry的events跳过，其它events写入之后，只将这些events移入死信
+func (s *fileSink) Write(ctx context.Context, events []consumer.RowEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var poison poisonBatch
+	date := time.Now().Format(s.options.DateFormat)
+	for i := range events {
+		event := &events[i]
+		path, err := s.path.Execute(map[string]any{"schema": event.Schema, "table": event.Table, "date": date})
+		if err != nil {
+			return err
+		}
+
+		f, err := s.get(path, event)
+		if err != nil {
+			return err
+		}
+		if err = s.write(ctx, f, event); registry.IsIncompatible(err) {
+			poison.add(err, *event)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "[Sink]write \"%s\" error", path)
+		}
+
+		if s.maxSize > 0 && f.size >= s.maxSize {
+			if err = s.rotate(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.sync(); err != nil {
+		return err
+	}
+	// 没有新的events的表也需要检查RotateInterval
+	if err := s.rotateExpired(); err != nil {
+		return err
+	}
+	return poison.err()
+}
+
+// get 返回path对应的文件，同一个表的{date}变化时轮转旧的文件
+func (s *fileSink) get(path string, event *consumer.RowEvent) (*rotatingFile, error) {
+	if f, ok := s.files[path]; ok {
+		if f.csv == nil || slices.Equal(f.columns, s.csvColumns(event)) {
+			return f, nil
+		}
+		// 表结构变化后，使用新的表头写入新的文件
+		if err := s.rotate(f); err != nil {
+			return nil, err
+		}
+	}
+
+	// {date}变化后，轮转这个表之前的文件
+	table := event.Schema + "." + event.Table
+	if previous, ok := s.files[s.current[table]]; ok {
+		if err := s.rotate(previous); err != nil {
+			return nil, err
+		}
+	}
+	s.current[table] = path
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Wrapf(err, "[Sink]create directory of \"%s\" error", path)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[Sink]open \"%s\" error", path)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "[Sink]stat \"%s\" error", path)
+	}
+
+	f := &rotatingFile{
+		path:     path,
+		file:     file,
+		writer:   bufio.NewWriter(file),
+		size:     stat.Size(),
+		openedAt: time.Now(),
+	}
+	s.files[path] = f
+	if s.options.Format == fileFormatCsv {
+		f.csv = csv.NewWriter(countingWriter{f: f})
+		if f.size > 0 {
+			f.columns = readCsvHeader(path)
+			// 上次启动时的表头与现在的列不同
+			if !slices.Equal(f.columns, s.csvColumns(event)) {
+				if err = s.rotate(f); err != nil {
+					return nil, err
+				}
+				return s.get(path, event)
+			}
+		} else {
+			f.columns = s.csvColumns(event)
+			if err = f.csv.Write(append([]string{"_id", "_action"}, f.columns...)); err != nil {
+				delete(s.files, path)
+				_ = file.Close()
+				return nil, errors.Wrapf(err, "[Sink]write header of \"%s\" error", path)
+			}
+		}
+	}
+	return f, nil
+}
+
+// readCsvHeader 读取已有文件的表头，读取失败时返回nil
+func readCsvHeader(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(bufio.NewReader(file)).Read()
+	if err != nil || len(header) < 2 {
+		return nil
+	}
+	return header[2:]
+}
+
+func (s *fileSink) write(ctx context.Context, f *rotatingFile, event *consumer.RowEvent) error {
+	f.dirty = true
+	if s.options.Format == fileFormatCsv {
+		row := event.NewRow
+		if event.Action == "delete" {
+			row = event.OldRow
+		}
+		record := []string{strconv.FormatUint(event.ID, 10), event.Action}
+		for _, column := range s.csvColumns(event) {
+			record = append(record, formatValue(row[column]))
+		}
+		return f.csv.Write(record)
+	}
+
+	buf, err := marshalEvent(ctx, s.serializer, *event)
+	if err != nil {
+		return err
+	}
+	_, err = countingWriter{f: f}.Write(append(buf, '\n'))
+	return err
+}
+
+// csvColumns options中的列，或者源表的所有列
+func (s *fileSink) csvColumns(event *consumer.RowEvent) []string {
+	if len(s.options.Columns) > 0 {
+		return s.options.Columns
+	}
+
+	var columns []string
+	if table := event.GetTable(); table != nil {
+		for _, column := range table.Columns {
+			columns = append(columns, column.Name)
+		}
+		return columns
+	}
+	for column := range event.Row() {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// flush 将缓冲写入文件，fsync为true时同步到磁盘
+func (f *rotatingFile) flush(fsync bool) error {
+	if f.csv != nil {
+		f.csv.Flush()
+		if err := f.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if fsync && f.dirty {
+		if err := f.file.Sync(); err != nil {
+			return err
+		}
+	}
+	f.dirty = false
+	return nil
+}
+
+// sync Write结束时调用，保证返回之前数据已经写入文件
+func (s *fileSink) sync() error {
+	for path, f := range s.files {
+		if err := f.flush(s.options.Fsync); err != nil {
+			return errors.Wrapf(err, "[Sink]flush \"%s\" error", path)
+		}
+	}
+	return nil
+}
+
+// rotate 关闭并重命名文件，开启gzip时在后台压缩
+func (s *fileSink) rotate(f *rotatingFile) error {
+	delete(s.files, f.path)
+	if err := multierr.Append(f.flush(s.options.Fsync), f.file.Close()); err != nil {
+		return errors.Wrapf(err, "[Sink]close \"%s\" error", f.path)
+	}
+
+	rotated := rotatedPath(f.path)
+	// 重命名之后进程退出，下次启动时也会上传
+	if s.uploader != nil {
+		s.uploader.Mark(rotated)
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		return errors.Wrapf(err, "[Sink]rename \"%s\" error", f.path)
+	}
+	s.params.Logger.Info("[Sink]file rotated", zap.String("rule", s.params.Rule.Key()), zap.String("file", rotated), zap.Int64("size", f.size))
+
+	if s.options.Gzip {
+		s.compressing.Add(1)
+		go func() {
+			defer s.compressing.Done()
+			if s.uploader != nil {
+				s.uploader.Mark(rotated + ".gz")
+			}
+			if err := compressFile(rotated); err != nil {
+				s.params.Logger.Error("[Sink]compress file error", zap.String("file", rotated), zap.Error(err))
+				if s.uploader != nil {
+					s.uploader.Unmark(rotated + ".gz")
+				}
+				s.upload(rotated)
+				return
+			}
+			s.upload(rotated + ".gz")
+			if s.uploader != nil {
+				s.uploader.Unmark(rotated)
+			}
+		}()
+	} else {
+		s.upload(rotated)
+	}
+	return nil
+}
+
+// rotatedPath 轮转后的路径 "名称-时间.扩展名"，同一秒内多次轮转时添加 "-1" "-2" 等序号，
+// 也不能与压缩后的 ".gz" 重复
+func rotatedPath(path string) string {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-" + time.Now().Format(fileRotateTimeLayout)
+	for i := 0; ; i++ {
+		p := prefix + core.If(i > 0, "-"+strconv.Itoa(i), "") + ext
+		if !io_utils.PathExists(p) && !io_utils.PathExists(p+".gz") {
+			return p
+		}
+	}
+}
+
+// upload 开启上传时将轮转后的文件加入上传队列
+func (s *fileSink) upload(path string) {
+	if s.uploader != nil {
+		s.uploader.Enqueue(path)
+	}
+}
+
+// compressFile 压缩为 path.gz，成功后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(dst)
+	if _, err = io.Copy(w, src); err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if err = multierr.Append(err, dst.Close()); err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(path)
+}
+
+// Close 关闭所有文件（不轮转，下次启动时继续追加），并等待压缩结束，未上传的文件保留到下次启动
+func (s *fileSink) Close() error {
+	if s.stopRotate != nil {
+		close(s.stopRotate)
+		<-s.rotateDone
+		s.stopRotate = nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	for path, f := range s.files {
+		err = multierr.Append(err, f.flush(s.options.Fsync))
+		err = multierr.Append(err, f.file.Close())
+		delete(s.files, path)
+	}
+	s.compressing.Wait()
+	if s.uploader != nil {
+		s.uploader.Close()
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package sink
+
+import (
+	"context"
+	"encoding/csv"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFile(t *testing.T, options map[string]any) (Sink, string) {
+	// 没有表结构时使用行中的列
+	consumer.GetTableFn = func(string) *consumer.Table { return nil }
+
+	dir := t.TempDir()
+	options["path"] = filepath.Join(dir, "{table}.log")
+	options["fsync"] = false
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fileSink{}
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "file", Options: options},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, dir
+}
+
+// 轮转后的文件名为 "名称-时间[-序号].扩展名[.gz]"
+var rotatedFileRegexp = regexp.MustCompile(`-\d{14}(-\d+)?(\.[^.]+)?(\.gz)?$`)
+
+// rotatedFiles 目录中轮转后的文件
+func rotatedFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if rotatedFileRegexp.MatchString(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readCsv(t *testing.T, path string) [][]string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestFileRotateInSameSecond(t *testing.T) {
+	s, dir := newTestFile(t, map[string]any{"max_size": "1B"})
+
+	// 每个event都会轮转，同一秒内的文件名不能重复
+	for id := uint64(1); id <= 3; id++ {
+		event := consumer.RowEvent{ID: id, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": id}}
+		if err := s.Write(context.Background(), []consumer.RowEvent{event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if files := rotatedFiles(t, dir); len(files) != 3 {
+		t.Errorf("expected 3 rotated files, got %v", files)
+	}
+}
+
+func TestFileRotateInterval(t *testing.T) {
+	s, dir := newTestFile(t, map[string]any{"rotate_interval": "1h"})
+	event := func(id uint64, table string) consumer.RowEvent {
+		return consumer.RowEvent{ID: id, Action: "insert", Schema: "test_db", Table: table, NewRow: map[string]any{"id": id}}
+	}
+	if err := s.Write(context.Background(), []consumer.RowEvent{event(1, "users"), event(2, "orders")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 这个批次没有orders的events，Write结束时也会轮转它
+	s.(*fileSink).files[filepath.Join(dir, "orders.log")].openedAt = time.Now().Add(-2 * time.Hour)
+	if err := s.Write(context.Background(), []consumer.RowEvent{event(3, "users")}); err != nil {
+		t.Fatal(err)
+	}
+	files := rotatedFiles(t, dir)
+	if len(files) != 1 || !strings.HasPrefix(filepath.Base(files[0]), "orders-") {
+		t.Errorf("expected orders rotated, got %v", files)
+	}
+}
+
+func TestFileRotateTicker(t *testing.T) {
+	s, dir := newTestFile(t, map[string]any{"rotate_interval": "50ms"})
+	event := consumer.RowEvent{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 1}}
+	if err := s.Write(context.Background(), []consumer.RowEvent{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 之后没有Write，定时轮转
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if files := rotatedFiles(t, dir); len(files) == 1 {
+			return
+		}
+	}
+	t.Errorf("expected users rotated without writes, got %v", rotatedFiles(t, dir))
+}
+
+func TestFileCsvColumnsChanged(t *testing.T) {
+	s, dir := newTestFile(t, map[string]any{"format": "csv"})
+
+	events := []consumer.RowEvent{
+		{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 1, "name": "a"}},
+		// 比如 ALTER TABLE ADD COLUMN
+		{ID: 2, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 2, "name": "b", "age": 3}},
+	}
+	if err := s.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	files := rotatedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 rotated file, got %v", files)
+	}
+	if records := readCsv(t, files[0]); !reflect.DeepEqual(records, [][]string{{"_id", "_action", "id", "name"}, {"1", "insert", "1", "a"}}) {
+		t.Errorf("unexpected rotated file: %v", records)
+	}
+	if records := readCsv(t, filepath.Join(dir, "users.log")); !reflect.DeepEqual(records, [][]string{{"_id", "_action", "age", "id", "name"}, {"2", "insert", "3", "2", "b"}}) {
+		t.Errorf("unexpected current file: %v", records)
+	}
+
+	// 重新打开时，表头相同的文件继续追加
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events[1].ID = 3
+	if err := s.Write(context.Background(), events[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if records := readCsv(t, filepath.Join(dir, "users.log")); len(records) != 3 {
+		t.Errorf("expected appended to the current file, got %v", records)
+	}
+	if files = rotatedFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected no more rotated file, got %v", files)
+	}
+}
+
+func TestFileUpload(t *testing.T) {
+	server, endpoint := newFakeS3(t)
+	s, dir := newTestFile(t, map[string]any{"max_size": "1B", "gzip": true, "upload": map[string]any{
+		"endpoint": endpoint, "bucket": "dm", "access_key_id": "AKID", "secret_access_key": "secret",
+	}})
+	// 其它rule正在写入的文件
+	writeTestFile(t, filepath.Join(dir, "orders.log"), []byte("open"))
+
+	event := consumer.RowEvent{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 1}}
+	if err := s.Write(context.Background(), []consumer.RowEvent{event}); err != nil {
+		t.Fatal(err)
+	}
+	files := rotatedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 rotated file, got %v", files)
+	}
+	// 压缩之后上传 ".gz"
+	key := filepath.Base(strings.TrimSuffix(files[0], ".gz")) + ".gz"
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if _, ok := server.object(key); ok {
+			break
+		}
+	}
+	waitUploaded(t, filepath.Join(dir, key))
+
+	if keys := server.keys(); len(keys) != 1 || keys[0] != key {
+		t.Errorf("unexpected objects %v", keys)
+	}
+	if files = parquetFiles(t, dir); strings.Join(files, ",") != "orders.log" {
+		t.Errorf("unexpected local files %v", files)
+	}
+}
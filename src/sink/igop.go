@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"context"
+	"go.uber.org/multierr"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/script"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"time"
+)
+
+// igopSink 在igop脚本中执行rule的call
+type igopSink struct {
+	script *script.Script
+	rule   *settings.RuleOptions
+	// Teardown的最长执行时间
+	grace time.Duration
+}
+
+func newIgopSink(script *script.Script) Sink {
+	return &igopSink{script: script}
+}
+
+func (s *igopSink) Open(ctx context.Context, params Params) error {
+	s.rule = params.Rule
+	s.grace = params.Settings.TaskOptions.ShutdownGrace
+	return nil
+}
+
+func (s *igopSink) Write(ctx context.Context, events []consumer.RowEvent) error {
+	methodErr, panicErr := s.script.CallRule(ctx, s.rule, events)
+	_methodErr, _ := methodErr.(error)
+	return multierr.Append(_methodErr, panicErr)
+}
+
+// Close 结束该rule常驻的解释器
+func (s *igopSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.grace)
+	defer cancel()
+	s.script.Release(ctx, s.rule.Key())
+	return nil
+}
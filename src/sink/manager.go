@@ -0,0 +1,189 @@
+package sink
+
+import (
+	"context"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/exporter"
+	"gopkg.in/go-mixed/dm.v1/src/script"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"sync"
+)
+
+// Manager 为每一个rule维护一个打开的Sink
+type Manager struct {
+	*component.Components
+	script *script.Script
+
+	lock  sync.Mutex
+	sinks map[string]Sink
+
+	// 不为nil时，只有igop脚本会被执行（写入由DryRun拦截），其它Sink和外部进程只记录不执行
+	dryRun *exporter.DryRun
+
+	// 快照中，之后打开的Reconciler也会开始快照
+	snapshot bool
+	// 快照中被关闭过的rules，它们的Reconciler丢失了快照的记录，不能对账
+	incomplete map[string]struct{}
+}
+
+func NewManager(components *component.Components, script *script.Script) *Manager {
+	return &Manager{
+		Components: components,
+		script:     script,
+		sinks:      map[string]Sink{},
+		incomplete: map[string]struct{}{},
+	}
+}
+
+func (m *Manager) SetDryRun(dryRun *exporter.DryRun) {
+	m.dryRun = dryRun
+}
+
+// Write 将events写入rule对应的Sink，rule.Timeout大于0时限制执行时长
+func (m *Manager) Write(ctx context.Context, rule *settings.RuleOptions, events []consumer.RowEvent) error {
+	if rule.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rule.Timeout)
+		defer cancel()
+	}
+
+	if m.dryRun != nil {
+		m.dryRun.SetScope(rule.Key())
+		if rule.Sink != "" || rule.IsProcess() {
+			m.dryRun.Skip(rule.SinkName(), len(events))
+			return nil
+		}
+	}
+
+	s, err := m.get(ctx, rule)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, events)
+}
+
+func (m *Manager) get(ctx context.Context, rule *settings.RuleOptions) (Sink, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if s, ok := m.sinks[rule.Key()]; ok {
+		return s, nil
+	}
+
+	var s Sink
+	if rule.IsProcess() {
+		s = newProcessSink()
+	} else if rule.Sink == "" {
+		s = newIgopSink(m.script)
+	} else {
+		var err error
+		if s, err = New(rule.Sink); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Open(ctx, Params{Components: m.Components, Rule: rule}); err != nil {
+		return nil, err
+	}
+	if r, ok := s.(Reconciler); ok && m.snapshot {
+		r.BeginSnapshot()
+	}
+	m.sinks[rule.Key()] = s
+	m.Logger.Info("[Sink]opened", zap.String("rule", rule.Key()), zap.String("sink", rule.SinkName()))
+	return s, nil
+}
+
+// Release 关闭某个rule的Sink，下次Write时会重新打开
+func (m *Manager) Release(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if s, ok := m.sinks[key]; ok {
+		delete(m.sinks, key)
+		if m.snapshot {
+			m.incomplete[key] = struct{}{}
+		}
+		if err := s.Close(); err != nil {
+			m.Logger.Error("[Sink]close error", zap.String("rule", key), zap.Error(err))
+		}
+	}
+}
+
+// BeginSnapshot 全量快照开始，通知所有的Reconciler
+func (m *Manager) BeginSnapshot() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.snapshot = true
+	m.incomplete = map[string]struct{}{}
+	for _, s := range m.sinks {
+		if r, ok := s.(Reconciler); ok {
+			r.BeginSnapshot()
+		}
+	}
+}
+
+// AbortSnapshot 快照被中断，不再对账，之后打开的Reconciler也不会开始快照
+func (m *Manager) AbortSnapshot() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.snapshot = false
+	m.incomplete = map[string]struct{}{}
+}
+
+// Reconcile 快照的events都已写入，对所有rules的Reconciler进行对账
+//
+//	快照中没有任何行的rule也会被打开，以便删除目标中所有的行
+func (m *Manager) Reconcile(ctx context.Context) error {
+	m.lock.Lock()
+	incomplete := m.incomplete
+	m.lock.Unlock()
+
+	defer func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		m.snapshot = false
+		m.incomplete = map[string]struct{}{}
+	}()
+
+	if m.dryRun != nil {
+		return nil
+	}
+
+	var errs error
+	for _, rule := range m.Settings.TaskOptions.Rules {
+		if rule.Sink == "" {
+			continue
+		} else if _, ok := incomplete[rule.Key()]; ok {
+			m.Logger.Warn("[Sink]skip reconciling, the sink was closed during the snapshot", zap.String("rule", rule.Key()))
+			continue
+		}
+
+		s, err := m.get(ctx, rule)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if r, ok := s.(Reconciler); ok {
+			errs = multierr.Append(errs, r.Reconcile(ctx))
+		}
+	}
+	return errs
+}
+
+// Close 关闭所有的Sink
+func (m *Manager) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var err error
+	for key, s := range m.sinks {
+		err = multierr.Append(err, s.Close())
+		delete(m.sinks, key)
+	}
+	return err
+}
@@ -0,0 +1,595 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/dm.v1/src/parquet"
+	"gopkg.in/go-mixed/go-common.v1/utils/io"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// parquet文件中的元数据列
+const (
+	parquetColumnID       = "_id"
+	parquetColumnAction   = "_action"
+	parquetColumnPosition = "_binlog_position"
+	parquetColumnCommitAt = "_commit_time"
+)
+
+// parquetOptions parquet的options
+type parquetOptions struct {
+	// 文件路径的模板，可以使用 {schema} {table} {date} {time}（文件创建的时间），相对路径基于程序目录
+	Path string `yaml:"path"`
+	// none或者gzip
+	Compression string `yaml:"compression"`
+	// 每个表缓冲的行数达到该值时写入一个行组
+	RowGroupSize int `yaml:"row_group_size"`
+	// 缓冲的第一行超过该时长时写入行组，0表示只按RowGroupSize，在Write时检查
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// 文件的行组数量达到该值时开始新的文件，footer中包含所有的行组，所以需要限制，0表示不限
+	MaxRowGroups int `yaml:"max_row_groups"`
+	// 文件的行数超过该值时开始新的文件，0表示不限
+	MaxRows int64 `yaml:"max_rows"`
+	// 文件打开超过该时长时开始新的文件，0表示不限
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	// 上传关闭的文件，上传成功后删除本地文件
+	Upload uploadOptions `yaml:"upload"`
+}
+
+func defaultParquetOptions() parquetOptions {
+	return parquetOptions{
+		Path:           "parquet/{schema}/{table}/{date}/{time}.parquet",
+		Compression:    "gzip",
+		RowGroupSize:   10000,
+		FlushInterval:  time.Minute,
+		MaxRowGroups:   100,
+		MaxRows:        1000000,
+		RotateInterval: time.Hour,
+		Upload:         defaultUploadOptions(),
+	}
+}
+
+// parquetSink 按表写入parquet文件，schema由storage中记录的表结构生成
+//
+//	每个表的行先缓冲在内存和 ".rows" 文件中，达到RowGroupSize或者FlushInterval时写入一个行组并重写footer，
+//	所以文件在最后一个footer之前都是完整可读的；进程退出后，Open时将 ".rows" 中的行写入新的文件。
+//	表结构变化时开始新的文件。整批重试时会重复写入，可以按_id去重
+type parquetSink struct {
+	params   Params
+	options  parquetOptions
+	path     *keyTemplate
+	codec    parquet.Codec
+	location *time.Location
+	uploader *uploader
+
+	files map[string]*parquetFile
+}
+
+// parquetFile 一个表正在写入的文件
+type parquetFile struct {
+	path        string
+	table       string
+	file        *os.File
+	writer      *parquet.Writer
+	fingerprint string
+	columns     []consumer.TableColumn
+	openedAt    time.Time
+
+	// 还没有写入行组的行
+	rows       [][]any
+	bufferedAt time.Time
+	spool      *os.File
+	encoder    *gob.Encoder
+}
+
+// parquetSpoolHeader ".rows" 文件的开头，之后为缓冲的每一行
+type parquetSpoolHeader struct {
+	Rule  string
+	Table string
+	Path  string
+	// parquet文件最后一个footer的结束位置，0表示还没有footer
+	Size    int64
+	Columns []parquet.Column
+}
+
+// parquetSpoolExt 缓冲的行保存在 "文件路径.rows" 中
+const parquetSpoolExt = ".rows"
+
+func init() {
+	Register("parquet", func() Sink { return &parquetSink{} })
+}
+
+func (s *parquetSink) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultParquetOptions()
+	s.files = map[string]*parquetFile{}
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	var err error
+	if s.path, err = parseKeyTemplate(io_utils.MakePathFromRelative("", s.options.Path)); err != nil {
+		return err
+	}
+	for _, column := range s.path.Columns() {
+		switch column {
+		case "schema", "table", "date", "time":
+		default:
+			return errors.Errorf("[Sink]only {schema} {table} {date} {time} can be used in \"path\" of rule \"%s\"", params.Rule.Key())
+		}
+	}
+	if s.options.RowGroupSize <= 0 {
+		return errors.Errorf("[Sink]\"row_group_size\" must be greater than 0 in rule \"%s\"", params.Rule.Key())
+	}
+
+	switch s.options.Compression {
+	case "none", "":
+		s.codec = parquet.Uncompressed
+	case "gzip":
+		s.codec = parquet.Gzip
+	default:
+		return errors.Errorf("[Sink]unsupported compression \"%s\" in rule \"%s\"", s.options.Compression, params.Rule.Key())
+	}
+
+	// TIMESTAMP列的字符串是MySQL时区的时间
+	if s.location, err = time.LoadLocation(params.Settings.MySqlOptions.TimeZone); err != nil {
+		s.location = time.Local
+	}
+
+	if s.uploader, err = newUploader(params, s.options.Upload, uploadRoot(s.path)); err != nil {
+		return err
+	}
+	// 上次退出时没有关闭的文件
+	s.recover()
+	return nil
+}
+
+func (s *parquetSink) Write(ctx context.Context, events []consumer.RowEvent) error {
+	// 按表分组，同一个表内保持顺序
+	var tables []string
+	grouped := map[string][]*consumer.RowEvent{}
+	for i := range events {
+		key := events[i].Schema + "." + events[i].Table
+		if _, ok := grouped[key]; !ok {
+			tables = append(tables, key)
+		}
+		grouped[key] = append(grouped[key], &events[i])
+	}
+
+	for _, key := range tables {
+		if err := s.writeTable(ctx, key, grouped[key]); err != nil {
+			return err
+		}
+	}
+
+	// 没有新的行的表也需要检查FlushInterval、RotateInterval
+	for _, f := range s.files {
+		if err := s.sync(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTable 将行加入缓冲，达到RowGroupSize时写入行组
+func (s *parquetSink) writeTable(ctx context.Context, key string, events []*consumer.RowEvent) error {
+	for _, event := range events {
+		table := event.GetTable()
+		if table == nil {
+			return errors.Errorf("[Sink]table structure of \"%s\" not found", key)
+		}
+
+		f, err := s.get(key, event, table, parquetFingerprint(table))
+		if err != nil {
+			return err
+		}
+		row := s.row(ctx, f.columns, event)
+		if err = f.encoder.Encode(row); err != nil {
+			return errors.Wrapf(err, "[Sink]write \"%s\" error", f.spool.Name())
+		}
+		if len(f.rows) <= 0 {
+			f.bufferedAt = time.Now()
+		}
+		f.rows = append(f.rows, row)
+
+		if len(f.rows) >= s.options.RowGroupSize {
+			if err = s.flush(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sync Write结束时调用：fsync缓冲的行，达到FlushInterval时写入行组，达到轮转的条件时关闭文件
+func (s *parquetSink) sync(f *parquetFile) error {
+	if len(f.rows) > 0 {
+		if s.options.FlushInterval > 0 && time.Since(f.bufferedAt) >= s.options.FlushInterval {
+			if err := s.flush(f); err != nil {
+				return err
+			}
+		} else if err := f.spool.Sync(); err != nil {
+			return errors.Wrapf(err, "[Sink]fsync \"%s\" error", f.spool.Name())
+		}
+	}
+
+	if (s.options.MaxRows > 0 && f.writer.NumRows()+int64(len(f.rows)) >= s.options.MaxRows) ||
+		(s.options.MaxRowGroups > 0 && f.writer.NumRowGroups() >= s.options.MaxRowGroups) ||
+		(s.options.RotateInterval > 0 && time.Since(f.openedAt) >= s.options.RotateInterval) {
+		return s.close(f)
+	}
+	return nil
+}
+
+// flush 将缓冲的行写入一个行组和footer并fsync，然后清空 ".rows"
+func (s *parquetSink) flush(f *parquetFile) error {
+	if len(f.rows) <= 0 {
+		return nil
+	}
+	if err := f.writer.WriteRowGroup(f.rows); err != nil {
+		return errors.WithMessagef(err, "[Sink]write \"%s\" error", f.path)
+	}
+	if err := f.writer.WriteFooter(); err != nil {
+		return errors.WithMessagef(err, "[Sink]write footer of \"%s\" error", f.path)
+	}
+	if err := f.file.Sync(); err != nil {
+		return errors.Wrapf(err, "[Sink]fsync \"%s\" error", f.path)
+	}
+	f.rows = nil
+	return s.resetSpool(f)
+}
+
+// resetSpool 清空 ".rows"，重新写入包含当前文件大小的header
+func (s *parquetSink) resetSpool(f *parquetFile) error {
+	if err := f.spool.Truncate(0); err != nil {
+		return errors.Wrapf(err, "[Sink]truncate \"%s\" error", f.spool.Name())
+	}
+	if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "[Sink]seek \"%s\" error", f.spool.Name())
+	}
+
+	header := parquetSpoolHeader{Rule: s.params.Rule.Key(), Table: f.table, Path: f.path, Columns: f.writer.Columns()}
+	if f.writer.NumRowGroups() > 0 {
+		header.Size = f.writer.Size()
+	}
+	// gob的类型信息写在每个流的开头，所以每次清空后使用新的encoder
+	f.encoder = gob.NewEncoder(f.spool)
+	if err := f.encoder.Encode(header); err != nil {
+		return errors.Wrapf(err, "[Sink]write \"%s\" error", f.spool.Name())
+	}
+	return errors.Wrapf(f.spool.Sync(), "[Sink]fsync \"%s\" error", f.spool.Name())
+}
+
+// get 返回表正在写入的文件，表结构变化时关闭旧的文件
+func (s *parquetSink) get(key string, event *consumer.RowEvent, table *consumer.Table, fingerprint string) (*parquetFile, error) {
+	if f, ok := s.files[key]; ok {
+		if f.fingerprint == fingerprint {
+			return f, nil
+		}
+		s.params.Logger.Info("[Sink]table structure changed, start a new parquet file", zap.String("rule", s.params.Rule.Key()), zap.String("table", key))
+		if err := s.close(f); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	path, err := s.path.Execute(map[string]any{"schema": event.Schema, "table": event.Table, "date": now.Format("20060102"), "time": now.Format("150405")})
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []parquet.Column{
+		{Name: parquetColumnID, Type: parquet.Int64, Logical: parquet.IntegerType(64, false)},
+		{Name: parquetColumnAction, Type: parquet.ByteArray, Logical: parquet.StringType()},
+		{Name: parquetColumnPosition, Type: parquet.ByteArray, Logical: parquet.StringType(), Optional: true},
+		{Name: parquetColumnCommitAt, Type: parquet.Int64, Logical: parquet.TimestampType(true), Optional: true},
+	}
+	for _, column := range table.Columns {
+		columns = append(columns, parquetColumn(column))
+	}
+
+	f, err := s.create(path, key, columns)
+	if err != nil {
+		return nil, err
+	}
+	f.fingerprint = fingerprint
+	f.columns = table.Columns
+	f.openedAt = now
+
+	f.spool, err = os.OpenFile(f.path+parquetSpoolExt, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err == nil {
+		err = s.resetSpool(f)
+	}
+	if err != nil {
+		_ = f.file.Close()
+		if f.spool != nil {
+			_ = f.spool.Close()
+		}
+		return nil, errors.WithMessagef(err, "[Sink]create \"%s\" error", f.path+parquetSpoolExt)
+	}
+	s.files[key] = f
+	return f, nil
+}
+
+// create 创建新的parquet文件，path已经存在时添加序号
+func (s *parquetSink) create(path, table string, columns []parquet.Column) (*parquetFile, error) {
+	path = uniquePath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Wrapf(err, "[Sink]create directory of \"%s\" error", path)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[Sink]create \"%s\" error", path)
+	}
+
+	writer, err := parquet.NewWriter(file, columns, s.codec)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	writer.SetMetadata("dm.table", table)
+	writer.SetMetadata("dm.rule", s.params.Rule.Key())
+	return &parquetFile{path: path, table: table, file: file, writer: writer}, nil
+}
+
+// close 写入缓冲的行，关闭文件并删除 ".rows"，然后加入上传队列
+func (s *parquetSink) close(f *parquetFile) error {
+	for key, _f := range s.files {
+		if _f == f {
+			delete(s.files, key)
+		}
+	}
+	err := s.flush(f)
+	if err = multierr.Append(err, f.file.Close()); err != nil {
+		_ = f.spool.Close()
+		return errors.Wrapf(err, "[Sink]close \"%s\" error", f.path)
+	}
+	_ = f.spool.Close()
+
+	// 没有任何行组的文件不是有效的parquet文件
+	if f.writer.NumRowGroups() <= 0 {
+		_ = os.Remove(f.path)
+		_ = os.Remove(f.spool.Name())
+		return nil
+	}
+	// 删除 ".rows" 之后就不会再恢复这个文件，所以需要在这之前标记上传
+	if s.uploader != nil {
+		s.uploader.Mark(f.path)
+	}
+	_ = os.Remove(f.spool.Name())
+	s.params.Logger.Info("[Sink]parquet file closed", zap.String("rule", s.params.Rule.Key()), zap.String("file", f.path), zap.Int64("rows", f.writer.NumRows()))
+	if s.uploader != nil {
+		s.uploader.Enqueue(f.path)
+	}
+	return nil
+}
+
+// recover 上次退出时没有关闭的文件：截断到最后一个footer，缓冲的行写入一个新的文件，然后都加入上传队列
+func (s *parquetSink) recover() {
+	_ = filepath.WalkDir(uploadRoot(s.path), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, parquetSpoolExt) {
+			return nil
+		}
+		if err = s.recoverSpool(path); err != nil {
+			s.params.Logger.Error("[Sink]recover parquet file error", zap.String("rule", s.params.Rule.Key()), zap.String("file", path), zap.Error(err))
+		}
+		return nil
+	})
+}
+
+func (s *parquetSink) recoverSpool(path string) error {
+	spool, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer spool.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(spool))
+	var header parquetSpoolHeader
+	if err = decoder.Decode(&header); err != nil {
+		return errors.Wrap(err, "[Sink]decode header error")
+	} else if header.Rule != s.params.Rule.Key() { // 其它rule的文件
+		return nil
+	}
+
+	if header.Size > 0 {
+		if err = os.Truncate(header.Path, header.Size); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		} else if err == nil && s.uploader != nil {
+			s.uploader.Enqueue(header.Path)
+		}
+	} else if err = os.Remove(header.Path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	// 最后一行可能只写入了一部分，这一批没有成功返回，会被重试
+	var rows [][]any
+	for {
+		var row []any
+		if decoder.Decode(&row) != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 {
+		f, err := s.create(header.Path, header.Table, header.Columns)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(rows); start += s.options.RowGroupSize {
+			end := start + s.options.RowGroupSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if err = f.writer.WriteRowGroup(rows[start:end]); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = f.writer.WriteFooter()
+		}
+		if err == nil {
+			err = f.file.Sync()
+		}
+		if err = multierr.Append(err, f.file.Close()); err != nil {
+			_ = os.Remove(f.path)
+			return errors.WithMessagef(err, "[Sink]write \"%s\" error", f.path)
+		}
+		s.params.Logger.Info("[Sink]recovered the buffered rows of parquet file", zap.String("rule", s.params.Rule.Key()), zap.String("file", f.path), zap.Int("rows", len(rows)))
+		if s.uploader != nil {
+			s.uploader.Enqueue(f.path)
+		}
+	}
+
+	_ = spool.Close()
+	return errors.WithStack(os.Remove(path))
+}
+
+// row 元数据列和表的所有列，delete使用旧的行
+func (s *parquetSink) row(ctx context.Context, columns []consumer.TableColumn, event *consumer.RowEvent) []any {
+	values := []any{int64(event.ID), event.Action, nil, nil}
+	if meta, ok := EventMetaFrom(ctx, event.ID); ok {
+		values[2] = meta.Position()
+		if at := meta.CommitTime(); !at.IsZero() {
+			values[3] = at.UnixMicro()
+		}
+	}
+
+	row := event.NewRow
+	if event.Action == "delete" {
+		row = event.OldRow
+	}
+	for _, column := range columns {
+		values = append(values, parquetValue(column, row[column.Name], s.location))
+	}
+	return values
+}
+
+func (s *parquetSink) Close() error {
+	var err error
+	for _, f := range s.files {
+		err = multierr.Append(err, s.close(f))
+	}
+	if s.uploader != nil {
+		s.uploader.Close()
+	}
+	return err
+}
+
+// parquetFingerprint 列名、类型变化时需要新的文件
+func parquetFingerprint(table *consumer.Table) string {
+	var sb strings.Builder
+	for _, column := range table.Columns {
+		sb.WriteString(fmt.Sprintf("%s %d %s %t;", column.Name, column.Type, column.RawType, column.IsUnsigned))
+	}
+	return sb.String()
+}
+
+// parquetColumn MySQL列类型对应的parquet类型，所有的列都可以为NULL
+func parquetColumn(column consumer.TableColumn) parquet.Column {
+	c := parquet.Column{Name: column.Name, Optional: true}
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT:
+		c.Type, c.Logical = parquet.Int64, parquet.IntegerType(64, !column.IsUnsigned)
+	case consumer.TYPE_BIT:
+		c.Type, c.Logical = parquet.Int64, parquet.IntegerType(64, false)
+	case consumer.TYPE_FLOAT:
+		c.Type = parquet.Double
+	case consumer.TYPE_DECIMAL:
+		if precision, scale, ok := format.ParseDecimalType(column.RawType); ok {
+			c.Type, c.Logical = parquet.ByteArray, parquet.DecimalType(precision, scale)
+		} else {
+			c.Type, c.Logical = parquet.ByteArray, parquet.StringType()
+		}
+	case consumer.TYPE_DATE:
+		c.Type, c.Logical = parquet.Int32, parquet.DateType()
+	case consumer.TYPE_DATETIME:
+		c.Type, c.Logical = parquet.Int64, parquet.TimestampType(false)
+	case consumer.TYPE_TIMESTAMP:
+		c.Type, c.Logical = parquet.Int64, parquet.TimestampType(true)
+	case consumer.TYPE_JSON:
+		c.Type, c.Logical = parquet.ByteArray, parquet.JsonType()
+	case consumer.TYPE_ENUM:
+		c.Type, c.Logical = parquet.ByteArray, parquet.EnumType()
+	case consumer.TYPE_BINARY:
+		c.Type = parquet.ByteArray
+	default: // string, set, time, point
+		c.Type, c.Logical = parquet.ByteArray, parquet.StringType()
+	}
+	return c
+}
+
+// parquetValue 将canal中的值转为parquetColumn对应的类型，无法转换的值（比如 0000-00-00）为NULL
+func parquetValue(column consumer.TableColumn, val any, location *time.Location) any {
+	if val == nil {
+		return nil
+	}
+
+	switch column.Type {
+	case consumer.TYPE_NUMBER, consumer.TYPE_MEDIUM_INT, consumer.TYPE_BIT:
+		if i, ok := format.ToInt64(val); ok {
+			return i // UINT_64按位存储
+		}
+		return nil
+	case consumer.TYPE_FLOAT:
+		if f, ok := format.ToFloat64(val); ok {
+			return f
+		}
+		return nil
+	case consumer.TYPE_DECIMAL:
+		if _, scale, ok := format.ParseDecimalType(column.RawType); ok {
+			if b := format.DecimalBytes(format.ToString(val), int(scale)); b != nil {
+				return b
+			}
+			return nil
+		}
+		return format.ToString(val)
+	case consumer.TYPE_DATE:
+		if days, ok := format.ParseDate(val); ok {
+			return days
+		}
+		return nil
+	case consumer.TYPE_DATETIME, consumer.TYPE_TIMESTAMP:
+		loc := time.UTC // DATETIME没有时区，按照字面值存储
+		if column.Type == consumer.TYPE_TIMESTAMP {
+			loc = location
+		}
+		if t, ok := format.ParseDatetime(val, loc); ok {
+			return t.UnixMicro()
+		}
+		return nil
+	case consumer.TYPE_ENUM:
+		return format.EnumString(column, val)
+	case consumer.TYPE_SET:
+		return format.SetString(column, val)
+	case consumer.TYPE_BINARY:
+		return format.ToBytes(val)
+	}
+	return format.ToString(val)
+}
+
+// uniquePath 文件已经存在时添加 "-1" "-2" 等后缀
+func uniquePath(path string) string {
+	if !io_utils.PathExists(path) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), i, ext)
+		if !io_utils.PathExists(p) {
+			return p
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func openTestParquet(t *testing.T, dir string, options map[string]any) *parquetSink {
+	consumer.GetTableFn = func(string) *consumer.Table {
+		return &consumer.Table{Schema: "test_db", Name: "users", Columns: []consumer.TableColumn{
+			{Name: "id", Type: consumer.TYPE_NUMBER, RawType: "bigint"},
+			{Name: "name", Type: consumer.TYPE_STRING, RawType: "varchar(20)"},
+		}}
+	}
+	options["path"] = filepath.Join(dir, "{table}-{time}.parquet")
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &parquetSink{}
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "parquet", Options: options},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testParquetEvents(start, n int) []consumer.RowEvent {
+	var events []consumer.RowEvent
+	for i := start; i < start+n; i++ {
+		events = append(events, consumer.RowEvent{ID: uint64(i), Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": i, "name": "a"}})
+	}
+	return events
+}
+
+// parquetFiles 目录中的文件名
+func parquetFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	sort.Strings(files)
+	return files
+}
+
+// isCompleteParquet 文件以footer结束
+func isCompleteParquet(t *testing.T, path string) bool {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(buf) > 12 && bytes.HasPrefix(buf, []byte("PAR1")) && bytes.HasSuffix(buf, []byte("PAR1"))
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestParquet(t, dir, map[string]any{"row_group_size": 10, "max_row_groups": 3})
+	ctx := context.Background()
+
+	// 不足row_group_size时只缓冲
+	if err := s.Write(ctx, testParquetEvents(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	f := s.files["test_db.users"]
+	if f == nil || f.writer.NumRowGroups() != 0 || len(f.rows) != 4 {
+		t.Fatalf("expected 4 buffered rows, got %+v", f)
+	}
+	if _, err := os.Stat(f.path + parquetSpoolExt); err != nil {
+		t.Fatalf("expected the spool of buffered rows: %v", err)
+	}
+
+	// 每10行一个行组，3个行组之后开始新的文件
+	if err := s.Write(ctx, testParquetEvents(5, 21)); err != nil {
+		t.Fatal(err)
+	}
+	if f.writer.NumRowGroups() != 2 || len(f.rows) != 5 {
+		t.Fatalf("expected 2 row groups and 5 buffered rows, got %d %d", f.writer.NumRowGroups(), len(f.rows))
+	}
+	if err := s.Write(ctx, testParquetEvents(26, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.files["test_db.users"]; ok {
+		t.Fatal("expected the file closed after max_row_groups")
+	}
+	if !isCompleteParquet(t, f.path) || f.writer.NumRows() != 30 {
+		t.Errorf("expected a complete file of 30 rows, got %d", f.writer.NumRows())
+	}
+
+	// Close时写入缓冲的行
+	if err := s.Write(ctx, testParquetEvents(31, 2)); err != nil {
+		t.Fatal(err)
+	}
+	f = s.files["test_db.users"]
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !isCompleteParquet(t, f.path) || f.writer.NumRows() != 2 {
+		t.Errorf("expected a complete file of 2 rows, got %d", f.writer.NumRows())
+	}
+	for _, name := range parquetFiles(t, dir) {
+		if strings.HasSuffix(name, parquetSpoolExt) {
+			t.Errorf("unexpected spool %s", name)
+		}
+	}
+}
+
+func TestParquetRecover(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestParquet(t, dir, map[string]any{"row_group_size": 10})
+	ctx := context.Background()
+	if err := s.Write(ctx, testParquetEvents(1, 13)); err != nil {
+		t.Fatal(err)
+	}
+	f := s.files["test_db.users"]
+	size := f.writer.Size()
+	// 进程退出时正在写入一个行组
+	if _, err := f.file.Write([]byte("partial row group")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其它rule的文件不会被恢复
+	other := openTestParquet(t, t.TempDir(), map[string]any{})
+	other.params.Rule = &settings.RuleOptions{Schema: "other_db", Table: "users"}
+	other.options.Path = s.options.Path
+	other.path = s.path
+	other.recover()
+	if _, err := os.Stat(f.path + parquetSpoolExt); err != nil {
+		t.Fatalf("the spool of another rule is recovered: %v", err)
+	}
+
+	s2 := openTestParquet(t, dir, map[string]any{"row_group_size": 10})
+	defer s2.Close()
+
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != size || !isCompleteParquet(t, f.path) {
+		t.Errorf("expected truncated to %d, got %d", size, stat.Size())
+	}
+	// 缓冲的3行写入新的文件
+	recovered := strings.TrimSuffix(f.path, ".parquet") + "-1.parquet"
+	if !isCompleteParquet(t, recovered) {
+		t.Errorf("expected the buffered rows in %s, files: %v", recovered, parquetFiles(t, dir))
+	}
+	if _, err = os.Stat(f.path + parquetSpoolExt); !os.IsNotExist(err) {
+		t.Errorf("expected the spool removed: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+)
+
+// PoisonError 重试也不会成功的批次（比如webhook返回4xx），Task会将这批events移入死信，然后继续消费
+type PoisonError struct {
+	err error
+	// 需要移入死信的events，nil表示整个批次，批次中的其它events已经写入成功
+	events []consumer.RowEvent
+}
+
+func NewPoisonError(err error) error {
+	return &PoisonError{err: err}
+}
+
+// NewPoisonEventsError 批次中只有events重试也不会成功，其它events已经写入
+func NewPoisonEventsError(err error, events []consumer.RowEvent) error {
+	return &PoisonError{err: err, events: events}
+}
+
+func (e *PoisonError) Error() string {
+	return "poison batch: " + e.err.Error()
+}
+
+func (e *PoisonError) Unwrap() error {
+	return e.err
+}
+
+// IsPoison err中是否包含PoisonError
+func IsPoison(err error) bool {
+	var poison *PoisonError
+	return errors.As(err, &poison)
+}
+
+// PoisonEvents 需要移入死信的events，batch为写入的整个批次
+func PoisonEvents(err error, batch []consumer.RowEvent) []consumer.RowEvent {
+	var poison *PoisonError
+	if !errors.As(err, &poison) {
+		return nil
+	} else if poison.events == nil {
+		return batch
+	}
+	return poison.events
+}
+
+// poisonBatch 收集批次中重试也不会成功的events，跳过它们继续写入其它events
+type poisonBatch struct {
+	events []consumer.RowEvent
+	errs   []error
+}
+
+func (p *poisonBatch) add(err error, events ...consumer.RowEvent) {
+	p.events = append(p.events, events...)
+	p.errs = append(p.errs, err)
+}
+
+// err 没有poison的events时返回nil，否则返回只包含这些events的PoisonError
+func (p *poisonBatch) err() error {
+	if len(p.events) <= 0 {
+		return nil
+	}
+	return NewPoisonEventsError(multierr.Combine(p.errs...), p.events)
+}
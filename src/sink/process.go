@@ -0,0 +1,369 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// processOptions rule的call为 "process:" 时的options
+type processOptions struct {
+	// 附加的环境变量，子进程还会收到 DM_RULE=schema.table
+	Env map[string]string `yaml:"env"`
+	// 子进程退出后，重启前的等待时间，连续失败时翻倍，最多MaxBackoff
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+
+	serializerOptions `yaml:",inline"`
+}
+
+func defaultProcessOptions() processOptions {
+	return processOptions{
+		Backoff:    time.Second,
+		MaxBackoff: 30 * time.Second,
+
+		serializerOptions: defaultSerializerOptions(),
+	}
+}
+
+// processRequest 写入子进程stdin的一行，events为format序列化的JSON
+type processRequest struct {
+	ID        uint64            `json:"id"`
+	Rule      string            `json:"rule"`
+	Arguments []string          `json:"arguments"`
+	Events    []json.RawMessage `json:"events"`
+}
+
+// processResponse 子进程stdout中的一行，ack为false时这批events会在下次触发时重试，
+// poison为true时移入死信
+type processResponse struct {
+	ID     uint64 `json:"id"`
+	Ack    bool   `json:"ack"`
+	Error  string `json:"error"`
+	Poison bool   `json:"poison"`
+}
+
+// processSink 在常驻的子进程中执行rule的call，使用换行分隔的JSON通讯：
+//
+//	stdin:  {"id": 1, "rule": "db.table", "arguments": [...], "events": [...]}
+//	stdout: {"id": 1, "ack": true} 或 {"id": 1, "ack": false, "error": "...", "poison": false}
+//
+// 每次只发送一批，收到相同id的回复之后才会发送下一批；stdout中非JSON或者id不同的行会被忽略，
+// stderr的每一行写入日志。子进程退出或者超时（rule.Timeout）时，这批events失败，下次Write时重启子进程
+type processSink struct {
+	params     Params
+	options    processOptions
+	serializer format.Serializer
+	command    []string
+	// Close时等待子进程退出的时间
+	grace time.Duration
+
+	lock sync.Mutex
+	proc *childProcess
+	seq  uint64
+	// 连续失败（退出、被杀死）的次数，收到回复后清零
+	failures int
+	exitedAt time.Time
+}
+
+func newProcessSink() Sink {
+	return &processSink{}
+}
+
+func (s *processSink) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultProcessOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	var err error
+	if s.command, err = params.Rule.Command(); err != nil {
+		return errors.WithMessagef(err, "[Sink]invalid command of rule \"%s\"", params.Rule.Key())
+	} else if len(s.command) <= 0 {
+		return errors.Errorf("[Sink]empty command of \"%s\" in rule \"%s\"", params.Rule.Call, params.Rule.Key())
+	}
+
+	if s.serializer, err = newSerializer(params, s.options.Format, s.options.FormatOptions); err != nil {
+		return err
+	}
+	if s.serializer.ContentType() != "application/json" {
+		return errors.Errorf("[Sink]format \"%s\" is not JSON, which can not be used in rule \"%s\"", s.options.Format, params.Rule.Key())
+	}
+
+	s.grace = params.Settings.TaskOptions.ShutdownGrace
+	return nil
+}
+
+func (s *processSink) Write(ctx context.Context, events []consumer.RowEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req := processRequest{Rule: s.params.Rule.Key(), Arguments: s.params.Rule.Arguments}
+	if req.Arguments == nil {
+		req.Arguments = []string{}
+	}
+	// 不兼容schema_registry的events不发送，子进程ack之后移入死信
+	var poison poisonBatch
+	for _, event := range events {
+		buf, err := marshalEvent(ctx, s.serializer, event)
+		if registry.IsIncompatible(err) {
+			poison.add(err, event)
+			continue
+		} else if err != nil {
+			return err
+		}
+		req.Events = append(req.Events, buf)
+	}
+	if len(req.Events) <= 0 {
+		return poison.err()
+	}
+
+	p, err := s.running()
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	req.ID = s.seq
+	buf, err := text_utils.JsonMarshalToBytes(req)
+	if err != nil {
+		return errors.Wrap(err, "[Process]encode request error")
+	}
+
+	// 子进程不读取stdin时写入会阻塞，所以也需要遵守ctx
+	written := make(chan error, 1)
+	go func() {
+		_, err := p.stdin.Write(append(buf, '\n'))
+		written <- err
+	}()
+
+	for {
+		select {
+		case err = <-written:
+			if err != nil {
+				s.kill(p, "write stdin error")
+				return errors.Wrapf(err, "[Process]write to \"%s\" error", s.params.Rule.Call)
+			}
+			written = nil
+		case line, ok := <-p.lines:
+			if !ok {
+				<-p.done
+				s.exited(p)
+				return errors.Errorf("[Process]\"%s\" exited before replying: %s", s.params.Rule.Call, p.cmd.ProcessState)
+			}
+			if line = bytes.TrimSpace(line); len(line) <= 0 {
+				continue
+			}
+
+			var resp processResponse
+			if err = json.Unmarshal(line, &resp); err != nil || resp.ID != req.ID {
+				s.params.Logger.Warn("[Process]ignored a line of stdout", zap.String("rule", s.params.Rule.Key()), zap.Uint64("id", req.ID), zap.ByteString("line", line))
+				continue
+			}
+
+			s.failures = 0
+			if resp.Ack {
+				return poison.err()
+			}
+			err = errors.Errorf("[Process]\"%s\" nack: %s", s.params.Rule.Call, resp.Error)
+			if resp.Poison {
+				return NewPoisonError(err)
+			}
+			return err
+		case <-ctx.Done():
+			// 子进程可能仍在处理这批events，迟到的回复无法与下一批区分，所以杀死它
+			s.kill(p, "call abandoned")
+			return errors.Wrap(ctx.Err(), "[Process]call abandoned")
+		}
+	}
+}
+
+// Close 关闭stdin通知子进程退出，ShutdownGrace之后杀死
+func (s *processSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.proc
+	if p == nil {
+		return nil
+	}
+	s.proc = nil
+
+	p.stop()
+	_ = p.stdin.Close()
+	select {
+	case <-p.done:
+		s.params.Logger.Info("[Process]stopped", zap.String("rule", s.params.Rule.Key()), zap.Int("pid", p.cmd.Process.Pid))
+	case <-time.After(s.grace):
+		_ = p.cmd.Process.Kill()
+		s.params.Logger.Warn("[Process]killed after the shutdown grace", zap.String("rule", s.params.Rule.Key()), zap.Int("pid", p.cmd.Process.Pid))
+	}
+	return nil
+}
+
+// running 返回运行中的子进程，没有时启动一个，连续失败时需要等待backoff之后才能重启
+func (s *processSink) running() (*childProcess, error) {
+	if s.proc != nil {
+		select {
+		case <-s.proc.done:
+			s.exited(s.proc)
+		default:
+			return s.proc, nil
+		}
+	}
+
+	if s.failures > 0 {
+		backoff := s.options.Backoff << (s.failures - 1)
+		if backoff > s.options.MaxBackoff || backoff <= 0 {
+			backoff = s.options.MaxBackoff
+		}
+		if wait := backoff - time.Since(s.exitedAt); wait > 0 {
+			return nil, errors.Errorf("[Process]\"%s\" will be restarted in %s", s.params.Rule.Call, wait.Round(time.Millisecond))
+		}
+	}
+
+	p, err := s.start()
+	if err != nil {
+		s.failures++
+		s.exitedAt = time.Now()
+		return nil, err
+	}
+	s.proc = p
+	s.params.Logger.Info("[Process]started",
+		zap.String("rule", s.params.Rule.Key()),
+		zap.Strings("command", s.command),
+		zap.Int("pid", p.cmd.Process.Pid),
+		zap.Int("failures", s.failures),
+	)
+	return p, nil
+}
+
+// start 在ScriptDir中启动子进程
+func (s *processSink) start() (*childProcess, error) {
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Dir = s.params.Settings.TaskOptions.ScriptDir
+	cmd.Env = append(os.Environ(), "DM_RULE="+s.params.Rule.Key())
+	for k, v := range s.options.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "[Process]create stdin error")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "[Process]create stdout error")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "[Process]create stderr error")
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "[Process]start \"%s\" error", s.params.Rule.Call)
+	}
+
+	p := &childProcess{
+		cmd:      cmd,
+		stdin:    stdin,
+		lines:    make(chan []byte),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	logger := s.params.Logger.With(zap.String("rule", s.params.Rule.Key()), zap.Int("pid", cmd.Process.Pid))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(p.lines)
+		p.readStdout(stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			logger.Info("[Process]stderr", zap.String("line", scanner.Text()))
+		}
+	}()
+	// Wait需要在stdout、stderr读取完毕之后调用
+	go func() {
+		wg.Wait()
+		p.err = cmd.Wait()
+		close(p.done)
+
+		select {
+		case <-p.stopping:
+		default:
+			logger.Error("[Process]exited unexpectedly", zap.Error(p.err))
+		}
+	}()
+	return p, nil
+}
+
+// kill 杀死子进程，不等待它退出
+func (s *processSink) kill(p *childProcess, reason string) {
+	p.stop()
+	_ = p.cmd.Process.Kill()
+	s.exited(p)
+	s.params.Logger.Warn("[Process]killed", zap.String("rule", s.params.Rule.Key()), zap.Int("pid", p.cmd.Process.Pid), zap.String("reason", reason))
+}
+
+// exited 记录一次失败，下次Write时重启
+func (s *processSink) exited(p *childProcess) {
+	if s.proc == p {
+		s.proc = nil
+	}
+	s.failures++
+	s.exitedAt = time.Now()
+}
+
+// childProcess 一个运行中的子进程
+type childProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// stdout的每一行，子进程退出后关闭
+	lines chan []byte
+
+	stopOnce sync.Once
+	// 主动停止时关闭，之后stdout的行被丢弃
+	stopping chan struct{}
+	// Wait返回后关闭，err为退出的原因
+	done chan struct{}
+	err  error
+}
+
+func (p *childProcess) stop() {
+	p.stopOnce.Do(func() { close(p.stopping) })
+}
+
+// readStdout 没有Write等待回复时，读取会阻塞，直到下一次Write或者停止
+func (p *childProcess) readStdout(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			select {
+			case p.lines <- line:
+			case <-p.stopping:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
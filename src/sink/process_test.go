@@ -0,0 +1,188 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain 测试的可执行文件同时作为processSink的子进程，由环境变量选择
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") == "1" {
+		helperProcess(os.Getenv("HELPER_MODE"))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// helperProcess 子进程，按mode回复stdin中的每一个请求
+//
+//	ack: 先输出非JSON以及id不同的行，然后ack
+//	nack-once: 第一个请求nack，之后ack
+//	poison: 回复poison
+//	exit-once: HELPER_MARKER不存在时创建它，然后不回复直接退出，之后ack
+//	hang: 不回复
+func helperProcess(mode string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 0; scanner.Scan(); n++ {
+		var req processRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid request: %s\n", err)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "received %d events of %s\n", len(req.Events), req.Rule)
+
+		resp := processResponse{ID: req.ID, Ack: true}
+		switch mode {
+		case "ack":
+			fmt.Println("not a json line")
+			fmt.Printf("{\"id\": %d, \"ack\": false}\n", req.ID+100)
+		case "nack-once":
+			if n == 0 {
+				resp = processResponse{ID: req.ID, Error: "busy"}
+			}
+		case "poison":
+			resp = processResponse{ID: req.ID, Error: "invalid row", Poison: true}
+		case "exit-once":
+			if f, err := os.OpenFile(os.Getenv("HELPER_MARKER"), os.O_CREATE|os.O_EXCL, 0o644); err == nil {
+				_ = f.Close()
+				os.Exit(1)
+			}
+		case "hang":
+			continue
+		}
+		buf, _ := json.Marshal(resp)
+		fmt.Println(string(buf))
+	}
+}
+
+func newTestProcess(t *testing.T, mode string) Sink {
+	consumer.GetTableFn = func(string) *consumer.Table { return nil }
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newProcessSink()
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{TaskOptions: settings.TaskOptions{ScriptDir: t.TempDir(), ShutdownGrace: time.Second}}, Logger: l},
+		Rule: &settings.RuleOptions{Schema: "test_db", Table: "users", Call: common.ProcessPrefix + os.Args[0], Options: map[string]any{
+			"env": map[string]string{
+				"GO_WANT_HELPER_PROCESS": "1",
+				"HELPER_MODE":            mode,
+				"HELPER_MARKER":          filepath.Join(t.TempDir(), "exited"),
+			},
+			"backoff":     "50ms",
+			"max_backoff": "50ms",
+		}},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// writeProcess 与Manager.Write相同，timeout大于0时限制执行时长
+func writeProcess(s Sink, timeout time.Duration, events []consumer.RowEvent) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return s.Write(ctx, events)
+}
+
+func TestProcessAck(t *testing.T) {
+	s := newTestProcess(t, "ack")
+	// 非JSON和id不同的行被忽略，同一个子进程处理之后的批次
+	for i := 0; i < 2; i++ {
+		if err := writeProcess(s, 0, testWebhookEvents(3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if failures := s.(*processSink).failures; failures != 0 {
+		t.Errorf("expected no failures, got %d", failures)
+	}
+}
+
+func TestProcessNack(t *testing.T) {
+	s := newTestProcess(t, "nack-once")
+	events := testWebhookEvents(2)
+
+	err := writeProcess(s, 0, events)
+	if err == nil || IsPoison(err) || !strings.Contains(err.Error(), "busy") {
+		t.Fatalf("expected a retryable nack, got %v", err)
+	}
+	// 子进程没有退出，重试时立即发送
+	if err = writeProcess(s, 0, events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessPoison(t *testing.T) {
+	s := newTestProcess(t, "poison")
+	events := testWebhookEvents(2)
+
+	err := writeProcess(s, 0, events)
+	if !IsPoison(err) || !strings.Contains(err.Error(), "invalid row") {
+		t.Fatalf("expected a poison error, got %v", err)
+	}
+	if poison := PoisonEvents(err, events); len(poison) != len(events) {
+		t.Errorf("expected the whole batch moved to dead letters, got %d events", len(poison))
+	}
+}
+
+func TestProcessExit(t *testing.T) {
+	s := newTestProcess(t, "exit-once")
+	events := testWebhookEvents(2)
+
+	if err := writeProcess(s, 0, events); err == nil || !strings.Contains(err.Error(), "exited before replying") {
+		t.Fatalf("expected the process exited, got %v", err)
+	}
+	// backoff之前不重启
+	if err := writeProcess(s, 0, events); err == nil || !strings.Contains(err.Error(), "will be restarted in") {
+		t.Fatalf("expected waiting for the backoff, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := writeProcess(s, 0, events); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessTimeout(t *testing.T) {
+	s := newTestProcess(t, "hang")
+	events := testWebhookEvents(2)
+	proc, err := s.(*processSink).running()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeProcess(s, 100*time.Millisecond, events)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the call abandoned, got %v", err)
+	}
+	// 迟到的回复无法与下一批区分，所以子进程被杀死
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the process killed")
+	}
+	if failures := s.(*processSink).failures; failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+}
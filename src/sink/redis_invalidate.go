@@ -0,0 +1,182 @@
+package sink
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"sync"
+	"time"
+)
+
+// redisInvalidateOptions redis_invalidate的options
+type redisInvalidateOptions struct {
+	// key的模板，比如 ["user:{id}", "user:email:{email}"]
+	Keys []string `yaml:"keys"`
+	// 大于0时，在延迟之后再删除一次（延迟双删）
+	Delay time.Duration `yaml:"delay"`
+	// 每次DEL的最大key数量
+	BatchSize int `yaml:"batch_size"`
+}
+
+func defaultRedisInvalidateOptions() redisInvalidateOptions {
+	return redisInvalidateOptions{
+		BatchSize: 500,
+	}
+}
+
+// redisInvalidate 行变化时删除对应的缓存key，旧行和新行生成的key都会被删除
+type redisInvalidate struct {
+	params  Params
+	options redisInvalidateOptions
+	keys    []*keyTemplate
+	client  redis.UniversalClient
+
+	// 尚未执行的第二次删除
+	pendingLock sync.Mutex
+	pending     map[*time.Timer][]string
+	// 正在执行的第二次删除，Close时等待
+	deleting sync.WaitGroup
+}
+
+func init() {
+	Register("redis_invalidate", func() Sink { return &redisInvalidate{} })
+}
+
+func (s *redisInvalidate) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultRedisInvalidateOptions()
+	s.pending = map[*time.Timer][]string{}
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	if len(s.options.Keys) <= 0 {
+		return errors.Errorf("[Sink]\"keys\" is required in rule \"%s\"", params.Rule.Key())
+	}
+	for _, raw := range s.options.Keys {
+		key, err := parseKeyTemplate(raw)
+		if err != nil {
+			return err
+		}
+		s.keys = append(s.keys, key)
+	}
+	if s.options.BatchSize <= 0 {
+		return errors.Errorf("[Sink]\"batch_size\" must be greater than 0 in rule \"%s\"", params.Rule.Key())
+	}
+
+	if params.Target == nil || params.Target.Redis == nil {
+		return errors.Errorf("[Sink]redis target is not configured for rule \"%s\"", params.Rule.Key())
+	}
+	s.client = params.Target.Redis.RedisClient
+	return nil
+}
+
+// Write 行中没有key模板的列时，重试也不会成功，跳过这些events，最后移入死信
+func (s *redisInvalidate) Write(ctx context.Context, events []consumer.RowEvent) error {
+	var poison poisonBatch
+	var keys []string
+	seen := map[string]struct{}{}
+	for _, event := range events {
+		eventKeys, err := s.eventKeys(event)
+		if err != nil {
+			poison.add(errors.WithMessagef(err, "[Sink]event %d", event.ID), event)
+			continue
+		}
+		for _, key := range eventKeys {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if err := s.delete(ctx, keys); err != nil {
+		return err
+	}
+
+	if s.options.Delay > 0 && len(keys) > 0 {
+		s.schedule(keys)
+	}
+	return poison.err()
+}
+
+// eventKeys 旧行和新行的所有key
+func (s *redisInvalidate) eventKeys(event consumer.RowEvent) ([]string, error) {
+	var keys []string
+	for _, row := range []map[string]any{event.OldRow, event.NewRow} {
+		if row == nil {
+			continue
+		}
+		for _, tpl := range s.keys {
+			key, err := tpl.Execute(row)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *redisInvalidate) delete(ctx context.Context, keys []string) error {
+	for start := 0; start < len(keys); start += s.options.BatchSize {
+		end := start + s.options.BatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := s.client.Del(ctx, keys[start:end]...).Err(); err != nil {
+			return errors.Wrapf(err, "[Sink]redis_invalidate of rule \"%s\" error", s.params.Rule.Key())
+		}
+	}
+	return nil
+}
+
+// schedule 延迟之后再删除一次，失败只记录日志，因为第一次删除已经成功
+func (s *redisInvalidate) schedule(keys []string) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.options.Delay, func() {
+		s.pendingLock.Lock()
+		_, ok := s.pending[timer]
+		delete(s.pending, timer)
+		if ok {
+			s.deleting.Add(1)
+		}
+		s.pendingLock.Unlock()
+
+		// 不在pending中时，已经由Close执行
+		if ok {
+			defer s.deleting.Done()
+			s.deleteLater(keys)
+		}
+	})
+	s.pending[timer] = keys
+}
+
+func (s *redisInvalidate) deleteLater(keys []string) {
+	if err := s.delete(context.Background(), keys); err != nil {
+		s.params.Logger.Error("[Sink]delayed delete error", zap.String("rule", s.params.Rule.Key()), zap.Int("keys", len(keys)), zap.Error(err))
+	}
+}
+
+// Close 立即执行所有尚未执行的第二次删除，并等待正在执行的删除结束
+func (s *redisInvalidate) Close() error {
+	s.pendingLock.Lock()
+	pending := s.pending
+	s.pending = map[*time.Timer][]string{}
+	s.pendingLock.Unlock()
+
+	var err error
+	for timer, keys := range pending {
+		// 已经触发、正在等待pendingLock的timer也不会再删除，所以不论Stop的结果都需要执行
+		timer.Stop()
+		err = multierr.Append(err, s.delete(context.Background(), keys))
+	}
+	s.deleting.Wait()
+	return err
+}
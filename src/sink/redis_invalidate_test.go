@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/dm.v1/src/target"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDeleter 只实现了Del，记录每次删除的keys
+type fakeDeleter struct {
+	redis.UniversalClient
+
+	lock    sync.Mutex
+	deletes [][]string
+}
+
+func (c *fakeDeleter) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deletes = append(c.deletes, keys)
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(int64(len(keys)))
+	return cmd
+}
+
+func (c *fakeDeleter) joined() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var deletes []string
+	for _, keys := range c.deletes {
+		deletes = append(deletes, strings.Join(keys, ","))
+	}
+	return deletes
+}
+
+func openTestInvalidate(t *testing.T, client redis.UniversalClient, options map[string]any) Sink {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &redisInvalidate{}
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l, Target: &target.Target{Redis: &cache.Redis{RedisClient: client}}},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "redis_invalidate", Options: options},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRedisInvalidate(t *testing.T) {
+	client := &fakeDeleter{}
+	s := openTestInvalidate(t, client, map[string]any{"keys": []string{"user:{id}", "user:email:{email}"}})
+
+	events := []consumer.RowEvent{
+		{ID: 1, Action: "update", Schema: "test_db", Table: "users", OldRow: map[string]any{"id": 1, "email": "a@x"}, NewRow: map[string]any{"id": 1, "email": "b@x"}},
+		// 行中没有email，重试也不会成功
+		{ID: 2, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 2}},
+		{ID: 3, Action: "delete", Schema: "test_db", Table: "users", OldRow: map[string]any{"id": 3, "email": "c@x"}},
+	}
+	err := s.Write(context.Background(), events)
+	if poison := PoisonEvents(err, events); len(poison) != 1 || poison[0].ID != 2 {
+		t.Fatalf("expected the event 2 moved to dead letters, got %v", err)
+	}
+	if deletes := client.joined(); len(deletes) != 1 || deletes[0] != "user:1,user:email:a@x,user:email:b@x,user:3,user:email:c@x" {
+		t.Errorf("unexpected deletes %v", deletes)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisInvalidateClose(t *testing.T) {
+	for _, delay := range []time.Duration{time.Hour, time.Millisecond} {
+		client := &fakeDeleter{}
+		s := openTestInvalidate(t, client, map[string]any{"keys": []string{"user:{id}"}, "delay": delay.String()})
+
+		events := []consumer.RowEvent{{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 1}}}
+		if err := s.Write(context.Background(), events); err != nil {
+			t.Fatal(err)
+		}
+		// 不论timer是否已经触发，Close返回时第二次删除都已经执行，并且只执行一次
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if deletes := client.joined(); len(deletes) != 2 || deletes[1] != "user:1" {
+			t.Errorf("expected deleted twice with delay %s, got %v", delay, deletes)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+const (
+	mirrorFormatJson   = "json"
+	mirrorFormatHash   = "hash"
+	mirrorFormatColumn = "column"
+
+	onDeleteDel    = "del"
+	onDeleteIgnore = "ignore"
+)
+
+// redisMirrorOptions redis_mirror的options
+type redisMirrorOptions struct {
+	// key的模板，比如 "user:{id}"
+	Key string `yaml:"key"`
+	// json: 整行的JSON；hash: 每一列为一个field；column: 只写入Column这一列的值
+	Format  string   `yaml:"format"`
+	Column  string   `yaml:"column"`
+	Columns []string `yaml:"columns"` // json/hash时只写入这些列，为空表示全部
+	// 0表示不过期
+	TTL time.Duration `yaml:"ttl"`
+	// del: 删除行时删除key；ignore: 保留key
+	OnDelete string `yaml:"on_delete"`
+	// 每个pipeline的最大命令数
+	BatchSize int `yaml:"batch_size"`
+}
+
+func defaultRedisMirrorOptions() redisMirrorOptions {
+	return redisMirrorOptions{
+		Format:    mirrorFormatJson,
+		OnDelete:  onDeleteDel,
+		BatchSize: 500,
+	}
+}
+
+// redisMirror 将行镜像到Redis：insert/update时写入key，delete时删除key
+type redisMirror struct {
+	params  Params
+	options redisMirrorOptions
+	key     *keyTemplate
+	client  redis.UniversalClient
+}
+
+func init() {
+	Register("redis_mirror", func() Sink { return &redisMirror{} })
+}
+
+func (s *redisMirror) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultRedisMirrorOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	} else if err = rejectFormat(params, "format_options"); err != nil {
+		return err
+	}
+
+	var err error
+	if s.key, err = parseKeyTemplate(s.options.Key); err != nil {
+		return err
+	}
+
+	switch s.options.Format {
+	case mirrorFormatJson, mirrorFormatHash:
+	case mirrorFormatColumn:
+		if s.options.Column == "" {
+			return errors.Errorf("[Sink]\"column\" is required when format is \"column\" in rule \"%s\"", params.Rule.Key())
+		}
+	default:
+		if slices.Contains(format.Names(), s.options.Format) {
+			return errors.Errorf("[Sink]format \"%s\" is an event format, redis_mirror writes the rows and only supports json, hash or column in rule \"%s\"", s.options.Format, params.Rule.Key())
+		}
+		return errors.Errorf("[Sink]unsupported format \"%s\" in rule \"%s\"", s.options.Format, params.Rule.Key())
+	}
+
+	switch s.options.OnDelete {
+	case onDeleteDel, onDeleteIgnore:
+	default:
+		return errors.Errorf("[Sink]unsupported on_delete \"%s\" in rule \"%s\"", s.options.OnDelete, params.Rule.Key())
+	}
+	if s.options.BatchSize <= 0 {
+		return errors.Errorf("[Sink]\"batch_size\" must be greater than 0 in rule \"%s\"", params.Rule.Key())
+	}
+
+	if params.Target == nil || params.Target.Redis == nil {
+		return errors.Errorf("[Sink]redis target is not configured for rule \"%s\"", params.Rule.Key())
+	}
+	s.client = params.Target.Redis.RedisClient
+	return nil
+}
+
+// Write 所有命令都是幂等的，失败重试时整批重新执行；
+// 无法生成命令的events（比如行中没有key模板的列）重试也不会成功，跳过它们，最后移入死信
+func (s *redisMirror) Write(ctx context.Context, events []consumer.RowEvent) error {
+	var poison poisonBatch
+	pipe := s.client.Pipeline()
+	for _, event := range events {
+		if err := s.apply(ctx, pipe, event); err != nil {
+			poison.add(errors.WithMessagef(err, "[Sink]event %d", event.ID), event)
+			continue
+		}
+
+		if pipe.Len() >= s.options.BatchSize {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return errors.Wrapf(err, "[Sink]redis_mirror of rule \"%s\" error", s.params.Rule.Key())
+			}
+		}
+	}
+
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return errors.Wrapf(err, "[Sink]redis_mirror of rule \"%s\" error", s.params.Rule.Key())
+		}
+	}
+	return poison.err()
+}
+
+// apply 返回错误时没有向pipe中添加命令
+func (s *redisMirror) apply(ctx context.Context, pipe redis.Pipeliner, event consumer.RowEvent) error {
+	switch event.Action {
+	case "delete":
+		if s.options.OnDelete == onDeleteIgnore {
+			return nil
+		}
+		key, err := s.key.Execute(event.OldRow)
+		if err != nil {
+			return err
+		}
+		pipe.Del(ctx, key)
+		return nil
+	case "update":
+		key, err := s.key.Execute(event.NewRow)
+		if err != nil {
+			return err
+		}
+		if err = s.set(ctx, pipe, key, event.NewRow); err != nil {
+			return err
+		}
+		// 修改了key中的列，需要删除旧的key
+		if oldKey, err := s.key.Execute(event.OldRow); err == nil && oldKey != key {
+			pipe.Del(ctx, oldKey)
+		}
+		return nil
+	case "insert":
+		key, err := s.key.Execute(event.NewRow)
+		if err != nil {
+			return err
+		}
+		return s.set(ctx, pipe, key, event.NewRow)
+	}
+
+	s.params.Logger.Warn("[Sink]unsupported action", zap.String("rule", s.params.Rule.Key()), zap.String("action", event.Action))
+	return nil
+}
+
+func (s *redisMirror) set(ctx context.Context, pipe redis.Pipeliner, key string, row map[string]any) error {
+	switch s.options.Format {
+	case mirrorFormatHash:
+		var values []any
+		for column, val := range selectColumns(row, s.options.Columns) {
+			values = append(values, column, formatValue(val))
+		}
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, values...)
+		}
+		if s.options.TTL > 0 {
+			pipe.Expire(ctx, key, s.options.TTL)
+		}
+	case mirrorFormatColumn:
+		pipe.Set(ctx, key, formatValue(row[s.options.Column]), s.options.TTL)
+	default:
+		buf, err := text_utils.JsonMarshalToBytes(selectColumns(row, s.options.Columns))
+		if err != nil {
+			return errors.Wrapf(err, "[Sink]encode row of key \"%s\" error", key)
+		}
+		pipe.Set(ctx, key, buf, s.options.TTL)
+	}
+	return nil
+}
+
+func (s *redisMirror) Close() error {
+	return nil
+}
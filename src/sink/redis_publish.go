@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+)
+
+const (
+	publishModeStream = "stream"
+	publishModePubSub = "pubsub"
+)
+
+// RedisPublisher redis_publish需要的Redis命令，redis.UniversalClient实现了该接口，测试时可以替换为进程内的实现
+type RedisPublisher interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	Publish(ctx context.Context, channel string, message any) *redis.IntCmd
+}
+
+// redisPublishOptions redis_publish的options
+type redisPublishOptions struct {
+	// stream: XADD到Stream；pubsub: PUBLISH到频道
+	Mode string `yaml:"mode"`
+	// Stream或者频道名称的模板，可以使用 {schema} {table} {action}
+	Name string `yaml:"name"`
+	// Stream中存放消息的字段名
+	Field string `yaml:"field"`
+	// Stream的MAXLEN，0表示不限
+	MaxLen int64 `yaml:"max_len"`
+	// MAXLEN是否使用"~"近似裁剪
+	Approx bool `yaml:"approx"`
+
+	serializerOptions `yaml:",inline"`
+}
+
+func defaultRedisPublishOptions() redisPublishOptions {
+	return redisPublishOptions{
+		Mode:   publishModeStream,
+		Name:   "dm:{schema}.{table}",
+		Field:  "event",
+		Approx: true,
+
+		serializerOptions: defaultSerializerOptions(),
+	}
+}
+
+// redisPublish 将每一个RowEvent按format序列化，发布到Redis Stream或者Pub/Sub频道
+type redisPublish struct {
+	params     Params
+	options    redisPublishOptions
+	name       *keyTemplate
+	serializer format.Serializer
+	client     RedisPublisher
+}
+
+func init() {
+	Register("redis_publish", func() Sink { return &redisPublish{} })
+}
+
+// NewRedisPublish 使用指定的client代替target中的Redis，用于测试或者嵌入
+func NewRedisPublish(client RedisPublisher) Sink {
+	return &redisPublish{client: client}
+}
+
+func (s *redisPublish) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultRedisPublishOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	switch s.options.Mode {
+	case publishModeStream, publishModePubSub:
+	default:
+		return errors.Errorf("[Sink]unsupported mode \"%s\" in rule \"%s\"", s.options.Mode, params.Rule.Key())
+	}
+
+	var err error
+	if s.name, err = parseKeyTemplate(s.options.Name); err != nil {
+		return err
+	}
+	for _, column := range s.name.Columns() {
+		switch column {
+		case "schema", "table", "action":
+		default:
+			return errors.Errorf("[Sink]only {schema} {table} {action} can be used in \"name\" of rule \"%s\"", params.Rule.Key())
+		}
+	}
+
+	if s.serializer, err = newSerializer(params, s.options.Format, s.options.FormatOptions); err != nil {
+		return err
+	}
+
+	if s.client == nil {
+		if params.Target == nil || params.Target.Redis == nil {
+			return errors.Errorf("[Sink]redis target is not configured for rule \"%s\"", params.Rule.Key())
+		}
+		s.client = params.Target.Redis.RedisClient
+	}
+	return nil
+}
+
+// Write 按顺序逐条发布，失败时整批重试，所以下游需要按id去重；不兼容schema_registry的events跳过，最后移入死信
+func (s *redisPublish) Write(ctx context.Context, events []consumer.RowEvent) error {
+	var poison poisonBatch
+	for _, event := range events {
+		name, err := s.name.Execute(map[string]any{"schema": event.Schema, "table": event.Table, "action": event.Action})
+		if err != nil {
+			return err
+		}
+		buf, err := marshalEvent(ctx, s.serializer, event)
+		if registry.IsIncompatible(err) {
+			poison.add(err, event)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if s.options.Mode == publishModePubSub {
+			err = s.client.Publish(ctx, name, buf).Err()
+		} else {
+			err = s.client.XAdd(ctx, &redis.XAddArgs{
+				Stream: name,
+				MaxLen: s.options.MaxLen,
+				Approx: s.options.Approx && s.options.MaxLen > 0,
+				Values: []any{s.options.Field, buf},
+			}).Err()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "[Sink]redis_publish \"%s\" of rule \"%s\" error", name, s.params.Rule.Key())
+		}
+	}
+	return poison.err()
+}
+
+func (s *redisPublish) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"strings"
+	"testing"
+)
+
+// fakePublisher 记录所有的命令，err不为nil时每个命令都返回err
+type fakePublisher struct {
+	xadds     []*redis.XAddArgs
+	publishes map[string][]any
+	err       error
+}
+
+func (p *fakePublisher) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx)
+	if p.err != nil {
+		cmd.SetErr(p.err)
+		return cmd
+	}
+	p.xadds = append(p.xadds, a)
+	cmd.SetVal("1-0")
+	return cmd
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, channel string, message any) *redis.IntCmd {
+	cmd := redis.NewIntCmd(ctx)
+	if p.err != nil {
+		cmd.SetErr(p.err)
+		return cmd
+	}
+	if p.publishes == nil {
+		p.publishes = map[string][]any{}
+	}
+	p.publishes[channel] = append(p.publishes[channel], message)
+	cmd.SetVal(1)
+	return cmd
+}
+
+func openTestPublish(t *testing.T, client RedisPublisher, options map[string]any) Sink {
+	s := NewRedisPublish(client)
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "redis_publish", Options: options},
+	}
+	if err := s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testPublishEvents() []consumer.RowEvent {
+	return []consumer.RowEvent{
+		{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": 1, "name": "a"}},
+		{ID: 2, Action: "delete", Schema: "test_db", Table: "orders", OldRow: map[string]any{"id": 2}},
+	}
+}
+
+func TestRedisPublishStream(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		options map[string]any
+		maxLen  int64
+		approx  bool
+	}{
+		{"unlimited", map[string]any{}, 0, false},
+		{"approx", map[string]any{"max_len": 1000}, 1000, true},
+		{"exact", map[string]any{"max_len": 10, "approx": false}, 10, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client := &fakePublisher{}
+			s := openTestPublish(t, client, c.options)
+			if err := s.Write(context.Background(), testPublishEvents()); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(client.xadds) != 2 {
+				t.Fatalf("expected 2 XADD, got %d", len(client.xadds))
+			}
+			for i, stream := range []string{"dm:test_db.users", "dm:test_db.orders"} {
+				args := client.xadds[i]
+				if args.Stream != stream {
+					t.Errorf("expected stream \"%s\", got \"%s\"", stream, args.Stream)
+				}
+				if args.MaxLen != c.maxLen || args.Approx != c.approx {
+					t.Errorf("expected MAXLEN %d approx=%v, got %d approx=%v", c.maxLen, c.approx, args.MaxLen, args.Approx)
+				}
+				values, ok := args.Values.([]any)
+				if !ok || len(values) != 2 || values[0] != "event" {
+					t.Fatalf("unexpected values %v", args.Values)
+				}
+				var message map[string]any
+				if err := json.Unmarshal(values[1].([]byte), &message); err != nil {
+					t.Fatal(err)
+				}
+				if message["table"] != strings.TrimPrefix(stream, "dm:test_db.") {
+					t.Errorf("unexpected message %v in \"%s\"", message, stream)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisPublishPubSub(t *testing.T) {
+	client := &fakePublisher{}
+	s := openTestPublish(t, client, map[string]any{"mode": "pubsub", "name": "{schema}:{table}:{action}"})
+	if err := s.Write(context.Background(), testPublishEvents()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.xadds) != 0 {
+		t.Errorf("unexpected XADD %v", client.xadds)
+	}
+	for _, channel := range []string{"test_db:users:insert", "test_db:orders:delete"} {
+		if len(client.publishes[channel]) != 1 {
+			t.Errorf("expected 1 message in \"%s\", got %v", channel, client.publishes)
+		}
+	}
+}
+
+func TestRedisPublishOpenError(t *testing.T) {
+	for _, options := range []map[string]any{
+		{"mode": "list"},
+		{"name": "dm:{id}"},
+	} {
+		s := NewRedisPublish(&fakePublisher{})
+		params := Params{
+			Components: &component.Components{Settings: &settings.Settings{}},
+			Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "redis_publish", Options: options},
+		}
+		if err := s.Open(context.Background(), params); err == nil {
+			t.Errorf("expected an error of options %v", options)
+		}
+	}
+}
+
+func TestRedisPublishWriteError(t *testing.T) {
+	client := &fakePublisher{err: errors.New("READONLY You can't write against a read only replica.")}
+	s := openTestPublish(t, client, map[string]any{})
+
+	err := s.Write(context.Background(), testPublishEvents())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "dm:test_db.users") || !strings.Contains(err.Error(), "READONLY") {
+		t.Errorf("unexpected error: %s", err)
+	}
+	// 整批重试，不是死信
+	if IsPoison(err) {
+		t.Errorf("redis error should be retried: %s", err)
+	}
+}
@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"time"
+)
+
+// serializerOptions 输出事件的sink共用的options
+type serializerOptions struct {
+	// json（format.EventMessage）、debezium、canal-json、maxwell、avro、protobuf等，参见 format.Register
+	Format        string         `yaml:"format"`
+	FormatOptions format.Options `yaml:"format_options"`
+}
+
+func defaultSerializerOptions() serializerOptions {
+	return serializerOptions{
+		Format:        "json",
+		FormatOptions: format.DefaultOptions(),
+	}
+}
+
+// newSerializer TIMESTAMP使用MySQL的时区
+func newSerializer(params Params, name string, options format.Options) (format.Serializer, error) {
+	if location, err := time.LoadLocation(params.Settings.MySqlOptions.TimeZone); err == nil {
+		options.Location = location
+	}
+	options.Registry = params.Registry
+	serializer, err := format.New(name, options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "[Sink]invalid format of rule \"%s\"", params.Rule.Key())
+	}
+	return serializer, nil
+}
+
+// rejectFormat 镜像类的sink写入的是行的最新值而不是事件，不能使用事件的格式（format.Register），所以明确拒绝这些options
+func rejectFormat(params Params, keys ...string) error {
+	for _, key := range keys {
+		if _, ok := params.Rule.Options[key]; ok {
+			return errors.Errorf("[Sink]\"%s\" is not supported by sink \"%s\" of rule \"%s\", it writes the rows instead of the events", key, params.Rule.Sink, params.Rule.Key())
+		}
+	}
+	return nil
+}
+
+// marshalEvent 使用ctx中的binlog位置序列化event
+//
+//	表结构与schema_registry中上一个版本不兼容（registry.IsIncompatible）时，表结构再次修改之前重试也不会成功，
+//	调用方需要跳过这个event，写入批次中的其它events，最后只将这些events移入死信
+func marshalEvent(ctx context.Context, serializer format.Serializer, event consumer.RowEvent) ([]byte, error) {
+	meta, _ := EventMetaFrom(ctx, event.ID)
+	buf, err := serializer.Marshal(event, meta)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "[Sink]encode event %d error", event.ID)
+	}
+	return buf, nil
+}
@@ -0,0 +1,94 @@
+package sink
+
+import (
+	"context"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"strings"
+	"testing"
+)
+
+func TestMirrorOpenError(t *testing.T) {
+	for _, c := range []struct {
+		sink    Sink
+		options map[string]any
+		message string
+	}{
+		{&redisMirror{}, map[string]any{"key": "user:{id}", "format": "canal-json"}, "is an event format"},
+		{&redisMirror{}, map[string]any{"key": "user:{id}", "format_options": map[string]any{"schema": true}}, "\"format_options\" is not supported"},
+		{&etcdMirror{}, map[string]any{"key": "/users/{id}", "format": "json"}, "\"format\" is not supported"},
+		{&redisMirror{}, map[string]any{"key": "user:{id}", "batch_size": 0}, "\"batch_size\" must be greater than 0"},
+		{&etcdMirror{}, map[string]any{"key": "/users/{id}", "max_txn_ops": -1}, "\"max_txn_ops\" must not be negative"},
+	} {
+		params := Params{
+			Components: &component.Components{Settings: &settings.Settings{}},
+			Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "mirror", Options: c.options},
+		}
+		// 在检查target之前返回
+		if err := c.sink.Open(context.Background(), params); err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("expected an error of \"%s\" for options %v, got %v", c.message, c.options, err)
+		}
+	}
+}
+
+func TestMarshalEventIncompatible(t *testing.T) {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := registry.NewRegistry(settings.SchemaRegistryOptions{Enabled: true, Dir: t.TempDir(), Compatibility: registry.CompatibilityBackward}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakePublisher{}
+	s := NewRedisPublish(client)
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l, Registry: r},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: ".*", Sink: "redis_publish", Options: map[string]any{"format": "avro"}},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := map[string]*consumer.Table{}
+	setTable := func(name string, rawType string, typ int) {
+		tables["test_db."+name] = &consumer.Table{Schema: "test_db", Name: name, Columns: []consumer.TableColumn{{Name: "id", Type: typ, RawType: rawType}}}
+	}
+	consumer.GetTableFn = func(alias string) *consumer.Table { return tables[alias] }
+	event := func(id uint64, table string) consumer.RowEvent {
+		return consumer.RowEvent{ID: id, Action: "insert", Schema: "test_db", Table: table, Alias: "test_db." + table, NewRow: map[string]any{"id": 1}}
+	}
+	setTable("users", "int(11)", consumer.TYPE_NUMBER)
+	setTable("orders", "int(11)", consumer.TYPE_NUMBER)
+	if err = s.Write(context.Background(), []consumer.RowEvent{event(1, "users"), event(2, "orders")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 表结构不再变化之前每次都会失败，所以只有这些events移入死信，其它events继续写入
+	setTable("users", "varchar(20)", consumer.TYPE_STRING)
+	batch := []consumer.RowEvent{event(3, "users"), event(4, "orders"), event(5, "users"), event(6, "orders")}
+	err = s.Write(context.Background(), batch)
+	if !IsPoison(err) || !registry.IsIncompatible(err) {
+		t.Fatalf("expected a poison error of the incompatible schema, got %v", err)
+	}
+	var ids []uint64
+	for _, e := range PoisonEvents(err, batch) {
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 2 || ids[0] != 3 || ids[1] != 5 {
+		t.Errorf("expected the events 3 and 5 moved to dead letters, got %v", ids)
+	}
+	if len(client.xadds) != 4 {
+		t.Errorf("expected 4 events published, got %d", len(client.xadds))
+	}
+
+	// 其它错误整批重试
+	consumer.GetTableFn = func(string) *consumer.Table { return nil }
+	if err = s.Write(context.Background(), batch); err == nil || IsPoison(err) {
+		t.Errorf("expected a retryable error, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"sync"
+)
+
+// Sink 消费events的目标，每一个rule拥有一个独立的实例
+//
+//	同一个实例的Write不会被并发调用；Write返回错误时，这批events会在下次触发时重试
+type Sink interface {
+	// Open 在第一次Write之前调用
+	Open(ctx context.Context, params Params) error
+	// Write 写入一批属于同一个rule的events，需要遵守ctx的超时
+	Write(ctx context.Context, events []consumer.RowEvent) error
+	// Close 在rule被删除、修改或者进程退出时调用
+	Close() error
+}
+
+// Reconciler Sink的可选接口，用于全量快照（mysqldump）之后的对账
+type Reconciler interface {
+	// BeginSnapshot 快照开始，之后写入的行都属于快照
+	BeginSnapshot()
+	// Reconcile 快照的events都已写入，删除目标中快照里不存在的行
+	Reconcile(ctx context.Context) error
+}
+
+// Params 打开Sink时的参数
+type Params struct {
+	*component.Components
+
+	Rule *settings.RuleOptions
+}
+
+// DecodeOptions 将rule的options解析到v中，v需要定义yaml的tag
+func (p Params) DecodeOptions(v any) error {
+	buf, err := yaml.Marshal(p.Rule.Options)
+	if err != nil {
+		return errors.Wrapf(err, "[Sink]encode options of rule \"%s\" error", p.Rule.Key())
+	}
+	if err = yaml.Unmarshal(buf, v); err != nil {
+		return errors.Wrapf(err, "[Sink]decode options of rule \"%s\" error", p.Rule.Key())
+	}
+	return nil
+}
+
+// Factory 创建一个未打开的Sink
+type Factory func() Sink
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]Factory{}
+)
+
+// Register 注册一个Sink，rule中使用 "sink: name" 选择，重复注册会覆盖之前的
+//
+//	需要在程序启动之前调用，比如在init中
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+// New 通过名字创建Sink
+func New(name string) (Sink, error) {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	factory, ok := factories[name]
+	if !ok {
+		return nil, errors.Errorf("[Sink]sink \"%s\" is not registered", name)
+	}
+	return factory(), nil
+}
+
+// Names 所有已注册的Sink
+func Names() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type eventMetasKey struct{}
+
+// WithEventMetas 将events的binlog位置和提交时间附加到ctx中，key为event的ID
+func WithEventMetas(ctx context.Context, metas map[uint64]common.EventMeta) context.Context {
+	return context.WithValue(ctx, eventMetasKey{}, metas)
+}
+
+// EventMetaFrom 读取Write的ctx中某个event的binlog位置和提交时间，回放或者mysqldump的行没有
+func EventMetaFrom(ctx context.Context, id uint64) (common.EventMeta, bool) {
+	metas, _ := ctx.Value(eventMetasKey{}).(map[uint64]common.EventMeta)
+	meta, ok := metas[id]
+	return meta, ok
+}
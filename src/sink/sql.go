@@ -0,0 +1,402 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sqlDialectMySql  = "mysql"
+	sqlDialectSqlite = "sqlite"
+)
+
+// sqlOptions sql的options
+type sqlOptions struct {
+	// database/sql的驱动名，mysql已内置；sqlite、sqlite3需要在程序中导入对应的驱动
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn"`
+	// 目标表的模板，可以使用 {schema} {table}
+	Table string `yaml:"table"`
+	// 列的重命名：源列名 -> 目标列名
+	Columns map[string]string `yaml:"columns"`
+	// 不为空时代替源表的PKColumns，需要使用源列名
+	PrimaryKeys []string `yaml:"primary_keys"`
+	// 连续的insert合并为一个多行的INSERT，每个语句的最大行数
+	BatchSize    int `yaml:"batch_size"`
+	MaxOpenConns int `yaml:"max_open_conns"`
+}
+
+func defaultSqlOptions() sqlOptions {
+	return sqlOptions{
+		Driver:       "mysql",
+		Table:        "{table}",
+		BatchSize:    100,
+		MaxOpenConns: 4,
+	}
+}
+
+// sqlSink 将events复制到另一个数据库：insert为upsert，update按旧的主键UPDATE，delete按主键DELETE
+//
+//	每次Write在一个事务中执行，失败时回滚，所以整批重试是幂等的
+type sqlSink struct {
+	params  Params
+	options sqlOptions
+	table   *keyTemplate
+	dialect string
+	db      *sql.DB
+	// 通过NewSQL传入的db不在Close时关闭
+	ownDB bool
+}
+
+// sqlUpsert 等待合并的多行upsert
+type sqlUpsert struct {
+	table   string
+	columns []string
+	pks     []string
+	rows    [][]any
+}
+
+func init() {
+	Register("sql", func() Sink { return &sqlSink{ownDB: true} })
+}
+
+// NewSQL 使用已打开的db代替options中的driver、dsn，dialect为mysql或者sqlite，用于测试或者嵌入
+func NewSQL(db *sql.DB, dialect string) Sink {
+	return &sqlSink{db: db, dialect: dialect}
+}
+
+func (s *sqlSink) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultSqlOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	var err error
+	if s.table, err = parseKeyTemplate(s.options.Table); err != nil {
+		return err
+	}
+	for _, column := range s.table.Columns() {
+		if column != "schema" && column != "table" {
+			return errors.Errorf("[Sink]only {schema} {table} can be used in \"table\" of rule \"%s\"", params.Rule.Key())
+		}
+	}
+	if s.options.BatchSize <= 0 {
+		s.options.BatchSize = 1
+	}
+
+	if s.db != nil {
+		return s.checkDialect()
+	}
+
+	s.dialect = sqlDialectMySql
+	if strings.HasPrefix(s.options.Driver, "sqlite") {
+		s.dialect = sqlDialectSqlite
+	}
+	if s.options.DSN == "" {
+		return errors.Errorf("[Sink]\"dsn\" is required in rule \"%s\"", params.Rule.Key())
+	}
+	if s.db, err = sql.Open(s.options.Driver, s.options.DSN); err != nil {
+		return errors.Wrapf(err, "[Sink]open \"%s\" of rule \"%s\" error", s.options.Driver, params.Rule.Key())
+	}
+	s.db.SetMaxOpenConns(s.options.MaxOpenConns)
+	if err = s.db.PingContext(ctx); err != nil {
+		_ = s.db.Close()
+		return errors.Wrapf(err, "[Sink]connect \"%s\" of rule \"%s\" error", s.options.Driver, params.Rule.Key())
+	}
+	return nil
+}
+
+func (s *sqlSink) checkDialect() error {
+	switch s.dialect {
+	case sqlDialectMySql, sqlDialectSqlite:
+		return nil
+	}
+	return errors.Errorf("[Sink]unsupported sql dialect \"%s\"", s.dialect)
+}
+
+func (s *sqlSink) Write(ctx context.Context, events []consumer.RowEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "[Sink]begin transaction of rule \"%s\" error", s.params.Rule.Key())
+	}
+
+	if err = s.apply(ctx, tx, events); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrapf(err, "[Sink]commit transaction of rule \"%s\" error", s.params.Rule.Key())
+	}
+	return nil
+}
+
+func (s *sqlSink) apply(ctx context.Context, tx *sql.Tx, events []consumer.RowEvent) error {
+	var pending *sqlUpsert
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		err := s.upsert(ctx, tx, pending)
+		pending = nil
+		return err
+	}
+
+	for i := range events {
+		event := &events[i]
+		table, err := s.table.Execute(map[string]any{"schema": event.Schema, "table": event.Table})
+		if err != nil {
+			return err
+		}
+		pks, err := s.primaryKeys(event)
+		if err != nil {
+			return err
+		}
+
+		switch event.Action {
+		case "insert":
+			columns, values := s.columnsAndValues(event.NewRow)
+			if pending != nil && (pending.table != table || !slices.Equal(pending.columns, columns) || len(pending.rows) >= s.options.BatchSize) {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+			if pending == nil {
+				pending = &sqlUpsert{table: table, columns: columns, pks: s.renameAll(pks)}
+			}
+			pending.rows = append(pending.rows, values)
+			continue
+		}
+
+		// update和delete需要按顺序执行
+		if err = flush(); err != nil {
+			return err
+		}
+		switch event.Action {
+		case "update":
+			err = s.update(ctx, tx, table, pks, event)
+		case "delete":
+			err = s.delete(ctx, tx, table, pks, event.OldRow)
+		default:
+			s.params.Logger.Warn("[Sink]unsupported action", zap.String("rule", s.params.Rule.Key()), zap.String("action", event.Action))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return flush()
+}
+
+// primaryKeys 源表的主键列名，没有主键的表无法复制，重试也不会成功
+func (s *sqlSink) primaryKeys(event *consumer.RowEvent) ([]string, error) {
+	if len(s.options.PrimaryKeys) > 0 {
+		return s.options.PrimaryKeys, nil
+	}
+
+	table := event.GetTable()
+	if table == nil {
+		return nil, errors.Errorf("[Sink]table structure of \"%s.%s\" not found", event.Schema, event.Table)
+	}
+	var pks []string
+	for _, i := range table.PKColumns {
+		pks = append(pks, table.Columns[i].Name)
+	}
+	if len(pks) <= 0 {
+		return nil, NewPoisonError(errors.Errorf("[Sink]table \"%s.%s\" has no primary key, set \"primary_keys\" in rule \"%s\"", event.Schema, event.Table, s.params.Rule.Key()))
+	}
+	return pks, nil
+}
+
+// columnsAndValues 按源列名排序后的目标列名和值
+func (s *sqlSink) columnsAndValues(row map[string]any) ([]string, []any) {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]any, 0, len(names))
+	for _, name := range names {
+		values = append(values, s.value(row[name]))
+	}
+	return s.renameAll(names), values
+}
+
+func (s *sqlSink) rename(column string) string {
+	if renamed, ok := s.options.Columns[column]; ok {
+		return renamed
+	}
+	return column
+}
+
+func (s *sqlSink) renameAll(columns []string) []string {
+	renamed := make([]string, 0, len(columns))
+	for _, column := range columns {
+		renamed = append(renamed, s.rename(column))
+	}
+	return renamed
+}
+
+func (s *sqlSink) upsert(ctx context.Context, tx *sql.Tx, upsert *sqlUpsert) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(s.quote(upsert.table))
+	sb.WriteString(" (")
+	for i, column := range upsert.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(s.quote(column))
+	}
+	sb.WriteString(") VALUES ")
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(upsert.columns)), ", ") + ")"
+	var args []any
+	for i, row := range upsert.rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(placeholders)
+		args = append(args, row...)
+	}
+
+	var sets []string
+	for _, column := range upsert.columns {
+		if s.dialect == sqlDialectSqlite {
+			sets = append(sets, s.quote(column)+" = excluded."+s.quote(column))
+		} else {
+			sets = append(sets, s.quote(column)+" = VALUES("+s.quote(column)+")")
+		}
+	}
+	if s.dialect == sqlDialectSqlite {
+		var pks []string
+		for _, pk := range upsert.pks {
+			pks = append(pks, s.quote(pk))
+		}
+		sb.WriteString(" ON CONFLICT (" + strings.Join(pks, ", ") + ") DO UPDATE SET ")
+	} else {
+		sb.WriteString(" ON DUPLICATE KEY UPDATE ")
+	}
+	sb.WriteString(strings.Join(sets, ", "))
+
+	if _, err := tx.ExecContext(ctx, sb.String(), args...); err != nil {
+		return errors.Wrapf(err, "[Sink]upsert %d rows into \"%s\" error", len(upsert.rows), upsert.table)
+	}
+	return nil
+}
+
+// update 按旧的主键更新，目标中不存在这一行时改为upsert
+func (s *sqlSink) update(ctx context.Context, tx *sql.Tx, table string, pks []string, event *consumer.RowEvent) error {
+	columns, values := s.columnsAndValues(event.NewRow)
+	var sets []string
+	for _, column := range columns {
+		sets = append(sets, s.quote(column)+" = ?")
+	}
+	where, whereArgs, err := s.where(pks, event.OldRow)
+	if err != nil {
+		return err
+	}
+	// 修改了主键时，源表中不会有新主键的行，目标中存在则是整批重试时写入的，需要先删除
+	if _, newArgs, err := s.where(pks, event.NewRow); err != nil {
+		return err
+	} else if !reflect.DeepEqual(whereArgs, newArgs) {
+		if err = s.delete(ctx, tx, table, pks, event.NewRow); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE "+s.quote(table)+" SET "+strings.Join(sets, ", ")+" WHERE "+where, append(values, whereArgs...)...)
+	if err != nil {
+		return errors.Wrapf(err, "[Sink]update \"%s\" error", table)
+	}
+	// MySQL中值没有变化时也返回0，此时upsert同样没有副作用
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	return s.upsert(ctx, tx, &sqlUpsert{table: table, columns: columns, pks: s.renameAll(pks), rows: [][]any{values}})
+}
+
+func (s *sqlSink) delete(ctx context.Context, tx *sql.Tx, table string, pks []string, row map[string]any) error {
+	where, args, err := s.where(pks, row)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM "+s.quote(table)+" WHERE "+where, args...); err != nil {
+		return errors.Wrapf(err, "[Sink]delete from \"%s\" error", table)
+	}
+	return nil
+}
+
+func (s *sqlSink) where(pks []string, row map[string]any) (string, []any, error) {
+	var conditions []string
+	var args []any
+	for _, pk := range pks {
+		val, ok := row[pk]
+		if !ok {
+			return "", nil, errors.Errorf("[Sink]primary key \"%s\" not exists in the row", pk)
+		}
+		conditions = append(conditions, s.quote(s.rename(pk))+" = ?")
+		args = append(args, s.value(val))
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// quote 标识符的引用，"db.table" 会被分别引用
+func (s *sqlSink) quote(name string) string {
+	q := core.If(s.dialect == sqlDialectSqlite, `"`, "`")
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = q + strings.ReplaceAll(part, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+func (s *sqlSink) Close() error {
+	if s.ownDB && s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// value database/sql不支持的类型（比如JSON列解析出的map、slice）转为字符串，
+// 大于MaxInt64的BIGINT UNSIGNED只有MySQL的驱动支持，其它驱动也转为字符串
+func (s *sqlSink) value(val any) any {
+	switch v := val.(type) {
+	case uint:
+		if s.dialect != sqlDialectMySql && uint64(v) > math.MaxInt64 {
+			return strconv.FormatUint(uint64(v), 10)
+		}
+	case uint64:
+		if s.dialect != sqlDialectMySql && v > math.MaxInt64 {
+			return strconv.FormatUint(v, 10)
+		}
+	}
+	return sqlValue(val)
+}
+
+// sqlValue database/sql不支持的类型（比如JSON列解析出的map、slice）转为字符串
+func sqlValue(val any) any {
+	switch v := val.(type) {
+	case nil, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		return v
+	case map[string]any, []any:
+		return formatValue(v)
+	}
+	if driver.IsValue(val) {
+		return val
+	}
+	return formatValue(val)
+}
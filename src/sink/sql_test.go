@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// newTestSQL 内存中的SQLite，目标表为 users(id, name, big)
+func newTestSQL(t *testing.T, options map[string]any) (Sink, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个连接都是独立的内存数据库
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err = db.Exec(`CREATE TABLE "users" ("id" INTEGER PRIMARY KEY, "name" TEXT, "big" TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options == nil {
+		options = map[string]any{}
+	}
+	options["primary_keys"] = []string{"id"}
+
+	s := NewSQL(db, sqlDialectSqlite)
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "sql", Options: options},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	return s, db
+}
+
+// queryUsers id -> name
+func queryUsers(t *testing.T, db *sql.DB) map[int64]string {
+	rows, err := db.Query(`SELECT "id", "name" FROM "users"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	users := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		users[id] = name
+	}
+	return users
+}
+
+func userRow(id int64, name string) map[string]any {
+	return map[string]any{"id": id, "name": name}
+}
+
+func TestSQLWrite(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		events   []consumer.RowEvent
+		expected map[int64]string
+	}{
+		{
+			name: "insert and upsert",
+			events: []consumer.RowEvent{
+				{ID: 1, Action: "insert", NewRow: userRow(1, "a")},
+				{ID: 2, Action: "insert", NewRow: userRow(2, "b")},
+				{ID: 3, Action: "insert", NewRow: userRow(1, "c")}, // 重复的主键
+			},
+			expected: map[int64]string{1: "c", 2: "b"},
+		},
+		{
+			name: "update missing row",
+			events: []consumer.RowEvent{
+				{ID: 1, Action: "update", OldRow: userRow(1, "a"), NewRow: userRow(1, "b")},
+			},
+			expected: map[int64]string{1: "b"},
+		},
+		{
+			name: "delete",
+			events: []consumer.RowEvent{
+				{ID: 1, Action: "insert", NewRow: userRow(1, "a")},
+				{ID: 2, Action: "insert", NewRow: userRow(2, "b")},
+				{ID: 3, Action: "delete", OldRow: userRow(1, "a")},
+			},
+			expected: map[int64]string{2: "b"},
+		},
+		{
+			name: "primary key changed",
+			events: []consumer.RowEvent{
+				{ID: 1, Action: "insert", NewRow: userRow(1, "a")},
+				{ID: 2, Action: "update", OldRow: userRow(1, "a"), NewRow: userRow(10, "a")},
+			},
+			expected: map[int64]string{10: "a"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s, db := newTestSQL(t, map[string]any{"batch_size": 2})
+			for i := range c.events {
+				c.events[i].Schema, c.events[i].Table = "test_db", "users"
+			}
+			if err := s.Write(context.Background(), c.events); err != nil {
+				t.Fatal(err)
+			}
+			// 整批重试是幂等的
+			if err := s.Write(context.Background(), c.events); err != nil {
+				t.Fatal(err)
+			}
+			if users := queryUsers(t, db); !reflect.DeepEqual(users, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, users)
+			}
+		})
+	}
+}
+
+func TestSQLUint64(t *testing.T) {
+	s, db := newTestSQL(t, nil)
+	var big uint64 = math.MaxUint64
+	events := []consumer.RowEvent{
+		{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": int64(1), "name": "a", "big": big}},
+		{ID: 2, Action: "update", Schema: "test_db", Table: "users", OldRow: map[string]any{"id": int64(1), "name": "a", "big": big}, NewRow: map[string]any{"id": int64(1), "name": "b", "big": big - 1}},
+	}
+	if err := s.Write(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	var value string
+	if err := db.QueryRow(`SELECT "big" FROM "users" WHERE "id" = 1`).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != "18446744073709551614" {
+		t.Errorf("expected 18446744073709551614, got %s", value)
+	}
+}
+
+func TestSQLRollback(t *testing.T) {
+	s, db := newTestSQL(t, nil)
+	events := []consumer.RowEvent{
+		{ID: 1, Action: "insert", Schema: "test_db", Table: "users", NewRow: userRow(1, "a")},
+		{ID: 2, Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": int64(2), "missing": "b"}},
+	}
+	if err := s.Write(context.Background(), events); err == nil {
+		t.Fatal("expected an error of the missing column")
+	}
+	if users := queryUsers(t, db); len(users) != 0 {
+		t.Errorf("expected rolled back, got %v", users)
+	}
+}
@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"strings"
+)
+
+// keyTemplate 形如 "user:{id}:{name}" 的模板，{column}会被替换为该列的值
+type keyTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	column  string
+}
+
+func parseKeyTemplate(raw string) (*keyTemplate, error) {
+	t := &keyTemplate{raw: raw}
+	for s := raw; s != ""; {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: s})
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return nil, errors.Errorf("[Sink]unclosed \"{\" in key template \"%s\"", raw)
+		}
+		column := s[start+1 : start+end]
+		if column == "" {
+			return nil, errors.Errorf("[Sink]empty column in key template \"%s\"", raw)
+		}
+
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: s[:start]})
+		}
+		t.parts = append(t.parts, templatePart{column: column})
+		s = s[start+end+1:]
+	}
+
+	if len(t.parts) <= 0 {
+		return nil, errors.New("[Sink]key template is empty")
+	}
+	return t, nil
+}
+
+// Columns 模板中引用的列
+func (t *keyTemplate) Columns() []string {
+	var columns []string
+	for _, part := range t.parts {
+		if part.column != "" {
+			columns = append(columns, part.column)
+		}
+	}
+	return columns
+}
+
+// Prefix 模板开头的固定部分，以列开头时为空
+func (t *keyTemplate) Prefix() string {
+	return t.parts[0].literal
+}
+
+// Execute 使用row生成key，row中缺少列时返回错误
+func (t *keyTemplate) Execute(row map[string]any) (string, error) {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		if part.column == "" {
+			sb.WriteString(part.literal)
+			continue
+		}
+
+		val, ok := row[part.column]
+		if !ok {
+			return "", errors.Errorf("[Sink]column \"%s\" of key template \"%s\" not exists", part.column, t.raw)
+		}
+		sb.WriteString(formatValue(val))
+	}
+	return sb.String(), nil
+}
+
+// formatValue 标量转为字符串，其它类型转为JSON，nil为空字符串
+func formatValue(val any) string {
+	if val == nil {
+		return ""
+	}
+	return text_utils.ToString(val, true)
+}
+
+// selectColumns 只保留columns中的列，columns为空时返回全部
+func selectColumns(row map[string]any, columns []string) map[string]any {
+	if len(columns) <= 0 {
+		return row
+	}
+	selected := make(map[string]any, len(columns))
+	for _, column := range columns {
+		if val, ok := row[column]; ok {
+			selected[column] = val
+		}
+	}
+	return selected
+}
@@ -0,0 +1,385 @@
+package sink
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/s3"
+	"gopkg.in/go-mixed/go-common.v1/utils/io"
+	"gopkg.in/go-mixed/go-common.v1/utils/unit"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// S3分段上传的最小分段
+	minPartSize = 5 * 1024 * 1024
+	// 等待上传的文件 "path.upload"，内容为rule的key
+	uploadMarkerExt = ".upload"
+)
+
+// uploadOptions 将关闭的文件上传到S3兼容的对象存储，endpoint为空表示不上传
+type uploadOptions struct {
+	s3.Options `yaml:",inline"`
+	// 对象key的前缀，key为 前缀+文件相对于sink目录的路径
+	Prefix string `yaml:"prefix"`
+	// 超过该大小时分段上传，也是每个分段的大小，最小5MB
+	PartSize string `yaml:"part_size"`
+	// 每个请求的超时
+	Timeout time.Duration `yaml:"timeout"`
+	// 每个请求的重试次数，之后整个文件在max_backoff之后重新上传
+	Retries    int           `yaml:"retries"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// 上传之后对比ETag，服务端加密等ETag不是MD5的情况需要关闭
+	VerifyETag bool `yaml:"verify_etag"`
+}
+
+func defaultUploadOptions() uploadOptions {
+	return uploadOptions{
+		PartSize:   "16MB",
+		Timeout:    5 * time.Minute,
+		Retries:    3,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+		VerifyETag: true,
+	}
+}
+
+// uploader 在后台按顺序上传文件，确认对象的大小和ETag之后才删除本地文件
+//
+//	加入队列的文件都有一个 ".upload" 标记，Close时未上传的文件保留在本地，下次打开时由scan将这个rule标记的文件重新加入队列，
+//	所以多个rule使用同一个目录时，不会上传其它rule的文件，也不会上传正在写入的文件
+type uploader struct {
+	params   Params
+	options  uploadOptions
+	client   *s3.Client
+	partSize int64
+	// 对象key基于该目录的相对路径
+	root string
+
+	lock   sync.Mutex
+	queue  []string
+	notify chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newUploader options中没有endpoint时返回nil
+func newUploader(params Params, options uploadOptions, root string) (*uploader, error) {
+	if options.Endpoint == "" {
+		return nil, nil
+	}
+
+	client, err := s3.NewClient(options.Options, nil)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "[Sink]invalid upload options of rule \"%s\"", params.Rule.Key())
+	}
+	partSize, err := unit.RAMInBytes(options.PartSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[Sink]invalid part_size \"%s\" in rule \"%s\"", options.PartSize, params.Rule.Key())
+	}
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &uploader{
+		params:   params,
+		options:  options,
+		client:   client,
+		partSize: partSize,
+		root:     root,
+		notify:   make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	u.scan()
+	go u.run()
+	return u, nil
+}
+
+// uploadRoot 路径模板中第一个变量之前的目录
+func uploadRoot(path *keyTemplate) string {
+	prefix := path.Prefix()
+	if strings.HasSuffix(prefix, string(filepath.Separator)) {
+		return filepath.Clean(prefix)
+	}
+	return filepath.Dir(prefix)
+}
+
+// scan 将这个rule上次未上传完成的文件加入队列
+func (u *uploader) scan() {
+	_ = filepath.WalkDir(u.root, func(marker string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(marker, uploadMarkerExt) {
+			return nil
+		}
+		if owner, err := os.ReadFile(marker); err != nil || string(owner) != u.params.Rule.Key() {
+			return nil
+		}
+
+		path := strings.TrimSuffix(marker, uploadMarkerExt)
+		if !io_utils.PathExists(path) {
+			_ = os.Remove(marker)
+		} else if original := strings.TrimSuffix(path, ".gz"); original != path && io_utils.PathExists(original) {
+			// 压缩没有完成，上传原文件
+			_ = os.Remove(path)
+			_ = os.Remove(marker)
+		} else {
+			u.push(path)
+		}
+		return nil
+	})
+}
+
+// Mark 标记文件需要由这个rule上传，可以在文件完成之前调用（比如轮转的重命名之前），
+// 这样进程在完成和Enqueue之间退出时，下次启动仍会上传
+func (u *uploader) Mark(path string) {
+	if err := os.WriteFile(path+uploadMarkerExt, []byte(u.params.Rule.Key()), 0o644); err != nil {
+		u.params.Logger.Error("[Sink]mark file to upload error", zap.String("rule", u.params.Rule.Key()), zap.String("file", path), zap.Error(err))
+	}
+}
+
+// Unmark 文件不再需要上传，比如压缩之后的原文件
+func (u *uploader) Unmark(path string) {
+	_ = os.Remove(path + uploadMarkerExt)
+}
+
+// Enqueue 标记已经完成的文件并加入上传队列，不会阻塞
+func (u *uploader) Enqueue(path string) {
+	u.Mark(path)
+	u.push(path)
+}
+
+func (u *uploader) push(path string) {
+	u.lock.Lock()
+	u.queue = append(u.queue, path)
+	u.lock.Unlock()
+
+	select {
+	case u.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (u *uploader) next() (string, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if len(u.queue) <= 0 {
+		return "", false
+	}
+	path := u.queue[0]
+	u.queue = u.queue[1:]
+	return path, true
+}
+
+func (u *uploader) run() {
+	defer close(u.done)
+	for {
+		path, ok := u.next()
+		if !ok {
+			select {
+			case <-u.ctx.Done():
+				return
+			case <-u.notify:
+				continue
+			}
+		}
+
+		for {
+			err := u.upload(path)
+			if err == nil {
+				break
+			}
+			if u.ctx.Err() != nil {
+				return
+			}
+			u.params.Logger.Error("[Sink]upload file error, retry later", zap.String("rule", u.params.Rule.Key()), zap.String("file", path), zap.Error(err))
+			select {
+			case <-u.ctx.Done():
+				return
+			case <-time.After(u.options.MaxBackoff):
+			}
+		}
+	}
+}
+
+// key 对象的key
+func (u *uploader) key(file string) string {
+	rel, err := filepath.Rel(u.root, file)
+	if err != nil {
+		rel = filepath.Base(file)
+	}
+	return path.Join(u.options.Prefix, filepath.ToSlash(rel))
+}
+
+// upload 上传并校验，成功之后删除本地文件
+func (u *uploader) upload(file string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		u.Unmark(file)
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	key := u.key(file)
+	var etag string
+	if stat.Size() <= u.partSize {
+		etag, err = u.putObject(f, key)
+	} else {
+		etag, err = u.multipartUpload(f, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	var info s3.ObjectInfo
+	if err = u.retry(func(ctx context.Context) (err error) {
+		info, err = u.client.HeadObject(ctx, key)
+		return
+	}); err != nil {
+		return err
+	}
+	if info.Size != stat.Size() {
+		return errors.Errorf("[Sink]size of uploaded object \"%s\" is %d, expect %d", key, info.Size, stat.Size())
+	}
+	if u.options.VerifyETag && !strings.EqualFold(strings.Trim(info.ETag, "\""), strings.Trim(etag, "\"")) {
+		return errors.Errorf("[Sink]ETag of uploaded object \"%s\" is %s, expect %s", key, info.ETag, etag)
+	}
+
+	_ = f.Close()
+	if err = os.Remove(file); err != nil {
+		return errors.Wrapf(err, "[Sink]remove uploaded file \"%s\" error", file)
+	}
+	u.Unmark(file)
+	u.params.Logger.Info("[Sink]file uploaded", zap.String("rule", u.params.Rule.Key()), zap.String("file", file), zap.String("bucket", u.client.Bucket()), zap.String("key", key), zap.Int64("size", stat.Size()))
+	return nil
+}
+
+// putObject 返回本地计算的ETag
+func (u *uploader) putObject(f *os.File, key string) (string, error) {
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err = u.retry(func(ctx context.Context) error {
+		_, err := u.client.PutObject(ctx, key, body)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	sum := md5.Sum(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// multipartUpload 失败时放弃已经上传的分段，返回本地计算的ETag
+func (u *uploader) multipartUpload(f *os.File, key string) (string, error) {
+	var uploadID string
+	if err := u.retry(func(ctx context.Context) (err error) {
+		uploadID, err = u.client.CreateMultipartUpload(ctx, key)
+		return
+	}); err != nil {
+		return "", err
+	}
+
+	var parts []s3.Part
+	var sums [][]byte
+	buf := make([]byte, u.partSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			u.abort(key, uploadID)
+			return "", errors.WithStack(err)
+		}
+
+		body := buf[:n]
+		var part s3.Part
+		if err = u.retry(func(ctx context.Context) (err error) {
+			part, err = u.client.UploadPart(ctx, key, uploadID, number, body)
+			return
+		}); err != nil {
+			u.abort(key, uploadID)
+			return "", err
+		}
+		sum := md5.Sum(body)
+		parts = append(parts, part)
+		sums = append(sums, sum[:])
+	}
+
+	if err := u.retry(func(ctx context.Context) error {
+		_, err := u.client.CompleteMultipartUpload(ctx, key, uploadID, parts)
+		return err
+	}); err != nil {
+		u.abort(key, uploadID)
+		return "", err
+	}
+	return s3.MultipartETag(sums), nil
+}
+
+// abort Close之后也需要执行，所以不使用u.ctx
+func (u *uploader) abort(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := u.client.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		u.params.Logger.Warn("[Sink]abort multipart upload error", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// retry 重试网络错误以及可以重试的S3错误
+func (u *uploader) retry(fn func(ctx context.Context) error) error {
+	backoff := u.options.Backoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(u.ctx, u.options.Timeout)
+		err := fn(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		var s3Err *s3.Error
+		if (errors.As(err, &s3Err) && !s3Err.Retryable()) || attempt >= u.options.Retries || u.ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-u.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > u.options.MaxBackoff {
+			backoff = u.options.MaxBackoff
+		}
+	}
+}
+
+// Close 停止上传，正在上传的文件保留在本地
+func (u *uploader) Close() {
+	u.cancel()
+	<-u.done
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if len(u.queue) > 0 {
+		u.params.Logger.Warn("[Sink]files are not uploaded, they will be uploaded at next start", zap.String("rule", u.params.Rule.Key()), zap.Int("files", len(u.queue)))
+	}
+}
@@ -0,0 +1,305 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/s3"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 内存中的对象存储，failures中的操作先返回对应次数的503
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	parts   map[string]map[int][]byte
+	// "put" "part" "complete"
+	failures map[string]int
+	// CompleteMultipartUpload先返回对应次数的 200 <Error>
+	completeErrors int
+	// 不为空时HeadObject返回这个ETag和大小
+	headETag string
+	headSize int
+	requests []string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, string) {
+	s := &fakeS3{objects: map[string][]byte{}, etags: map[string]string{}, parts: map[string]map[int][]byte{}, failures: map[string]int{}}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server.URL
+}
+
+func (s *fakeS3) fail(op string, w http.ResponseWriter) bool {
+	if s.failures[op] <= 0 {
+		return false
+	}
+	s.failures[op]--
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte(`<Error><Code>ServiceUnavailable</Code><Message>Please reduce your request rate.</Message></Error>`))
+	return true
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/dm/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r.Method+" "+key)
+
+	switch {
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		if s.fail("part", w) {
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts[query.Get("uploadId")][number] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", "\""+hex.EncodeToString(sum[:])+"\"")
+	case r.Method == http.MethodPut:
+		if s.fail("put", w) {
+			return
+		}
+		sum := md5.Sum(body)
+		s.objects[key], s.etags[key] = body, "\""+hex.EncodeToString(sum[:])+"\""
+		w.Header().Set("ETag", s.etags[key])
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(s.parts)+1)
+		s.parts[uploadID] = map[int][]byte{}
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPost:
+		if s.fail("complete", w) {
+			return
+		}
+		if s.completeErrors > 0 {
+			s.completeErrors--
+			_, _ = w.Write([]byte(`<Error><Code>InternalError</Code><Message>We encountered an internal error. Please try again.</Message></Error>`))
+			return
+		}
+		var request struct {
+			Parts []s3.Part `xml:"Part"`
+		}
+		_ = xml.Unmarshal(body, &request)
+		var object []byte
+		var sums [][]byte
+		for _, part := range request.Parts {
+			buf := s.parts[query.Get("uploadId")][part.PartNumber]
+			sum := md5.Sum(buf)
+			object, sums = append(object, buf...), append(sums, sum[:])
+		}
+		s.objects[key], s.etags[key] = object, s3.MultipartETag(sums)
+		_, _ = fmt.Fprintf(w, "<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>", s.etags[key])
+	case r.Method == http.MethodDelete:
+		delete(s.parts, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if s.headSize > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(s.headSize))
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		}
+		if s.headETag != "" {
+			w.Header().Set("ETag", s.headETag)
+		} else {
+			w.Header().Set("ETag", s.etags[key])
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *fakeS3) object(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+func (s *fakeS3) keys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestUploader(t *testing.T, endpoint, root, table string, partSize string) *uploader {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := defaultUploadOptions()
+	options.Endpoint, options.Bucket = endpoint, "dm"
+	options.AccessKeyID, options.SecretAccessKey = "AKID", "secret"
+	options.Prefix = "backup"
+	options.Backoff, options.MaxBackoff = time.Millisecond, 10*time.Millisecond
+	if partSize != "" {
+		options.PartSize = partSize
+	}
+
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l},
+		Rule:       &settings.RuleOptions{Schema: "test_db", Table: table, Sink: "file"},
+	}
+	u, err := newUploader(params, options, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(u.Close)
+	return u
+}
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitUploaded 等待本地文件被删除
+func waitUploaded(t *testing.T, path string) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if _, err = os.Stat(path + uploadMarkerExt); !os.IsNotExist(err) {
+				t.Errorf("expected the marker of \"%s\" removed: %v", path, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("\"%s\" is not uploaded", path)
+}
+
+func TestUploadPutObject(t *testing.T) {
+	server, endpoint := newFakeS3(t)
+	server.failures["put"] = 2
+	root := t.TempDir()
+	u := newTestUploader(t, endpoint, root, "users", "")
+
+	path := filepath.Join(root, "test_db", "users-20260102030405.log")
+	writeTestFile(t, path, []byte("hello"))
+	u.Enqueue(path)
+	waitUploaded(t, path)
+
+	// 503之后重试
+	if object, ok := server.object("backup/test_db/users-20260102030405.log"); !ok || string(object) != "hello" {
+		t.Errorf("unexpected objects %v", server.keys())
+	}
+}
+
+func TestUploadMultipart(t *testing.T) {
+	server, endpoint := newFakeS3(t)
+	server.failures["part"] = 1
+	server.completeErrors = 1
+	root := t.TempDir()
+	u := newTestUploader(t, endpoint, root, "users", "5MB")
+
+	content := bytes.Repeat([]byte("0123456789"), minPartSize/10+100)
+	path := filepath.Join(root, "users.parquet")
+	writeTestFile(t, path, content)
+	u.Enqueue(path)
+	waitUploaded(t, path)
+
+	// 分段的503和CompleteMultipartUpload的 200 <Error> 都会重试
+	if object, ok := server.object("backup/users.parquet"); !ok || !bytes.Equal(object, content) {
+		t.Errorf("unexpected objects %v", server.keys())
+	}
+}
+
+func TestUploadVerify(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		etag string
+		size int
+	}{
+		{"etag mismatch", "\"00000000000000000000000000000000\"", 0},
+		{"size mismatch", "", 4},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			server, endpoint := newFakeS3(t)
+			server.headETag, server.headSize = c.etag, c.size
+			root := t.TempDir()
+			u := newTestUploader(t, endpoint, root, "users", "")
+
+			path := filepath.Join(root, "users.log")
+			writeTestFile(t, path, []byte("hello"))
+			u.Enqueue(path)
+
+			// 校验失败时保留本地文件，并在max_backoff之后重新上传
+			time.Sleep(50 * time.Millisecond)
+			u.Close()
+			if _, ok := server.object("backup/users.log"); !ok {
+				t.Fatalf("expected uploaded, requests: %v", server.requests)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("expected the local file kept: %v", err)
+			}
+			if _, err := os.Stat(path + uploadMarkerExt); err != nil {
+				t.Errorf("expected the marker kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestUploadScan(t *testing.T) {
+	server, endpoint := newFakeS3(t)
+	root := t.TempDir()
+
+	finished := filepath.Join(root, "users-20260102030405.log")
+	writeTestFile(t, finished, []byte("finished"))
+	writeTestFile(t, finished+uploadMarkerExt, []byte("test_db.users"))
+	// 正在写入的文件
+	open := filepath.Join(root, "users.log")
+	writeTestFile(t, open, []byte("open"))
+	// 其它rule的文件
+	other := filepath.Join(root, "orders-20260102030405.log")
+	writeTestFile(t, other, []byte("other"))
+	writeTestFile(t, other+uploadMarkerExt, []byte("test_db.orders"))
+	// 没有压缩完成
+	compressing := filepath.Join(root, "users-20260102030406.log")
+	writeTestFile(t, compressing, []byte("compressing"))
+	writeTestFile(t, compressing+uploadMarkerExt, []byte("test_db.users"))
+	writeTestFile(t, compressing+".gz", []byte("partial"))
+	writeTestFile(t, compressing+".gz"+uploadMarkerExt, []byte("test_db.users"))
+	// 已经上传，但是没有删除标记
+	writeTestFile(t, filepath.Join(root, "users-20260102030407.log")+uploadMarkerExt, []byte("test_db.users"))
+
+	newTestUploader(t, endpoint, root, "users", "")
+	waitUploaded(t, finished)
+	waitUploaded(t, compressing)
+
+	if keys := server.keys(); strings.Join(keys, ",") != "backup/users-20260102030405.log,backup/users-20260102030406.log" {
+		t.Errorf("unexpected objects %v", keys)
+	}
+	files := parquetFiles(t, root)
+	if strings.Join(files, ",") != "orders-20260102030405.log,orders-20260102030405.log.upload,users.log" {
+		t.Errorf("unexpected local files %v", files)
+	}
+}
@@ -0,0 +1,225 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/format"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookHeaderRule      = "X-DM-Rule"
+	webhookHeaderTimestamp = "X-DM-Timestamp"
+	webhookHeaderSignature = "X-DM-Signature"
+
+	// 错误信息中最多保留的响应内容
+	webhookMaxErrorBody = 512
+)
+
+// webhookOptions webhook的options
+type webhookOptions struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// 不为空时，使用HMAC-SHA256对 "timestamp.body" 签名
+	Secret string `yaml:"secret"`
+	// 每个请求中最多的events数量
+	BatchSize int `yaml:"batch_size"`
+	// 每个请求的超时
+	Timeout time.Duration `yaml:"timeout"`
+	// 5xx、408、429或者超时时的重试次数
+	Retries int `yaml:"retries"`
+	// 第一次重试的等待时间，之后每次翻倍，最多MaxBackoff
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+
+	serializerOptions `yaml:",inline"`
+}
+
+func defaultWebhookOptions() webhookOptions {
+	return webhookOptions{
+		BatchSize:  100,
+		Timeout:    10 * time.Second,
+		Retries:    3,
+		Backoff:    time.Second,
+		MaxBackoff: 30 * time.Second,
+
+		serializerOptions: defaultSerializerOptions(),
+	}
+}
+
+// webhookBody 请求的JSON，events为format序列化的JSON
+type webhookBody struct {
+	Rule   string            `json:"rule"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// webhook 将events分批POST到url
+//
+//	2xx为成功；5xx、408、429、网络错误和超时会重试；其它4xx为PoisonError，只有这个请求的events会被移入死信
+type webhook struct {
+	params     Params
+	options    webhookOptions
+	serializer format.Serializer
+	client     *http.Client
+}
+
+func init() {
+	Register("webhook", func() Sink { return &webhook{} })
+}
+
+func (s *webhook) Open(ctx context.Context, params Params) error {
+	s.params = params
+	s.options = defaultWebhookOptions()
+	if err := params.DecodeOptions(&s.options); err != nil {
+		return err
+	}
+
+	if u, err := url.Parse(s.options.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.Errorf("[Sink]invalid url \"%s\" in rule \"%s\"", s.options.URL, params.Rule.Key())
+	}
+	if s.options.BatchSize <= 0 {
+		return errors.Errorf("[Sink]\"batch_size\" must be greater than 0 in rule \"%s\"", params.Rule.Key())
+	}
+
+	var err error
+	if s.serializer, err = newSerializer(params, s.options.Format, s.options.FormatOptions); err != nil {
+		return err
+	}
+	if s.serializer.ContentType() != "application/json" {
+		return errors.Errorf("[Sink]format \"%s\" is not JSON, which can not be used in rule \"%s\"", s.options.Format, params.Rule.Key())
+	}
+
+	s.client = &http.Client{Timeout: s.options.Timeout}
+	return nil
+}
+
+// Write 请求可以重试的失败时整批重试，所以接收方需要按id去重；
+// 返回4xx的请求和不兼容schema_registry的events不再重试，其它请求继续发送，最后只有这些events移入死信
+func (s *webhook) Write(ctx context.Context, events []consumer.RowEvent) error {
+	var poison poisonBatch
+	for start := 0; start < len(events); start += s.options.BatchSize {
+		end := start + s.options.BatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		batch := webhookBody{Rule: s.params.Rule.Key()}
+		var sent []consumer.RowEvent
+		for _, event := range events[start:end] {
+			buf, err := marshalEvent(ctx, s.serializer, event)
+			if registry.IsIncompatible(err) {
+				poison.add(err, event)
+				continue
+			} else if err != nil {
+				return err
+			}
+			batch.Events = append(batch.Events, buf)
+			sent = append(sent, event)
+		}
+		if len(sent) <= 0 {
+			continue
+		}
+
+		body, err := text_utils.JsonMarshalToBytes(batch)
+		if err != nil {
+			return errors.Wrapf(err, "[Sink]encode events of rule \"%s\" error", s.params.Rule.Key())
+		}
+		if err = s.post(ctx, body); err != nil {
+			var poisonErr *PoisonError
+			if !errors.As(err, &poisonErr) {
+				return errors.WithMessagef(err, "[Sink]webhook of rule \"%s\", events %d~%d", s.params.Rule.Key(), events[start].ID, events[end-1].ID)
+			}
+			poison.add(errors.WithMessagef(poisonErr.err, "[Sink]webhook of rule \"%s\", events %d~%d", s.params.Rule.Key(), events[start].ID, events[end-1].ID), sent...)
+		}
+	}
+	return poison.err()
+}
+
+// post 发送一个请求，按照Backoff重试
+func (s *webhook) post(ctx context.Context, body []byte) error {
+	backoff := s.options.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.send(ctx, body)
+		if err == nil || !retryable || attempt >= s.options.Retries {
+			return err
+		}
+
+		s.params.Logger.Warn("[Sink]webhook error, retrying",
+			zap.String("rule", s.params.Rule.Key()),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return errors.WithMessage(ctx.Err(), err.Error())
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.options.MaxBackoff {
+			backoff = s.options.MaxBackoff
+		}
+	}
+}
+
+// send 返回的错误是否可以重试
+func (s *webhook) send(ctx context.Context, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhookHeaderRule, s.params.Rule.Key())
+	for k, v := range s.options.Headers {
+		request.Header.Set(k, v)
+	}
+	if s.options.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request.Header.Set(webhookHeaderTimestamp, timestamp)
+		request.Header.Set(webhookHeaderSignature, "sha256="+s.sign(timestamp, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		// ctx结束时不再重试
+		return ctx.Err() == nil, errors.WithStack(err)
+	}
+	defer response.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(response.Body, webhookMaxErrorBody))
+
+	switch code := response.StatusCode; {
+	case code >= 200 && code < 300:
+		return false, nil
+	case code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout:
+		return true, errors.Errorf("status %d: %s", code, respBody)
+	default:
+		return false, NewPoisonError(fmt.Errorf("status %d: %s", code, respBody))
+	}
+}
+
+// sign 签名为 hex(HMAC-SHA256(secret, timestamp + "." + body))
+func (s *webhook) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.options.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhook) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,105 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestWebhook handler收到每个请求中events的id
+func newTestWebhook(t *testing.T, handler func(ids []uint64) int) Sink {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Events []struct {
+				ID uint64 `json:"id"`
+			} `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var ids []uint64
+		for _, event := range body.Events {
+			ids = append(ids, event.ID)
+		}
+		w.WriteHeader(handler(ids))
+	}))
+	t.Cleanup(server.Close)
+
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &webhook{}
+	params := Params{
+		Components: &component.Components{Settings: &settings.Settings{}, Logger: l},
+		Rule: &settings.RuleOptions{Schema: "test_db", Table: "users", Sink: "webhook", Options: map[string]any{
+			"url":        server.URL,
+			"batch_size": 2,
+			"backoff":    "1ms",
+		}},
+	}
+	if err = s.Open(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func testWebhookEvents(n int) []consumer.RowEvent {
+	var events []consumer.RowEvent
+	for i := 1; i <= n; i++ {
+		events = append(events, consumer.RowEvent{ID: uint64(i), Action: "insert", Schema: "test_db", Table: "users", NewRow: map[string]any{"id": i}})
+	}
+	return events
+}
+
+func TestWebhookPoisonEvents(t *testing.T) {
+	var requests atomic.Int32
+	s := newTestWebhook(t, func(ids []uint64) int {
+		requests.Add(1)
+		if ids[0] == 3 { // 第二个请求
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+
+	events := testWebhookEvents(5)
+	err := s.Write(context.Background(), events)
+	if !IsPoison(err) {
+		t.Fatalf("expected a poison error, got %v", err)
+	}
+	// 4xx的请求不重试，之后的请求继续发送
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+	poison := PoisonEvents(err, events)
+	if len(poison) != 2 || poison[0].ID != 3 || poison[1].ID != 4 {
+		t.Errorf("expected the events 3~4 as poison, got %v", poison)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	for _, code := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway} {
+		var requests atomic.Int32
+		s := newTestWebhook(t, func(ids []uint64) int {
+			if requests.Add(1) == 1 {
+				return code
+			}
+			return http.StatusOK
+		})
+
+		if err := s.Write(context.Background(), testWebhookEvents(1)); err != nil {
+			t.Errorf("status %d: expected retried, got %v", code, err)
+		}
+		if n := requests.Load(); n != 2 {
+			t.Errorf("status %d: expected 2 requests, got %d", code, n)
+		}
+	}
+}
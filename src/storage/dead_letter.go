@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+// DeadLetter Sink无法处理的一批events（比如webhook返回4xx），从events中移出后保存在这里
+type DeadLetter struct {
+	Key    string
+	Rule   string
+	Sink   string
+	Error  string
+	At     time.Time
+	Events []consumer.RowEvent
+}
+
+// SaveDeadLetter 保存一个死信，key为第一个event的key
+func (s *Storage) SaveDeadLetter(rule, sink string, reason error, events []consumer.RowEvent) error {
+	if len(events) <= 0 {
+		return nil
+	}
+
+	letter := DeadLetter{
+		Key:    common.BuildEventKey(events[0].ID, events[0].Schema, events[0].Table, events[0].Action),
+		Rule:   rule,
+		Sink:   sink,
+		Error:  reason.Error(),
+		At:     time.Now(),
+		Events: events,
+	}
+	return errors.WithMessagef(s.bolt.Bucket(common.StorageDeadLetters).Set(letter.Key, letter), "[Storage]save dead letter \"%s\" error", letter.Key)
+}
+
+// ScanDeadLetters 按key顺序只读遍历所有的死信，callback返回false跳出循环
+func (s *Storage) ScanDeadLetters(callback func(letter DeadLetter) bool) error {
+	return s.bolt.Bucket(common.StorageDeadLetters).View(func(bucket *bbolt.Bucket) error {
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var letter DeadLetter
+			if err := text_utils.GobDecode(v, &letter); err != nil {
+				return errors.Wrapf(err, "[Storage]decode dead letter \"%s\" error", k)
+			}
+			if !callback(letter) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// DeadLetterCount 死信的数量
+func (s *Storage) DeadLetterCount() uint64 {
+	return uint64(s.bolt.Bucket(common.StorageDeadLetters).Count())
+}
+
+// DeleteDeadLetter 删除一个死信
+func (s *Storage) DeleteDeadLetter(key string) error {
+	return s.bolt.Bucket(common.StorageDeadLetters).Delete(key)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/go-mysql-org/go-mysql/schema"
 	"github.com/pkg/errors"
@@ -8,6 +9,7 @@ import (
 	"go.uber.org/zap"
 	consumer "gopkg.in/go-mixed/dm-consumer.v1"
 	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/registry"
 	"gopkg.in/go-mixed/dm.v1/src/settings"
 	"gopkg.in/go-mixed/go-common.v1/conf.v1"
 	"gopkg.in/go-mixed/go-common.v1/logger.v1"
@@ -16,6 +18,7 @@ import (
 	"gopkg.in/go-mixed/go-common.v1/utils/io"
 	"gopkg.in/go-mixed/go-common.v1/utils/text"
 	"path/filepath"
+	"sync"
 )
 
 type Storage struct {
@@ -24,7 +27,10 @@ type Storage struct {
 
 	bolt *storage.Bolt
 
-	tables map[string]*schema.Table
+	tables     map[string]*schema.Table
+	tablesLock sync.RWMutex
+	// 不为nil时，新的列结构会注册为新的schema版本
+	registry *registry.Registry
 
 	latestID uint64
 }
@@ -48,19 +54,23 @@ func NewStorage(settings *settings.Settings, logger *logger.Logger) (*Storage, e
 }
 
 func (s *Storage) Initial() error {
-	s.ReadTables()
-
 	pos := s.ReadBinLogPosition()
 	if pos.IsEmpty() { // delete events if master-info.yaml not exists
 		s.ClearEvents()
 	}
 
+	s.Load()
+	return nil
+}
+
+// Load 只读取storage中的数据，不会修改events，用于离线的命令
+func (s *Storage) Load() {
+	s.ReadTables()
+
 	_ = s.bolt.Bucket(common.StorageEvents).View(func(bucket *bbolt.Bucket) error {
 		s.latestID = bucket.Sequence()
 		return nil
 	})
-
-	return nil
 }
 
 func (s *Storage) Close() error {
@@ -68,11 +78,15 @@ func (s *Storage) Close() error {
 }
 
 func (s *Storage) SaveBinLogPosition(binLog common.BinLogPosition) {
-	positionPath := filepath.Join(s.settings.Storage, common.PositionFilename)
-	if err := conf.WriteSettings(binLog, positionPath); err != nil {
+	if err := s.WriteBinLogPosition(binLog); err != nil {
 		s.logger.Error(err.Error())
 	}
-	s.logger.Info("[Storage]binlog position saved", zap.String("file", binLog.File), zap.Uint32("position", binLog.Position), zap.Uint64("latestID", s.latestID))
+	s.logger.Info("[Storage]binlog position saved", zap.String("file", binLog.File), zap.Uint32("position", binLog.Position), zap.String("gtid", binLog.GTID), zap.Uint64("latestID", s.latestID))
+}
+
+func (s *Storage) WriteBinLogPosition(binLog common.BinLogPosition) error {
+	positionPath := filepath.Join(s.settings.Storage, common.PositionFilename)
+	return conf.WriteSettings(binLog, positionPath)
 }
 
 func (s *Storage) ReadBinLogPosition() common.BinLogPosition {
@@ -90,7 +104,7 @@ func (s *Storage) ReadBinLogPosition() common.BinLogPosition {
 
 func (s *Storage) GetLatestBinLogPosition(currentBinLog common.BinLogPosition) common.BinLogPosition {
 	savedBinLog := s.ReadBinLogPosition()
-	if savedBinLog.GreaterThan(currentBinLog) {
+	if savedBinLog.GTID != "" || savedBinLog.GreaterThan(currentBinLog) {
 		return savedBinLog
 	}
 
@@ -98,6 +112,9 @@ func (s *Storage) GetLatestBinLogPosition(currentBinLog common.BinLogPosition) c
 }
 
 func (s *Storage) ReadTables() {
+	s.tablesLock.Lock()
+	defer s.tablesLock.Unlock()
+
 	if _, err := s.bolt.Bucket(common.StorageTables).ForEach(func(bucket *bbolt.Bucket, kv *utils.KV) error {
 		var table schema.Table
 		if err := text_utils.GobDecode(kv.Value, &table); err != nil {
@@ -113,6 +130,9 @@ func (s *Storage) ReadTables() {
 
 // GetTable 通过别名获取table的结构
 func (s *Storage) GetTable(alias string) *schema.Table {
+	s.tablesLock.RLock()
+	defer s.tablesLock.RUnlock()
+
 	table, ok := s.tables[alias]
 	if !ok {
 		table, _ = s.tables[common.CleanTableName(alias)]
@@ -120,10 +140,18 @@ func (s *Storage) GetTable(alias string) *schema.Table {
 	return table
 }
 
+// SetRegistry 启用schema_registry时设置
+func (s *Storage) SetRegistry(registry *registry.Registry) {
+	s.registry = registry
+}
+
 // SaveAndGetTableAlias 保存当前table，并返回别名
 func (s *Storage) SaveAndGetTableAlias(table *schema.Table) string {
 	tableName := common.BuildTableName(table.Schema, table.Name, table.Columns)
 
+	s.tablesLock.Lock()
+	defer s.tablesLock.Unlock()
+
 	if _, ok := s.tables[tableName]; ok {
 		return tableName
 	}
@@ -134,12 +162,83 @@ func (s *Storage) SaveAndGetTableAlias(table *schema.Table) string {
 	if err := s.bolt.Bucket(common.StorageTables).Set(tableName, table); err != nil {
 		s.logger.Error("[Storage]table write to storage error", zap.Error(err))
 	}
+	// 不兼容时只记录日志，序列化这个表的events时会再次报错，这些events会被移入死信
+	if s.registry != nil {
+		if _, err := s.registry.Register(common.ToConsumerTable(table)); err != nil {
+			s.logger.Error("[Storage]register table schema error", zap.String("table", tableName), zap.Error(err))
+		}
+	}
 
 	return tableName
 }
 
-// SaveEvents 保存binlog事件到storage
-func (s *Storage) SaveEvents(events []consumer.RowEvent) {
+// Tables 返回所有缓存的table结构，键为别名
+func (s *Storage) Tables() map[string]*schema.Table {
+	s.tablesLock.RLock()
+	defer s.tablesLock.RUnlock()
+
+	tables := make(map[string]*schema.Table, len(s.tables))
+	for alias, table := range s.tables {
+		tables[alias] = table
+	}
+	return tables
+}
+
+// storedEvent storage中event的格式，前面的字段和consumer.RowEvent相同，所以gob可以互相解码
+type storedEvent struct {
+	ID       uint64
+	Schema   string
+	Table    string
+	Alias    string
+	OldRow   map[string]any
+	NewRow   map[string]any
+	DiffCols []string
+	Action   string
+
+	LogName   string
+	LogPos    uint32
+	Timestamp uint32
+	Snapshot  bool
+	TxnPos    uint32
+}
+
+func newStoredEvent(event consumer.RowEvent, meta common.EventMeta) storedEvent {
+	return storedEvent{
+		ID:        event.ID,
+		Schema:    event.Schema,
+		Table:     event.Table,
+		Alias:     event.Alias,
+		OldRow:    event.OldRow,
+		NewRow:    event.NewRow,
+		DiffCols:  event.DiffCols,
+		Action:    event.Action,
+		LogName:   meta.LogName,
+		LogPos:    meta.LogPos,
+		Timestamp: meta.Timestamp,
+		Snapshot:  meta.Snapshot,
+		TxnPos:    meta.TxnPos,
+	}
+}
+
+func (e storedEvent) RowEvent() consumer.RowEvent {
+	return consumer.RowEvent{
+		ID:       e.ID,
+		Schema:   e.Schema,
+		Table:    e.Table,
+		Alias:    e.Alias,
+		OldRow:   e.OldRow,
+		NewRow:   e.NewRow,
+		DiffCols: e.DiffCols,
+		Action:   e.Action,
+	}
+}
+
+func (e storedEvent) Meta() common.EventMeta {
+	return common.EventMeta{LogName: e.LogName, LogPos: e.LogPos, Timestamp: e.Timestamp, Snapshot: e.Snapshot, TxnPos: e.TxnPos}
+}
+
+// SaveEvents 保存binlog事件到storage，meta为这些events所在的binlog事件
+func (s *Storage) SaveEvents(events []consumer.RowEvent, meta common.EventMeta) {
 	if len(events) <= 0 {
 		return
 	}
@@ -152,7 +251,7 @@ func (s *Storage) SaveEvents(events []consumer.RowEvent) {
 			key := common.BuildEventKey(id, event.Schema, event.Table, event.Action)
 			event.ID = id
 
-			buf, err := text_utils.GobEncode(event)
+			buf, err := text_utils.GobEncode(newStoredEvent(event, meta))
 			if err != nil {
 				s.logger.Error(fmt.Sprintf("[Storage]encode event \"%s\" error", key), zap.Error(err))
 				buf = nil
@@ -186,13 +285,13 @@ func (s *Storage) LatestID() uint64 {
 	return s.latestID
 }
 
-func (s *Storage) EventForEach(keyStart string, callback func(key string, event consumer.RowEvent) bool) string {
+func (s *Storage) EventForEach(keyStart string, callback func(key string, event consumer.RowEvent, meta common.EventMeta) bool) string {
 	nextKey, _, err := s.bolt.Bucket(common.StorageEvents).RangeCallback(keyStart, "", "", int64(s.settings.TaskOptions.MaxBulkSize), func(bucket *bbolt.Bucket, kv *utils.KV) error {
-		var event consumer.RowEvent
+		var event storedEvent
 		if err := text_utils.GobDecode(kv.Value, &event); err != nil {
 			return err
 		}
-		if !callback(kv.Key, event) { // 返回false跳出循环
+		if !callback(kv.Key, event.RowEvent(), event.Meta()) { // 返回false跳出循环
 			return storage.ErrForEachBreak
 		}
 
@@ -214,3 +313,70 @@ func (s *Storage) DeleteEventsTo(toKey string) {
 		s.logger.Debug(fmt.Sprintf("[Storage]deleted %d events to key: %s", n, toKey))
 	}
 }
+
+// DeleteEvents 实时删除指定的events
+func (s *Storage) DeleteEvents(keys []string) error {
+	return s.bolt.Bucket(common.StorageEvents).Update(func(bucket *bbolt.Bucket) error {
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return errors.Wrapf(err, "[Storage]delete event \"%s\" error", key)
+			}
+		}
+		return nil
+	})
+}
+
+// ScanEvents 只读遍历ID在fromID~toID（含）之间的events，toID为0表示不限，callback返回false跳出循环
+func (s *Storage) ScanEvents(fromID, toID uint64, callback func(key string, event consumer.RowEvent) bool) error {
+	keyStart := common.BuildEventKey(fromID, "", "", "")
+	var keyEnd []byte
+	if toID > 0 {
+		keyEnd = []byte(common.BuildEventKey(toID+1, "", "", ""))
+	}
+
+	return s.bolt.Bucket(common.StorageEvents).View(func(bucket *bbolt.Bucket) error {
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek([]byte(keyStart)); k != nil; k, v = cursor.Next() {
+			if keyEnd != nil && bytes.Compare(k, keyEnd) >= 0 {
+				break
+			}
+
+			var event consumer.RowEvent
+			if err := text_utils.GobDecode(v, &event); err != nil {
+				return errors.Wrapf(err, "[Storage]decode event \"%s\" error", k)
+			}
+			if !callback(string(k), event) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// GetEvent 通过ID读取event，不存在时返回空的key
+func (s *Storage) GetEvent(id uint64) (string, *consumer.RowEvent, error) {
+	var key string
+	var event *consumer.RowEvent
+	err := s.ScanEvents(id, id, func(_key string, _event consumer.RowEvent) bool {
+		key, event = _key, &_event
+		return false
+	})
+
+	return key, event, err
+}
+
+// DeleteEvent 实时删除某一个event
+func (s *Storage) DeleteEvent(key string) error {
+	return s.bolt.Bucket(common.StorageEvents).Delete(key)
+}
+
+// DeleteEventsFrom 实时删除ID大于等于fromID的所有events
+func (s *Storage) DeleteEventsFrom(fromID uint64) (int64, error) {
+	return s.bolt.Bucket(common.StorageEvents).DeleteRange(common.BuildEventKey(fromID, "", "", ""), "", "")
+}
+
+// PurgeEventsTo 实时删除ID小于等于toID的所有events
+func (s *Storage) PurgeEventsTo(toID uint64) (int64, error) {
+	// 形如"%020d/"的key一定排在该ID所有的key之前
+	return s.bolt.Bucket(common.StorageEvents).DeleteRange("", common.BuildEventKey(toID+1, "", "", ""), "")
+}
@@ -9,6 +9,7 @@ import (
 )
 
 func (t *Task) OnRotate(rotateEvent *replication.RotateEvent) error {
+	t.txnPos = 0
 	return nil
 }
 
@@ -17,14 +18,29 @@ func (t *Task) OnTableChanged(schema string, table string) error {
 }
 
 func (t *Task) OnDDL(nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+	t.txnPos = 0 // DDL会隐式提交
 	return nil
 }
 
 func (t *Task) OnRow(e *canal.RowsEvent) error {
+	// 暂停时阻塞读取binlog
+	if err := t.readerPauser.Wait(t.ctx); err != nil {
+		return err
+	}
+
+	// 删除的rules在重启canal之前仍会被canal读取，所以这里还需要过滤
+	if !t.matchRule(e.Table.Schema, e.Table.Name) {
+		return nil
+	}
 
 	n := len(e.Rows)
 	var rowEvents []consumer.RowEvent
 
+	// mysqldump的行没有binlog header
+	if e.Header == nil {
+		t.onSnapshotRow()
+	}
+
 	alias := t.Storage.SaveAndGetTableAlias(e.Table)
 
 	switch e.Action {
@@ -69,12 +85,23 @@ func (t *Task) OnRow(e *canal.RowsEvent) error {
 		}
 	}
 
-	t.Storage.SaveEvents(rowEvents)
-	t.trigger.OnCountChanged(t.Storage.EventCount())
+	if t.recorder != nil {
+		t.recorder.Write(alias, e.Table, rowEvents)
+	}
+	meta := common.EventMeta{Snapshot: true}
+	if e.Header != nil {
+		if t.txnPos == 0 {
+			t.txnPos = e.Header.LogPos
+		}
+		meta = common.EventMeta{LogName: t.canal.LogName(), LogPos: e.Header.LogPos, Timestamp: e.Header.Timestamp, TxnPos: t.txnPos}
+	}
+	t.Storage.SaveEvents(rowEvents, meta)
+	t.trigger.OnCountChanged(t.remainCount())
 	return nil
 }
 
 func (t *Task) OnXID(nextPos mysql.Position) error {
+	t.txnPos = 0
 	return nil
 }
 
@@ -83,7 +110,11 @@ func (t *Task) OnGTID(gtid mysql.GTIDSet) error {
 }
 
 func (t *Task) OnPosSynced(pos mysql.Position, set mysql.GTIDSet, force bool) error {
-	_pos := common.NewBinLogPositions(pos)
+	_pos := common.NewBinLogPositions(pos, set)
+	if t.dryRun != nil { // dry-run时不保存binlog位置
+		t.binLog = _pos
+		return nil
+	}
 	t.Storage.SaveBinLogPosition(_pos)
 	t.binLog = _pos
 
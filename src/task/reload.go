@@ -0,0 +1,96 @@
+package task
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"reflect"
+	"strings"
+)
+
+// Reload 重新读取配置文件，并在两个批次的消费之间替换rules
+//
+//	只有 task.rules 可以在运行时修改，其它配置有变化时拒绝本次加载，需要重启进程
+func (t *Task) Reload() error {
+	t.reloadLock.Lock()
+	defer t.reloadLock.Unlock()
+
+	cfg, err := settings.LoadSettings(t.Settings.ConfigFile)
+	if err != nil {
+		return errors.Wrapf(err, "[Task]reload settings \"%s\" error", t.Settings.ConfigFile)
+	}
+
+	if changes := t.Settings.ImmutableChanges(cfg); len(changes) > 0 {
+		return errors.Errorf("[Task]reload settings \"%s\" rejected, these settings cannot be changed without restart: %s", t.Settings.ConfigFile, strings.Join(changes, ", "))
+	}
+
+	added, removed, changed := diffRules(t.Settings.TaskOptions.Rules, cfg.TaskOptions.Rules)
+	if len(added)+len(removed)+len(changed) <= 0 {
+		t.Logger.Info("[Task]rules are not changed", zap.String("config", t.Settings.ConfigFile))
+		return nil
+	}
+
+	// 等待当前批次消费完毕
+	t.setMatchingRules(cfg.TaskOptions.Rules)
+	t.rulesLock.Lock()
+	t.Settings.TaskOptions.Rules = cfg.TaskOptions.Rules
+	for _, key := range append(removed, changed...) {
+		t.sinks.Release(key)
+	}
+	t.rulesLock.Unlock()
+	// 被跳过的events可能属于新的rules
+	t.rewindSkipped.Store(true)
+
+	t.Logger.Info("[Task]rules reloaded",
+		zap.String("config", t.Settings.ConfigFile),
+		zap.Strings("added", added),
+		zap.Strings("removed", removed),
+		zap.Strings("changed", changed),
+	)
+	t.trigger.Fire()
+	if len(added) > 0 {
+		go t.refreshCanal()
+	}
+	return nil
+}
+
+func (t *Task) onSettingsChanged() {
+	if err := t.Reload(); err != nil {
+		t.Logger.Error("[Task]reload settings error", zap.Error(err))
+	}
+}
+
+func diffRules(oldRules, newRules []*settings.RuleOptions) (added []string, removed []string, changed []string) {
+	oldMap := map[string]*settings.RuleOptions{}
+	for _, rule := range oldRules {
+		oldMap[rule.Key()] = rule
+	}
+
+	newMap := map[string]*settings.RuleOptions{}
+	for i, rule := range newRules {
+		newMap[rule.Key()] = rule
+
+		old, ok := oldMap[rule.Key()]
+		if !ok {
+			added = append(added, rule.Key())
+		} else if old.Call != rule.Call || old.Sink != rule.Sink || !reflect.DeepEqual(old.Options, rule.Options) || old.Persistent != rule.Persistent || old.Timeout != rule.Timeout || !reflect.DeepEqual(old.Arguments, rule.Arguments) || indexOfRule(oldRules, old) != i {
+			changed = append(changed, rule.Key())
+		}
+	}
+
+	for _, rule := range oldRules {
+		if _, ok := newMap[rule.Key()]; !ok {
+			removed = append(removed, rule.Key())
+		}
+	}
+	return
+}
+
+func indexOfRule(rules []*settings.RuleOptions, rule *settings.RuleOptions) int {
+	for i, r := range rules {
+		if r == rule {
+			return i
+		}
+	}
+	return -1
+}
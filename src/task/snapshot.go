@@ -0,0 +1,120 @@
+package task
+
+import (
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/dm.v1/src/canal"
+	"sync"
+)
+
+// snapshot 全量快照（mysqldump）的events范围，快照的events都写入sinks之后进行对账
+//
+//	只记录在内存中，快照结束之前进程退出则不会对账
+type snapshot struct {
+	lock sync.Mutex
+	// 快照的第一个event的ID，0表示没有快照
+	startID uint64
+	// 快照的最后一个event的ID，在mysqldump结束时记录
+	endID uint64
+	done  bool
+	// 已经通知sinks快照开始
+	begun bool
+}
+
+// onSnapshotRow OnRow收到mysqldump的行时调用，需要在SaveEvents之前
+func (t *Task) onSnapshotRow() {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+
+	if t.snapshot.startID == 0 {
+		t.snapshot.startID = t.Storage.LatestID() + 1
+		t.Logger.Info("[Task]snapshot started", zap.Uint64("start-id", t.snapshot.startID))
+	}
+}
+
+// onSnapshotDone mysqldump成功结束时调用
+//
+//	此时canal可能已经开始保存binlog的events，endID包含它们只会推迟对账
+func (t *Task) onSnapshotDone() {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+
+	if t.snapshot.startID > 0 && !t.snapshot.done {
+		t.snapshot.done = true
+		t.snapshot.endID = t.Storage.LatestID()
+		t.Logger.Info("[Task]snapshot dumped", zap.Uint64("start-id", t.snapshot.startID), zap.Uint64("end-id", t.snapshot.endID))
+		// mysqldump期间新增的rules
+		go t.refreshCanal()
+	}
+}
+
+// waitSnapshotDumped 等待canal的mysqldump结束，canal退出时mysqldump还没有成功则放弃快照
+//
+//	rotate、DDL以及Close时的OnPosSynced也是force，所以不能用来判断mysqldump结束
+func (t *Task) waitSnapshotDumped(c *canal.Canal, done <-chan struct{}) {
+	if c.WaitDumped(done) {
+		t.onSnapshotDone()
+	} else {
+		t.abortSnapshot()
+	}
+}
+
+// abortSnapshot mysqldump失败或者被中断，快照不完整，不能对账
+//
+//	已经保存的快照的行依然会被消费，下次启动时会重新mysqldump
+func (t *Task) abortSnapshot() {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+
+	if t.snapshot.startID > 0 && !t.snapshot.done {
+		t.Logger.Warn("[Task]snapshot interrupted, skip reconciling", zap.Uint64("start-id", t.snapshot.startID))
+		if t.snapshot.begun {
+			t.sinks.AbortSnapshot()
+		}
+		t.snapshot.reset()
+	}
+}
+
+// isSnapshotRunning mysqldump是否正在进行
+func (t *Task) isSnapshotRunning() bool {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+	return t.snapshot.startID > 0 && !t.snapshot.done
+}
+
+// beginSnapshot 在写入第一个快照的event之前通知sinks，由consumer调用
+func (t *Task) beginSnapshot(firstID uint64) {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+
+	if t.snapshot.startID > 0 && !t.snapshot.begun && firstID >= t.snapshot.startID {
+		t.snapshot.begun = true
+		t.sinks.BeginSnapshot()
+	}
+}
+
+// reconcileSnapshot 快照的events都已写入时进行对账，由consumer调用
+func (t *Task) reconcileSnapshot() {
+	t.snapshot.lock.Lock()
+	defer t.snapshot.lock.Unlock()
+
+	if !t.snapshot.done || t.nextConsumeEventID.Load() <= t.snapshot.endID {
+		return
+	} else if t.skippedEventID > 0 && t.skippedEventID <= t.snapshot.endID { // 被暂停的rule还有快照的行未写入
+		return
+	}
+	if !t.snapshot.begun { // 快照中没有需要写入的行
+		t.sinks.BeginSnapshot()
+	}
+
+	if err := t.sinks.Reconcile(t.callCtx); err != nil {
+		t.Logger.Error("[Task]reconcile sinks error", zap.Error(err))
+	} else {
+		t.Logger.Info("[Task]reconciled sinks after the snapshot")
+	}
+	t.snapshot.reset()
+}
+
+// reset 清除快照的范围，需要持有lock（不能直接赋值为零值，会清除lock本身）
+func (s *snapshot) reset() {
+	s.startID, s.endID, s.done, s.begun = 0, 0, false, false
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"context"
+	"github.com/go-mysql-org/go-mysql/canal"
+	consumer "gopkg.in/go-mixed/dm-consumer.v1"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"gopkg.in/go-mixed/dm.v1/src/sink"
+	"gopkg.in/go-mixed/dm.v1/src/storage"
+	"gopkg.in/go-mixed/go-common.v1/logger.v1"
+	"sync"
+	"testing"
+)
+
+// fakeReconciler 记录写入的行数和快照的调用次数
+type fakeReconciler struct {
+	lock       sync.Mutex
+	written    int
+	begun      int
+	reconciled int
+}
+
+var reconcilers = map[string]*fakeReconciler{}
+
+func init() {
+	sink.Register("test_reconciler", func() sink.Sink { return &fakeReconciler{} })
+}
+
+func (s *fakeReconciler) Open(ctx context.Context, params sink.Params) error {
+	reconcilers[params.Rule.Key()] = s
+	return nil
+}
+
+func (s *fakeReconciler) Write(ctx context.Context, events []consumer.RowEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.written += len(events)
+	return nil
+}
+
+func (s *fakeReconciler) Close() error {
+	return nil
+}
+
+func (s *fakeReconciler) BeginSnapshot() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.begun++
+}
+
+func (s *fakeReconciler) Reconcile(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reconciled++
+	return nil
+}
+
+func (s *fakeReconciler) counts() (int, int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.written, s.begun, s.reconciled
+}
+
+func newTestTask(t *testing.T) *Task {
+	l, err := logger.NewLogger(logger.LoggerOptions{FilePath: t.TempDir() + "/app.log", ConsoleMinLevel: "error", FileMinLevel: "error", FileEncoder: "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &settings.Settings{
+		Storage: t.TempDir(),
+		TaskOptions: settings.TaskOptions{
+			ScriptDir:   t.TempDir(),
+			MaxBulkSize: 100,
+			Rules:       []*settings.RuleOptions{{Schema: "test_db", Table: "users", Sink: "test_reconciler"}},
+		},
+	}
+	if err = s.TaskOptions.Initial(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewStorage(s, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	task := NewTask(&component.Components{Settings: s, Logger: l, Storage: store})
+	task.nextConsumeEventID.Store(1)
+	return task
+}
+
+// saveRows 模拟OnRow保存events，snapshot为true时是mysqldump的行
+func saveRows(task *Task, snapshot bool, count int) {
+	if snapshot {
+		task.onSnapshotRow()
+	}
+	var events []consumer.RowEvent
+	for i := 0; i < count; i++ {
+		events = append(events, consumer.RowEvent{Action: canal.InsertAction, Schema: "test_db", Table: "users", NewRow: map[string]any{"id": i}})
+	}
+	task.Storage.SaveEvents(events, common.EventMeta{Snapshot: snapshot})
+}
+
+func checkReconciler(t *testing.T, written, begun, reconciled int) {
+	t.Helper()
+	r, ok := reconcilers["test_db.users"]
+	if !ok {
+		t.Fatal("the sink is not opened")
+	}
+	if w, b, c := r.counts(); w != written || b != begun || c != reconciled {
+		t.Errorf("expected written %d, begun %d, reconciled %d, got %d, %d, %d", written, begun, reconciled, w, b, c)
+	}
+}
+
+func TestSnapshotReconcile(t *testing.T) {
+	task := newTestTask(t)
+
+	for i := 1; i <= 2; i++ {
+		saveRows(task, true, 3)
+		// mysqldump没有结束时不对账
+		task.consumer(0)
+		checkReconciler(t, 6*i-3, i, i-1)
+		if !task.isSnapshotRunning() {
+			t.Fatal("expected the snapshot running")
+		}
+
+		saveRows(task, true, 2)
+		task.onSnapshotDone()
+		// mysqldump结束之后的binlog行不影响对账
+		saveRows(task, false, 1)
+		task.consumer(0)
+		checkReconciler(t, 6*i, i, i)
+		if task.isSnapshotRunning() || task.snapshot.startID != 0 {
+			t.Fatalf("expected the snapshot reset after reconciling, got start-id %d", task.snapshot.startID)
+		}
+	}
+}
+
+func TestSnapshotAbort(t *testing.T) {
+	task := newTestTask(t)
+
+	saveRows(task, true, 3)
+	task.consumer(0)
+	// mysqldump被中断（比如退出或者失败）之后，不会再结束快照
+	task.abortSnapshot()
+	task.onSnapshotDone()
+	saveRows(task, false, 1)
+	task.consumer(0)
+	checkReconciler(t, 4, 1, 0)
+	if task.isSnapshotRunning() || task.snapshot.startID != 0 {
+		t.Fatalf("expected the snapshot reset after aborting, got start-id %d", task.snapshot.startID)
+	}
+}
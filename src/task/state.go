@@ -0,0 +1,168 @@
+package task
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/dm.v1/src/common"
+	"gopkg.in/go-mixed/dm.v1/src/settings"
+	"time"
+)
+
+// Status 任务当前的运行状态
+type Status struct {
+	BinLog        common.BinLogPosition `json:"binlog"`
+	EventCount    uint64                `json:"event_count"`
+	LatestID      uint64                `json:"latest_id"`
+	NextConsumeID uint64                `json:"next_consume_id"`
+	ReaderPaused  bool                  `json:"reader_paused"`
+}
+
+// RuleState 每一个rule的运行状态
+type RuleState struct {
+	Rule      string    `json:"rule"`
+	Call      string    `json:"call"`
+	Paused    bool      `json:"paused"`
+	Consumed  uint64    `json:"consumed"`
+	Failures  uint64    `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	LastRunAt time.Time `json:"last_run_at"`
+}
+
+// ScriptInfo 已加载的脚本信息
+type ScriptInfo struct {
+	Dir      string    `json:"dir"`
+	Verbose  bool      `json:"verbose"`
+	Files    []string  `json:"files"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+func (t *Task) Status() Status {
+	return Status{
+		BinLog:        t.Storage.ReadBinLogPosition(),
+		EventCount:    t.Storage.EventCount(),
+		LatestID:      t.Storage.LatestID(),
+		NextConsumeID: t.nextConsumeEventID.Load(),
+		ReaderPaused:  t.readerPauser.IsPaused(),
+	}
+}
+
+// RuleStates 不使用rulesLock，以免等待正在写入sink的批次，参见 matchRule
+func (t *Task) RuleStates() []RuleState {
+	rules := t.matchingRules.Load().Rules
+
+	t.statesLock.Lock()
+	defer t.statesLock.Unlock()
+
+	var states []RuleState
+	for _, rule := range rules {
+		state := t.getRuleState(rule.Key())
+		state.Call = rule.SinkName()
+		states = append(states, *state)
+	}
+	return states
+}
+
+func (t *Task) ScriptInfo() ScriptInfo {
+	return ScriptInfo{
+		Dir:      t.script.Dir(),
+		Verbose:  t.Settings.TaskOptions.ScriptVerbose,
+		Files:    t.script.Files(),
+		LoadedAt: t.script.LoadedAt(),
+	}
+}
+
+// PauseReader 暂停读取binlog，正在处理的事件会在下一个OnRow时阻塞
+func (t *Task) PauseReader() bool {
+	return t.readerPauser.Pause()
+}
+
+func (t *Task) ResumeReader() bool {
+	if !t.readerPauser.Resume() {
+		return false
+	}
+	// 暂停期间新增的rules
+	go t.refreshCanal()
+	return true
+}
+
+// PauseRule 暂停某个rule的消费
+//
+//	该rule的events会被跳过并保留在storage中，其它rule继续消费，恢复后按原来的顺序消费
+func (t *Task) PauseRule(key string) error {
+	return t.setRulePaused(key, true)
+}
+
+func (t *Task) ResumeRule(key string) error {
+	if err := t.setRulePaused(key, false); err != nil {
+		return err
+	}
+	t.rewindSkipped.Store(true)
+	t.trigger.Fire()
+	return nil
+}
+
+// Consume 立即触发一次消费
+func (t *Task) Consume() {
+	t.trigger.Fire()
+}
+
+func (t *Task) setRulePaused(key string, paused bool) error {
+	if t.findRule(key) == nil {
+		return errors.Errorf("rule \"%s\" not found", key)
+	}
+
+	t.statesLock.Lock()
+	defer t.statesLock.Unlock()
+	t.getRuleState(key).Paused = paused
+	return nil
+}
+
+// findRule 与RuleStates相同，不使用rulesLock
+func (t *Task) findRule(key string) *settings.RuleOptions {
+	for _, rule := range t.matchingRules.Load().Rules {
+		if rule.Key() == key {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchRule 由OnRow调用，不使用rulesLock：consumer写入sink时一直持有读锁，等待中的Reload会让新的读锁阻塞读取binlog
+func (t *Task) matchRule(schema, table string) bool {
+	return t.matchingRules.Load().MatchRule(schema, table) != nil
+}
+
+func (t *Task) setMatchingRules(rules []*settings.RuleOptions) {
+	t.matchingRules.Store(&settings.TaskOptions{Rules: rules})
+}
+
+func (t *Task) isRulePaused(rule *settings.RuleOptions) bool {
+	t.statesLock.Lock()
+	defer t.statesLock.Unlock()
+	return t.getRuleState(rule.Key()).Paused
+}
+
+// 记录rule的执行结果
+func (t *Task) recordRuleResult(rule *settings.RuleOptions, count int, err error) {
+	t.statesLock.Lock()
+	defer t.statesLock.Unlock()
+
+	state := t.getRuleState(rule.Key())
+	state.LastRunAt = time.Now()
+	if err != nil {
+		state.Failures++
+		state.LastError = err.Error()
+	} else {
+		state.Consumed += uint64(count)
+		state.LastError = ""
+	}
+}
+
+// 需要在statesLock中调用
+func (t *Task) getRuleState(key string) *RuleState {
+	state, ok := t.ruleStates[key]
+	if !ok {
+		state = &RuleState{Rule: key}
+		t.ruleStates[key] = state
+	}
+	return state
+}
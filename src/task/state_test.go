@@ -0,0 +1,35 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRuleStatesWhileConsuming(t *testing.T) {
+	task := newTestTask(t)
+
+	// consumer写入sink时持有读锁，Reload等待写锁，之后新的读锁都会阻塞
+	task.rulesLock.RLock()
+	defer task.rulesLock.RUnlock()
+	go func() {
+		task.rulesLock.Lock()
+		defer task.rulesLock.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan []RuleState, 1)
+	go func() {
+		if err := task.PauseRule("test_db.users"); err != nil {
+			t.Error(err)
+		}
+		done <- task.RuleStates()
+	}()
+	select {
+	case states := <-done:
+		if len(states) != 1 || states[0].Rule != "test_db.users" || !states[0].Paused {
+			t.Errorf("unexpected states %+v", states)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RuleStates is blocked by the consuming batch")
+	}
+}
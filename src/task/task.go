@@ -3,30 +3,73 @@ package task
 import (
 	"context"
 	"fmt"
-	"github.com/goplus/igop"
-	"go.uber.org/multierr"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	consumer "gopkg.in/go-mixed/dm-consumer.v1"
 	"gopkg.in/go-mixed/dm.v1/src/canal"
 	"gopkg.in/go-mixed/dm.v1/src/common"
 	"gopkg.in/go-mixed/dm.v1/src/component"
+	"gopkg.in/go-mixed/dm.v1/src/exporter"
+	"gopkg.in/go-mixed/dm.v1/src/record"
+	"gopkg.in/go-mixed/dm.v1/src/script"
 	"gopkg.in/go-mixed/dm.v1/src/settings"
-	"gopkg.in/go-mixed/igop.v1/mod"
+	"gopkg.in/go-mixed/dm.v1/src/sink"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Task struct {
 	*component.Components
 
-	canal *canal.Canal
+	// canal只读取启动时rules的表，新增rules时会被替换
+	canalLock sync.Mutex
+	canal     *canal.Canal
+	// 当前canal的runCanal退出时关闭
+	canalDone chan struct{}
 
 	binLog common.BinLogPosition
 
 	trigger *common.Trigger
 	// 由于使用的延时删除，所以需要记录下一个消费的ID
 	// 不然幻读会导致随机ID重复消费
-	nextConsumeEventID uint64
+	nextConsumeEventID atomic.Uint64
+	// 被暂停的rule跳过（未删除）的最小ID，只在consumer中读写，0表示没有
+	skippedEventID uint64
+	// 恢复rule或者重新加载rules之后，consumer从skippedEventID重新扫描
+	rewindSkipped atomic.Bool
 
-	igopCtx *mod.Context
+	// 运行时的ctx，用于暂停读取时退出阻塞
+	ctx          context.Context
+	readerPauser *common.Pauser
+
+	// OnRow过滤和admin查询时使用的rules，Reload时立即替换，不需要等待rulesLock
+	matchingRules atomic.Pointer[settings.TaskOptions]
+
+	// 消费时持有读锁，保证重新加载的rules只会在两个批次之间生效
+	rulesLock  sync.RWMutex
+	reloadLock sync.Mutex
+	statesLock sync.Mutex
+	ruleStates map[string]*RuleState
+
+	script *script.Script
+	sinks  *sink.Manager
+	// 所有script调用的ctx，退出时等待ShutdownGrace后取消
+	callCtx     context.Context
+	cancelCalls context.CancelFunc
+
+	// 不为nil时，将OnRow收到的events录制到文件中
+	recorder *record.Recorder
+
+	// 不为nil时，不删除已消费的events，也不保存binlog位置
+	dryRun *exporter.DryRun
+	// dry-run开始时storage中最大的ID，退出时删除之后写入的events
+	dryRunLatestID uint64
+
+	snapshot snapshot
+	// 当前事务中第一个行事件结束的位置，OnXID时清零，参见 common.EventMeta.TxnPos
+	txnPos uint32
 }
 
 func NewTask(components *component.Components) *Task {
@@ -34,8 +77,16 @@ func NewTask(components *component.Components) *Task {
 		Components: components,
 		binLog:     components.Settings.TaskOptions.BinLog,
 		canal:      nil,
+
+		ctx:          context.Background(),
+		readerPauser: common.NewPauser(),
+		ruleStates:   map[string]*RuleState{},
+		script:       script.NewScript(components.Settings, components.Logger),
 	}
+	t.sinks = sink.NewManager(components, t.script)
+	t.setMatchingRules(components.Settings.TaskOptions.Rules)
 
+	t.callCtx, t.cancelCalls = context.WithCancel(context.Background())
 	t.trigger = common.NewAtomicTrigger(components.Settings.TaskOptions.MaxBulkSize, components.Settings.TaskOptions.MaxWait, t.consumer)
 
 	return t
@@ -48,12 +99,36 @@ func (t *Task) Initial() error {
 	}
 	t.canal = c
 
-	t.igopCtx, err = buildIgop(t.Settings.TaskOptions.ScriptDir, t.Settings.TaskOptions.ScriptVerbose)
+	if err = t.script.Load(); err != nil {
+		return errors.WithMessagef(err, "positions: %v", script.ErrorPositions(err))
+	}
 
 	// 启动时 需要触发
 	t.trigger.OnCountChanged(t.Storage.EventCount())
 
-	return err
+	return nil
+}
+
+// SetRecorder 需要在Run之前调用
+func (t *Task) SetRecorder(recorder *record.Recorder) {
+	t.recorder = recorder
+}
+
+// SetDryRun 需要在Run之前调用
+func (t *Task) SetDryRun(dryRun *exporter.DryRun) {
+	t.dryRun = dryRun
+	t.sinks.SetDryRun(dryRun)
+	t.dryRunLatestID = t.Storage.LatestID()
+}
+
+// remainCount 剩余需要消费的events数量，dry-run时已消费的events不会被删除
+func (t *Task) remainCount() uint64 {
+	if t.dryRun == nil {
+		return t.Storage.EventCount()
+	}
+
+	latestID, nextID := t.Storage.LatestID(), t.nextConsumeEventID.Load()
+	return core.If(latestID >= nextID, latestID-nextID+1, 0)
 }
 
 func (t *Task) String() string {
@@ -61,22 +136,108 @@ func (t *Task) String() string {
 }
 
 func (t *Task) Run(ctx context.Context) {
-	go t.runCanal()
+	t.ctx = ctx
+	t.canalLock.Lock()
+	t.startCanal()
+	t.canalLock.Unlock()
 	go t.trigger.Run(ctx)
 
+	if t.Settings.TaskOptions.WatchSettings {
+		go common.NewFileWatcher(t.Settings.TaskOptions.WatchInterval, t.onSettingsChanged, t.Settings.ConfigFile).Run(ctx)
+	}
+	if t.Settings.TaskOptions.WatchScripts {
+		go t.script.Watch(ctx)
+	}
+
 	<-ctx.Done()
+	t.canalLock.Lock()
 	t.canal.Stop()
+	t.canalLock.Unlock()
+
+	// 等待当前批次消费完毕后，结束常驻的解释器，超过ShutdownGrace则放弃
+	grace := time.AfterFunc(t.Settings.TaskOptions.ShutdownGrace, t.cancelCalls)
+	defer grace.Stop()
+	defer t.cancelCalls()
+
+	t.rulesLock.Lock()
+	defer t.rulesLock.Unlock()
+	if err := t.sinks.Close(); err != nil {
+		t.Logger.Error("[Task]close sinks error", zap.Error(err))
+	}
+	if err := t.script.Close(t.callCtx); err != nil {
+		t.Logger.Error("[Task]close script error", zap.Error(err))
+	}
+
+	// dry-run时binlog位置没有前进，删除本次写入的events，以便下次从binlog中重新读取
+	if t.dryRun != nil {
+		if n, err := t.Storage.DeleteEventsFrom(t.dryRunLatestID + 1); err != nil {
+			t.Logger.Error("[Task]delete the events of dry-run error", zap.Error(err))
+		} else {
+			t.Logger.Info("[Task]deleted the events of dry-run", zap.Int64("count", n))
+		}
+	}
+}
+
+// startCanal 需要持有canalLock
+func (t *Task) startCanal() {
+	t.canalDone = make(chan struct{})
+	go t.runCanal(t.canal, t.canalDone)
 }
 
-func (t *Task) runCanal() {
-	if err := t.canal.Start(t.Storage.GetLatestBinLogPosition(t.binLog)); err != nil {
+func (t *Task) runCanal(c *canal.Canal, done chan struct{}) {
+	defer close(done)
+	go t.waitSnapshotDumped(c, done)
+	if err := c.Start(t.Storage.GetLatestBinLogPosition(t.binLog)); err != nil {
 		t.Logger.Error("[Task]canal work error", zap.Error(err))
 	}
 }
 
+// refreshCanal canal只读取匹配启动时rules的表，新增的rules匹配了其它表时，从保存的binlog位置重启canal
+//
+//	mysqldump和暂停读取时不能重启，快照结束或者恢复读取后再调用；
+//	重启时读取到一半的事务会被重新读取，与进程重启相同，这些events会重复
+func (t *Task) refreshCanal() {
+	// 新的canal从t.Settings中读取rules
+	t.reloadLock.Lock()
+	defer t.reloadLock.Unlock()
+	t.canalLock.Lock()
+	defer t.canalLock.Unlock()
+
+	patterns := t.Settings.TaskOptions.GetTablePatterns()
+	if t.canal == nil || t.canalDone == nil || t.ctx.Err() != nil || t.canal.Includes(patterns) {
+		return
+	} else if t.isSnapshotRunning() || t.readerPauser.IsPaused() {
+		t.Logger.Info("[Task]canal will be restarted for the new rules after the snapshot or the pausing")
+		return
+	}
+
+	c, err := canal.NewCanal(t.Components, t)
+	if err != nil {
+		t.Logger.Error("[Task]create canal for the new rules error", zap.Error(err))
+		return
+	}
+	// Stop时会保存当前的binlog位置，等待正在处理的event结束后再从这个位置启动
+	t.canal.Stop()
+	<-t.canalDone
+	t.canal = c
+	t.startCanal()
+	t.Logger.Info("[Task]canal restarted for the new rules", zap.Strings("patterns", patterns))
+}
+
+// deleteConsumedEvents 删除已消费以及无rule匹配的events，被暂停的rule跳过的events需要保留
+func (t *Task) deleteConsumedEvents(keyEnd string, keys []string) {
+	if t.dryRun != nil || len(keys) <= 0 {
+		return
+	} else if t.skippedEventID == 0 { // 之前没有保留的events时，才可以按范围删除
+		t.Storage.DeleteEventsTo(keyEnd) // 删除符合要求的keys
+	} else if err := t.Storage.DeleteEvents(keys); err != nil {
+		t.Logger.Error("[Task]delete consumed events error", zap.Error(err))
+	}
+}
+
 // 消费events
 func (t *Task) consumer(taskId uint64) {
-	count := t.Storage.EventCount()
+	count := t.remainCount()
 
 	if count <= 0 {
 		return
@@ -87,49 +248,99 @@ func (t *Task) consumer(taskId uint64) {
 		zap.Uint64("event remain count", count),
 	)
 
-	// 将同一个rule的events分配在一起
+	// 重新加载的rules只在两个批次之间生效
+	t.rulesLock.RLock()
+	defer t.rulesLock.RUnlock()
+
+	if t.rewindSkipped.Swap(false) && t.skippedEventID > 0 {
+		if t.skippedEventID < t.nextConsumeEventID.Load() {
+			t.nextConsumeEventID.Store(t.skippedEventID)
+		}
+		t.skippedEventID = 0
+	}
+
+	// 将同一个rule的events分配在一起，被暂停的rule的events跳过但保留，其它rule继续消费
 	var lastRule *settings.RuleOptions
 	var keyEnd string
+	var lastID, skippedID uint64
+	// 保留了被跳过的events时，不能按范围删除，只删除这些keys
+	var consumedKeys []string
 	var events []consumer.RowEvent
+	metas := map[uint64]common.EventMeta{}
 
-	t.Storage.EventForEach(common.BuildEventKey(t.nextConsumeEventID, "", "", ""), func(key string, event consumer.RowEvent) bool {
+	t.Storage.EventForEach(common.BuildEventKey(t.nextConsumeEventID.Load(), "", "", ""), func(key string, event consumer.RowEvent, meta common.EventMeta) bool {
 		t.Logger.Debug("[Task]read event from storage", zap.Uint64("task-id", taskId), zap.String("key", key))
 		rule := t.Settings.TaskOptions.MatchRule(event.Schema, event.Table)
 		if rule == nil { // 无rule匹配项，继续循环
-			keyEnd = key
+			keyEnd, lastID = key, event.ID
+			consumedKeys = append(consumedKeys, key)
 			return true
 		} else if lastRule != nil && rule != lastRule { // 和上一个匹配的rule不一样, 终止匹配
 			return false
+		} else if t.isRulePaused(rule) { // rule被暂停, 跳过该event
+			t.Logger.Debug("[Task]rule paused", zap.String("rule", rule.Key()), zap.String("key", key))
+			if skippedID == 0 {
+				skippedID = event.ID
+			}
+			lastID = event.ID
+			return true
 		}
-		keyEnd = key
+		keyEnd, lastID = key, event.ID
 		lastRule = rule
 		events = append(events, event)
+		consumedKeys = append(consumedKeys, key)
+		metas[event.ID] = meta
 		return true
 	})
 
+	if skippedID > 0 && (t.skippedEventID == 0 || skippedID < t.skippedEventID) {
+		t.skippedEventID = skippedID
+	}
+
 	c := len(events)
 	if c > 0 {
-		methodErr, panicErr := igopCall(t.igopCtx, lastRule.Call, []igop.Value{events, lastRule.Arguments})
-		_methodErr, _ := methodErr.(error)
-		err := multierr.Append(_methodErr, panicErr)
+		t.beginSnapshot(events[0].ID)
+		// 脚本重新编译后，只在两个批次之间替换
+		err := t.sinks.Write(sink.WithEventMetas(t.callCtx, metas), lastRule, events)
+		t.recordRuleResult(lastRule, c, err)
 		if err != nil {
-			t.Logger.Error("[Task]execute igop error",
-				zap.String("method", lastRule.Call),
+			t.Logger.Error("[Task]write sink error",
+				zap.String("sink", lastRule.SinkName()),
 				zap.Error(err),
 			)
-		} else {
-			t.nextConsumeEventID = events[c-1].ID + 1
-			t.Storage.DeleteEventsTo(keyEnd) // 删除符合要求的keys
-			t.Logger.Info("[Task]executed igop",
-				zap.String("method", lastRule.Call),
-				zap.Uint64("next-id", t.nextConsumeEventID),
+		}
+		// 重试也不会成功的events移入死信（批次中已经写入的不会），然后和成功一样继续消费
+		if poison := sink.PoisonEvents(err, events); len(poison) > 0 && t.dryRun == nil {
+			if err = t.Storage.SaveDeadLetter(lastRule.Key(), lastRule.SinkName(), err, poison); err != nil {
+				t.Logger.Error("[Task]save dead letter error", zap.Error(err))
+			} else {
+				t.Logger.Warn("[Task]moved the poison events to dead letters",
+					zap.String("sink", lastRule.SinkName()),
+					zap.Uint64("start-id", poison[0].ID),
+					zap.Uint64("end-id", poison[len(poison)-1].ID),
+					zap.Int("count", len(poison)),
+				)
+			}
+		}
+		if err == nil {
+			t.nextConsumeEventID.Store(events[c-1].ID + 1)
+			t.deleteConsumedEvents(keyEnd, consumedKeys)
+			t.Logger.Info("[Task]written to sink",
+				zap.String("sink", lastRule.SinkName()),
+				zap.Uint64("next-id", t.nextConsumeEventID.Load()),
 				zap.Uint64("start-id", events[0].ID),
 				zap.Uint64("end-id", events[c-1].ID),
 				zap.Int("count", c),
 			)
 		}
+	} else if lastID > 0 {
+		// 只有无rule匹配和被暂停的events，越过它们，以免被暂停的events占满每次扫描的范围
+		t.nextConsumeEventID.Store(lastID + 1)
+		t.deleteConsumedEvents(keyEnd, consumedKeys)
 	}
 
+	t.reconcileSnapshot()
+
 	// 触发消费之后的的数量
-	t.trigger.OnCountChanged(t.Storage.EventCount())
+	t.trigger.OnCountChanged(t.remainCount())
 }